@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/budimanjojo/talhelper/v3/pkg/config"
+	"github.com/budimanjojo/talhelper/v3/pkg/generate"
+	"github.com/budimanjojo/talhelper/v3/pkg/talos"
+)
+
+var (
+	explainCfgFile               string
+	explainCluster               string
+	explainEnvFile               []string
+	explainSecretFile            []string
+	explainTalosMode             string
+	explainOfflineMode           bool
+	explainNoSchematicCache      bool
+	explainRefreshSchematicCache bool
+	explainShowSecrets           bool
+	explainOutput                string
+)
+
+var explainCmd = &cobra.Command{
+	Use:   "explain <node> [yaml-path]",
+	Short: "Show the effective configuration of a node and where every value comes from.",
+	Long: `Show the effective configuration of a node and where every value comes from.
+The node is selected by its hostname or IP address. It prints the node after
+it's merged with its node groups and the generated Talos machineconfig, every
+value is annotated with its source: the node, a node group, a patch, an extra
+manifest, a talhelper default or "generated" for values generated by talhelper.
+If yaml-path is specified (e.g: machine.install), only values in it are printed.`,
+	Args: cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		raw, err := config.LoadClusterFromFile(explainCfgFile, explainCluster, explainEnvFile)
+		if err != nil {
+			log.Fatalf("failed to parse config file: %s", err)
+		}
+
+		cfg, err := config.LoadAndValidateClusterFromFile(explainCfgFile, explainCluster, explainEnvFile, false)
+		if err != nil {
+			log.Fatalf("failed to parse config file: %s", err)
+		}
+
+		var secretFile string
+		for _, file := range explainSecretFile {
+			if _, err := os.Stat(file); err == nil {
+				secretFile = file
+				slog.Debug(fmt.Sprintf("secret file is set to %s", secretFile))
+			} else if errors.Is(err, os.ErrNotExist) {
+				continue
+			} else {
+				log.Fatalf("failed to stat secret file %s: %s ", file, err)
+			}
+		}
+
+		talos.SetSchematicCache(explainNoSchematicCache, explainRefreshSchematicCache)
+
+		explanation, err := generate.ExplainNode(raw, cfg, args[0], generate.ConfigOptions{
+			SecretFile:  secretFile,
+			Mode:        explainTalosMode,
+			OfflineMode: explainOfflineMode,
+			ShowSecrets: explainShowSecrets,
+		})
+		if err != nil {
+			log.Fatalf("failed to explain node %s: %s", args[0], err)
+		}
+
+		if len(args) > 1 {
+			explanation, err = explanation.Filter(args[1])
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		if err := generate.PrintExplanation(explanation, explainOutput); err != nil {
+			log.Fatalf("failed to print explanation: %s", err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(explainCmd)
+
+	explainCmd.Flags().StringVarP(&explainCfgFile, "config-file", "c", "talconfig.yaml", "File containing configurations for talhelper")
+	explainCmd.Flags().StringVar(&explainCluster, "cluster", "", "Name of the cluster the node belongs to when config file has multiple clusters")
+	explainCmd.Flags().StringSliceVarP(&explainEnvFile, "env-file", "e", []string{"talenv.yaml", "talenv.sops.yaml", "talenv.yml", "talenv.sops.yml"}, "List of files containing env variables for config file")
+	explainCmd.Flags().StringSliceVarP(&explainSecretFile, "secret-file", "s", []string{"talsecret.yaml", "talsecret.sops.yaml", "talsecret.yml", "talsecret.sops.yml"}, "List of files containing secrets for the cluster")
+	explainCmd.Flags().StringVarP(&explainTalosMode, "talos-mode", "m", "metal", "Talos runtime mode to generate config for")
+	explainCmd.Flags().BoolVar(&explainOfflineMode, "offline-mode", false, "Generate schematic ID without doing POST request to image-factory")
+	explainCmd.Flags().BoolVar(&explainNoSchematicCache, "no-schematic-cache", false, "Always do POST request to image-factory instead of using cached schematic ID")
+	explainCmd.Flags().BoolVar(&explainRefreshSchematicCache, "refresh-schematic-cache", false, "Refresh cached schematic ID by doing POST request to image-factory")
+	explainCmd.Flags().BoolVar(&explainShowSecrets, "show-secrets", false, "Show secret values instead of their hashes")
+	explainCmd.Flags().StringVar(&explainOutput, "output", "text", "Output format ("+strings.Join(generate.ExplainFormats, ", ")+")")
+}
@@ -1,29 +1,69 @@
 package cmd
 
 import (
+	"log"
+	"strings"
+	"time"
+
 	"github.com/budimanjojo/talhelper/v3/cmd/helpers"
+	"github.com/budimanjojo/talhelper/v3/pkg/execute"
+	"github.com/budimanjojo/talhelper/v3/pkg/generate"
 	"github.com/spf13/cobra"
 )
 
 var (
 	gencommandCfgFile    string
+	gencommandCluster    string
 	gencommandOutDir     string
 	gencommandEnvFile    []string
 	gencommandExtraFlags []string
 	gencommandNode       string
+	gencommandOutput     string
+	gencommandExecute    bool
+	gencommandWait       bool
+	gencommandTimeout    time.Duration
 )
 
 var gencommandCmd = &cobra.Command{
 	Use:   "gencommand",
 	Short: "Generate commands for talosctl.",
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		rootCmd.PersistentPreRun(cmd, args)
+
+		// check the output format before the commands are generated, which
+		// can do requests to image-factory
+		if err := generate.CheckCommandOutputFormat(gencommandOutput); err != nil {
+			log.Fatalf("invalid --output flag: %s", err)
+		}
+	},
 }
 
 func init() {
 	rootCmd.AddCommand(gencommandCmd)
 	gencommandCmd.PersistentFlags().StringVarP(&gencommandCfgFile, "config-file", "c", "talconfig.yaml", "File containing configurations for talhelper")
+	gencommandCmd.PersistentFlags().StringVar(&gencommandCluster, "cluster", "", "Name of the cluster to generate commands for when config file has multiple clusters")
 	gencommandCmd.PersistentFlags().StringVarP(&gencommandOutDir, "out-dir", "o", "./clusterconfig", "Directory that contains the generated config files to apply.")
 	gencommandCmd.PersistentFlags().StringSliceVarP(&gencommandEnvFile, "env-file", "e", []string{"talenv.yaml", "talenv.sops.yaml", "talenv.yml", "talenv.sops.yml"}, "List of files containing env variables for config file")
 	gencommandCmd.PersistentFlags().StringSliceVar(&gencommandExtraFlags, "extra-flags", []string{}, "List of additional flags that will be injected into the generated commands.")
 	gencommandCmd.PersistentFlags().StringVarP(&gencommandNode, "node", "n", "", "A specific node to generate the command for. If not specified, will generate for all nodes.")
+	gencommandCmd.PersistentFlags().StringVar(&gencommandOutput, "output", "shell", "Output format of the generated commands ("+strings.Join(generate.CommandOutputFormats, ", ")+")")
 	_ = helpers.MakeNodeCompletion(gencommandCmd)
 }
+
+// addExecuteFlag adds `--execute`, `--wait` and `--timeout` flags to
+// subcommands that can be run directly through the Talos API.
+func addExecuteFlag(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&gencommandExecute, "execute", false, "Execute the generated commands through the Talos API instead of printing them")
+	cmd.Flags().BoolVar(&gencommandWait, "wait", true, "Wait for every node to come back healthy after upgrade or reset before executing the next command")
+	cmd.Flags().DurationVar(&gencommandTimeout, "timeout", execute.DefaultTimeout, "Maximum time to wait for every node with --wait")
+}
+
+// printOrExecuteCommands executes `cmds` if `--execute` is set, otherwise it
+// prints them in the format specified by `--output`. It returns an error, if any.
+func printOrExecuteCommands(cmd *cobra.Command, cmds generate.Commands) error {
+	if gencommandExecute {
+		e := &execute.Executor{Wait: gencommandWait, Timeout: gencommandTimeout}
+		return e.Run(cmd.Context(), cmds)
+	}
+	return generate.PrintCommands(cmds, gencommandOutput)
+}
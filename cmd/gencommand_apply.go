@@ -14,18 +14,23 @@ var gencommandApplyCmd = &cobra.Command{
 	Short: "Generate talosctl apply-config commands.",
 	Args:  cobra.NoArgs,
 	Run: func(cmd *cobra.Command, args []string) {
-		cfg, err := config.LoadAndValidateFromFile(gencommandCfgFile, gencommandEnvFile, false)
+		cfg, err := config.LoadAndValidateClusterFromFile(gencommandCfgFile, gencommandCluster, gencommandEnvFile, false)
 		if err != nil {
 			log.Fatalf("failed to parse config file: %s", err)
 		}
 
-		err = generate.GenerateApplyCommand(cfg, gencommandOutDir, gencommandNode, gencommandExtraFlags)
+		cmds, err := generate.ApplyCommands(cfg, gencommandOutDir, gencommandNode, gencommandExtraFlags)
 		if err != nil {
 			log.Fatalf("failed to generate talosctl apply command: %s", err)
 		}
+
+		if err := printOrExecuteCommands(cmd, cmds); err != nil {
+			log.Fatalf("failed to run talosctl apply command: %s", err)
+		}
 	},
 }
 
 func init() {
 	gencommandCmd.AddCommand(gencommandApplyCmd)
+	addExecuteFlag(gencommandApplyCmd)
 }
@@ -14,18 +14,23 @@ var gencommandBootstrapCmd = &cobra.Command{
 	Short: "Generate talosctl bootstrap commands.",
 	Args:  cobra.NoArgs,
 	Run: func(cmd *cobra.Command, args []string) {
-		cfg, err := config.LoadAndValidateFromFile(gencommandCfgFile, gencommandEnvFile, false)
+		cfg, err := config.LoadAndValidateClusterFromFile(gencommandCfgFile, gencommandCluster, gencommandEnvFile, false)
 		if err != nil {
 			log.Fatalf("failed to parse config file: %s", err)
 		}
 
-		err = generate.GenerateBootstrapCommand(cfg, gencommandOutDir, gencommandNode, gencommandExtraFlags)
+		cmds, err := generate.BootstrapCommands(cfg, gencommandOutDir, gencommandNode, gencommandExtraFlags)
 		if err != nil {
 			log.Fatalf("failed to generate talosctl bootstrap command: %s", err)
 		}
+
+		if err := printOrExecuteCommands(cmd, cmds); err != nil {
+			log.Fatalf("failed to run talosctl bootstrap command: %s", err)
+		}
 	},
 }
 
 func init() {
 	gencommandCmd.AddCommand(gencommandBootstrapCmd)
+	addExecuteFlag(gencommandBootstrapCmd)
 }
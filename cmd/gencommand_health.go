@@ -14,12 +14,12 @@ var gencommandHealthCmd = &cobra.Command{
 	Short: "Generate talosctl health commands.",
 	Args:  cobra.NoArgs,
 	Run: func(cmd *cobra.Command, args []string) {
-		cfg, err := config.LoadAndValidateFromFile(gencommandCfgFile, gencommandEnvFile, false)
+		cfg, err := config.LoadAndValidateClusterFromFile(gencommandCfgFile, gencommandCluster, gencommandEnvFile, false)
 		if err != nil {
 			log.Fatalf("failed to parse config file: %s", err)
 		}
 
-		err = generate.GenerateHealthCommand(cfg, gencommandOutDir, gencommandNode, gencommandExtraFlags)
+		err = generate.GenerateHealthCommand(cfg, gencommandOutDir, gencommandNode, gencommandExtraFlags, gencommandOutput)
 		if err != nil {
 			log.Fatalf("failed to generate talosctl health command: %s", err)
 		}
@@ -14,18 +14,23 @@ var gencommandResetCmd = &cobra.Command{
 	Short: "Generate talosctl reset commands.",
 	Args:  cobra.NoArgs,
 	Run: func(cmd *cobra.Command, args []string) {
-		cfg, err := config.LoadAndValidateFromFile(gencommandCfgFile, gencommandEnvFile, false)
+		cfg, err := config.LoadAndValidateClusterFromFile(gencommandCfgFile, gencommandCluster, gencommandEnvFile, false)
 		if err != nil {
 			log.Fatalf("failed to parse config file: %s", err)
 		}
 
-		err = generate.GenerateResetCommand(cfg, gencommandOutDir, gencommandNode, gencommandExtraFlags)
+		cmds, err := generate.ResetCommands(cfg, gencommandOutDir, gencommandNode, gencommandExtraFlags)
 		if err != nil {
 			log.Fatalf("failed to generate talosctl reset command: %s", err)
 		}
+
+		if err := printOrExecuteCommands(cmd, cmds); err != nil {
+			log.Fatalf("failed to run talosctl reset command: %s", err)
+		}
 	},
 }
 
 func init() {
 	gencommandCmd.AddCommand(gencommandResetCmd)
+	addExecuteFlag(gencommandResetCmd)
 }
@@ -14,12 +14,12 @@ var gencommandUpgradeK8sCmd = &cobra.Command{
 	Short: "Generate talosctl upgrade-k8s commands.",
 	Args:  cobra.NoArgs,
 	Run: func(cmd *cobra.Command, args []string) {
-		cfg, err := config.LoadAndValidateFromFile(gencommandCfgFile, gencommandEnvFile, false)
+		cfg, err := config.LoadAndValidateClusterFromFile(gencommandCfgFile, gencommandCluster, gencommandEnvFile, false)
 		if err != nil {
 			log.Fatalf("failed to parse config file: %s", err)
 		}
 
-		err = generate.GenerateUpgradeK8sCommand(cfg, gencommandOutDir, gencommandNode, gencommandExtraFlags)
+		err = generate.GenerateUpgradeK8sCommand(cfg, gencommandOutDir, gencommandNode, gencommandExtraFlags, gencommandOutput)
 		if err != nil {
 			log.Fatalf("failed to generate talosctl upgrade-k8s command: %s", err)
 		}
@@ -7,29 +7,43 @@ import (
 
 	"github.com/budimanjojo/talhelper/v3/pkg/config"
 	"github.com/budimanjojo/talhelper/v3/pkg/generate"
+	"github.com/budimanjojo/talhelper/v3/pkg/talos"
 )
 
-var gencommandOfflineMode bool
+var (
+	gencommandOfflineMode           bool
+	gencommandNoSchematicCache      bool
+	gencommandRefreshSchematicCache bool
+)
 
 var gencommandUpgradeCmd = &cobra.Command{
 	Use:   "upgrade",
 	Short: "Generate talosctl upgrade commands.",
 	Args:  cobra.NoArgs,
 	Run: func(cmd *cobra.Command, args []string) {
-		cfg, err := config.LoadAndValidateFromFile(gencommandCfgFile, gencommandEnvFile, false)
+		cfg, err := config.LoadAndValidateClusterFromFile(gencommandCfgFile, gencommandCluster, gencommandEnvFile, false)
 		if err != nil {
 			log.Fatalf("failed to parse config file: %s", err)
 		}
 
-		err = generate.GenerateUpgradeCommand(cfg, gencommandOutDir, gencommandNode, gencommandExtraFlags, gencommandOfflineMode)
+		talos.SetSchematicCache(gencommandNoSchematicCache, gencommandRefreshSchematicCache)
+
+		cmds, err := generate.UpgradeCommands(cfg, gencommandOutDir, gencommandNode, gencommandExtraFlags, gencommandOfflineMode)
 		if err != nil {
 			log.Fatalf("failed to generate talosctl upgrade command: %s", err)
 		}
+
+		if err := printOrExecuteCommands(cmd, cmds); err != nil {
+			log.Fatalf("failed to run talosctl upgrade command: %s", err)
+		}
 	},
 }
 
 func init() {
 	gencommandCmd.AddCommand(gencommandUpgradeCmd)
+	addExecuteFlag(gencommandUpgradeCmd)
 
 	gencommandUpgradeCmd.Flags().BoolVar(&gencommandOfflineMode, "offline-mode", false, "Generate schematic ID without doing POST request to image-factory")
+	gencommandUpgradeCmd.Flags().BoolVar(&gencommandNoSchematicCache, "no-schematic-cache", false, "Always do POST request to image-factory instead of using cached schematic ID")
+	gencommandUpgradeCmd.Flags().BoolVar(&gencommandRefreshSchematicCache, "refresh-schematic-cache", false, "Refresh cached schematic ID by doing POST request to image-factory")
 }
@@ -3,9 +3,12 @@ package cmd
 import (
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"log/slog"
 	"os"
+	"runtime"
+	"strings"
 	"time"
 
 	"github.com/siderolabs/talos/pkg/machinery/constants"
@@ -13,19 +16,36 @@ import (
 
 	"github.com/budimanjojo/talhelper/v3/pkg/config"
 	"github.com/budimanjojo/talhelper/v3/pkg/generate"
+	"github.com/budimanjojo/talhelper/v3/pkg/talos"
 )
 
 var (
-	genconfigOutDir              string
-	genconfigCfgFile             string
-	genconfigTalosMode           string
-	genconfigNoGitignore         bool
-	genconfigEnvFile             []string
-	genconfigSecretFile          []string
-	genconfigDryRun              bool
-	genconfigOfflineMode         bool
-	genconfigDisableNodesSection bool
-	genconfigCrtTTL              time.Duration
+	genconfigOutDir                string
+	genconfigCfgFile               string
+	genconfigCluster               string
+	genconfigTalosMode             string
+	genconfigNoGitignore           bool
+	genconfigEnvFile               []string
+	genconfigSecretFile            []string
+	genconfigDryRun                bool
+	genconfigOfflineMode           bool
+	genconfigDisableNodesSection   bool
+	genconfigCrtTTL                time.Duration
+	genconfigParallelism           int
+	genconfigNoSchematicCache      bool
+	genconfigRefreshSchematicCache bool
+	genconfigDiffMode              string
+	genconfigExitCode              bool
+	genconfigShowSecrets           bool
+	genconfigSink                  string
+	genconfigArchive               string
+	genconfigEncrypt               bool
+	genconfigNode                  []string
+	genconfigRole                  string
+	genconfigSelector              []string
+	genconfigFormat                string
+	genconfigIgnoreKind            []string
+	genconfigPolicy                []string
 )
 
 var genconfigCmd = &cobra.Command{
@@ -33,7 +53,22 @@ var genconfigCmd = &cobra.Command{
 	Short: "Generate Talos cluster config YAML files",
 	Args:  cobra.NoArgs,
 	Run: func(cmd *cobra.Command, args []string) {
-		cfg, err := config.LoadAndValidateFromFile(genconfigCfgFile, genconfigEnvFile, true)
+		policy, err := config.LoadPolicyFromFiles(genconfigPolicy)
+		if err != nil {
+			log.Fatalf("failed to load policy: %s", err)
+		}
+
+		if err := config.CheckIgnore(genconfigIgnoreKind, policy); err != nil {
+			log.Fatalf("failed to parse --ignore-kind: %s", err)
+		}
+
+		reporter := &config.Reporter{
+			Format:    genconfigFormat,
+			Output:    os.Stderr,
+			Ignore:    genconfigIgnoreKind,
+			ShowWarns: true,
+		}
+		cfg, err := config.LoadAndReportClusterFromFile(genconfigCfgFile, genconfigCluster, genconfigEnvFile, policy, reporter)
 		if err != nil {
 			log.Fatalf("failed to parse config file: %s", err)
 		}
@@ -50,13 +85,65 @@ var genconfigCmd = &cobra.Command{
 			}
 		}
 
-		slog.Debug("start generating config file")
-		err = generate.GenerateConfig(cfg, genconfigDryRun, genconfigOutDir, secretFile, genconfigTalosMode, genconfigOfflineMode, genconfigDisableNodesSection, genconfigCrtTTL)
+		talos.SetSchematicCache(genconfigNoSchematicCache, genconfigRefreshSchematicCache)
+
+		selector, err := config.NewNodeSelector(genconfigNode, genconfigRole, genconfigSelector)
 		if err != nil {
+			log.Fatalf("failed to parse node selector: %s", err)
+		}
+
+		// nothing is written on dry run, so the sink isn't created at all to
+		// not touch an existing archive
+		var sink generate.Sink
+		if !genconfigDryRun {
+			sink, err = generate.NewSink(genconfigSink, genconfigOutDir, genconfigArchive, genconfigEncrypt)
+			if err != nil {
+				log.Fatalf("failed to create output sink: %s", err)
+			}
+		}
+
+		// keep stdout clean when the generated files are written into it
+		var messages io.Writer = os.Stdout
+		if genconfigSink == "stdout" || (strings.HasPrefix(genconfigSink, "tar") && genconfigArchive == "-") {
+			messages = os.Stderr
+		}
+
+		slog.Debug("start generating config file")
+		err = generate.GenerateConfig(cfg, generate.ConfigOptions{
+			OutDir:              genconfigOutDir,
+			Sink:                sink,
+			Selector:            selector,
+			Messages:            messages,
+			SecretFile:          secretFile,
+			Mode:                genconfigTalosMode,
+			OfflineMode:         genconfigOfflineMode,
+			DisableNodesSection: genconfigDisableNodesSection,
+			CrtTTL:              genconfigCrtTTL,
+			Parallelism:         genconfigParallelism,
+			DryRun:              genconfigDryRun,
+			DiffMode:            genconfigDiffMode,
+			ShowSecrets:         genconfigShowSecrets,
+			DiffExitCode:        genconfigExitCode,
+			Policy:              policy,
+			Reporter:            reporter,
+		})
+		if errors.Is(err, generate.ErrConfigChanged) {
+			os.Exit(2)
+		} else if err != nil {
+			if sink != nil {
+				_ = sink.Abort()
+			}
 			log.Fatalf("failed to generate talos config: %s", err)
 		}
 
-		if !genconfigNoGitignore && !genconfigDryRun {
+		if sink != nil {
+			if err := sink.Close(); err != nil {
+				log.Fatalf("failed to write generated files: %s", err)
+			}
+		}
+
+		// only plain files written into out-dir need to be ignored by git
+		if !genconfigNoGitignore && !genconfigDryRun && !genconfigEncrypt && (genconfigSink == "" || genconfigSink == "dir") {
 			err = cfg.GenerateGitignore(genconfigOutDir)
 			if err != nil {
 				log.Fatalf("failed to generate gitignore file: %s", err)
@@ -70,6 +157,7 @@ func init() {
 
 	genconfigCmd.Flags().StringVarP(&genconfigOutDir, "out-dir", "o", "./clusterconfig", "Directory where to dump the generated files")
 	genconfigCmd.Flags().StringVarP(&genconfigCfgFile, "config-file", "c", "talconfig.yaml", "File containing configurations for talhelper")
+	genconfigCmd.Flags().StringVar(&genconfigCluster, "cluster", "", "Name of the cluster to generate config for when config file has multiple clusters")
 	genconfigCmd.Flags().StringSliceVarP(&genconfigEnvFile, "env-file", "e", []string{"talenv.yaml", "talenv.sops.yaml", "talenv.yml", "talenv.sops.yml"}, "List of files containing env variables for config file")
 	genconfigCmd.Flags().StringSliceVarP(&genconfigSecretFile, "secret-file", "s", []string{"talsecret.yaml", "talsecret.sops.yaml", "talsecret.yml", "talsecret.sops.yml"}, "List of files containing secrets for the cluster")
 	genconfigCmd.Flags().StringVarP(&genconfigTalosMode, "talos-mode", "m", "metal", "Talos runtime mode to validate generated config")
@@ -78,4 +166,19 @@ func init() {
 	genconfigCmd.Flags().BoolVar(&genconfigOfflineMode, "offline-mode", false, "Generate schematic ID without doing POST request to image-factory")
 	genconfigCmd.Flags().BoolVar(&genconfigDisableNodesSection, "disable-nodes-section", false, "Disable filling the taloscontrol nodes section")
 	genconfigCmd.Flags().DurationVar(&genconfigCrtTTL, "crt-ttl", constants.TalosAPIDefaultCertificateValidityDuration, "certificate TTL")
+	genconfigCmd.Flags().BoolVar(&genconfigNoSchematicCache, "no-schematic-cache", false, "Always do POST request to image-factory instead of using cached schematic ID")
+	genconfigCmd.Flags().BoolVar(&genconfigRefreshSchematicCache, "refresh-schematic-cache", false, "Refresh cached schematic ID by doing POST request to image-factory")
+	genconfigCmd.Flags().StringVar(&genconfigDiffMode, "diff-mode", "text", "Diff mode used by --dry-run ("+strings.Join(generate.DiffModes, ", ")+")")
+	genconfigCmd.Flags().BoolVar(&genconfigShowSecrets, "show-secrets", false, "Show secret values in --dry-run diff instead of their hashes")
+	genconfigCmd.Flags().BoolVar(&genconfigExitCode, "exit-code", false, "Exit with code 2 if --dry-run found changes")
+	genconfigCmd.Flags().StringVar(&genconfigSink, "sink", "dir", "Where to write the generated files ("+strings.Join(generate.Sinks, ", ")+")")
+	genconfigCmd.Flags().StringVar(&genconfigArchive, "archive", "", "Archive file path for tar and tar.gz sinks, \"-\" for stdout (defaults to out-dir with .tar or .tar.gz extension)")
+	genconfigCmd.Flags().BoolVar(&genconfigEncrypt, "encrypt", false, "Encrypt the generated files with SOPS using the creation rules in .sops.yaml")
+	genconfigCmd.Flags().StringSliceVar(&genconfigNode, "node", []string{}, "Only generate config for nodes with these hostnames or IP addresses")
+	genconfigCmd.Flags().StringVar(&genconfigRole, "role", "", "Only generate config for nodes with this role (controlplane, worker)")
+	genconfigCmd.Flags().StringSliceVarP(&genconfigSelector, "selector", "l", []string{}, "Only generate config for nodes with these nodeLabels (e.g: zone=a)")
+	genconfigCmd.Flags().StringVar(&genconfigFormat, "format", "text", "Output format of config file validation issues written to stderr ("+strings.Join(config.ReportFormats, ", ")+")")
+	genconfigCmd.Flags().StringSliceVar(&genconfigIgnoreKind, "ignore-kind", []string{}, "List of warning rule IDs or kinds to ignore (e.g: TH005,EvenControlPlaneNodes)")
+	genconfigCmd.Flags().StringSliceVar(&genconfigPolicy, "policy", []string{}, "List of policy files containing custom validation rules")
+	genconfigCmd.Flags().IntVar(&genconfigParallelism, "parallelism", runtime.NumCPU(), "Maximum number of nodes to generate config for at the same time")
 }
@@ -18,6 +18,8 @@ var (
 	genurlSecureboot  bool
 	genurlTalosMode   string
 	genurlCustFile    string
+	genurlNoCache     bool
+	genurlRefresh     bool
 )
 
 var genurlCmd = &cobra.Command{
@@ -36,6 +38,8 @@ func init() {
 	genurlCmd.PersistentFlags().StringSliceVarP(&genurlExtensions, "extension", "e", []string{}, "Official extension image to be included in the image (ignored when talconfig.yaml is found)")
 	genurlCmd.PersistentFlags().StringSliceVarP(&genurlKernelArgs, "kernel-arg", "k", []string{}, "Kernel arguments to be passed to the image kernel (ignored when talconfig.yaml is found)")
 	genurlCmd.PersistentFlags().BoolVar(&genurlOfflineMode, "offline-mode", false, "Generate schematic ID without doing POST request to image-factory")
+	genurlCmd.PersistentFlags().BoolVar(&genurlNoCache, "no-schematic-cache", false, "Always do POST request to image-factory instead of using cached schematic ID")
+	genurlCmd.PersistentFlags().BoolVar(&genurlRefresh, "refresh-schematic-cache", false, "Refresh cached schematic ID by doing POST request to image-factory")
 	genurlCmd.PersistentFlags().BoolVar(&genurlSecureboot, "secure-boot", false, "Whether to generate Secure Boot enabled URL")
 	genurlCmd.PersistentFlags().StringVarP(&genurlTalosMode, "talos-mode", "m", "metal", "Talos runtime mode to generate URL")
 	genurlCmd.PersistentFlags().StringVar(&genurlCustFile, "customization-file", "", "File containing customization spec, this will ignore talconfig.yaml file")
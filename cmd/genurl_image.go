@@ -31,6 +31,8 @@ var genurlImageCmd = &cobra.Command{
 			log.Fatalf("invalid boot-method, should be one of iso, disk-image, pxe")
 		}
 
+		talos.SetSchematicCache(genurlNoCache, genurlRefresh)
+
 		if genurlCustFile != "" {
 			slog.Debug("generating from provided customization file", slog.Any("customization-file", genurlCustFile))
 
@@ -19,6 +19,8 @@ var genurlInstallerCmd = &cobra.Command{
 	Use:   "installer",
 	Short: "Generate URL for Talos installer image",
 	Run: func(cmd *cobra.Command, args []string) {
+		talos.SetSchematicCache(genurlNoCache, genurlRefresh)
+
 		if genurlCustFile != "" {
 			slog.Debug("generating from provided customization file", slog.Any("customization-file", genurlCustFile))
 
@@ -12,8 +12,9 @@ func MakeNodeCompletion(cmd *cobra.Command) error {
 		var nodes []string
 		thCfg, _ := cmd.Flags().GetString("config-file")
 		thEnvFiles, _ := cmd.Flags().GetStringSlice("env-file")
+		thCluster, _ := cmd.Flags().GetString("cluster")
 
-		cfg, err := config.LoadAndValidateFromFile(thCfg, thEnvFiles, false)
+		cfg, err := config.LoadAndValidateClusterFromFile(thCfg, thCluster, thEnvFiles, false)
 		if err != nil {
 			return nil, cobra.ShellCompDirectiveNoFileComp
 		}
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"log"
+
+	"github.com/spf13/cobra"
+
+	"github.com/budimanjojo/talhelper/v3/pkg/generate"
+)
+
+var (
+	importOutDir      string
+	importTalosMode   string
+	importForce       bool
+	importTalosconfig string
+)
+
+var importCmd = &cobra.Command{
+	Use:   "import <machineconfig>...",
+	Short: "Generate talhelper config from existing Talos machine configs.",
+	Long: `Generate talhelper config from existing Talos machine configs.
+It writes talconfig.yaml with the cluster and node configurations found in the
+machine configs and talsecret.yaml with the cluster secrets into out-dir.
+At least one of the machine configs must be a controlplane. Everything that
+can't be mapped into talconfig.yaml is written as patches in out-dir/patches.
+The IP address of nodes without static IP address is taken from talosconfig.
+Nothing is written if the imported talconfig.yaml is not valid.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		err := generate.ImportConfig(args, generate.ImportOptions{
+			OutDir:      importOutDir,
+			Mode:        importTalosMode,
+			Force:       importForce,
+			Talosconfig: importTalosconfig,
+		})
+		if err != nil {
+			log.Fatalf("failed to import machine configs: %s", err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(importCmd)
+
+	importCmd.Flags().StringVarP(&importOutDir, "out-dir", "o", ".", "Directory where to write talconfig.yaml, talsecret.yaml and patches")
+	importCmd.Flags().StringVarP(&importTalosMode, "talos-mode", "m", "metal", "Talos runtime mode to validate generated config")
+	importCmd.Flags().BoolVar(&importForce, "force", false, "Overwrite existing files in out-dir")
+	importCmd.Flags().StringVar(&importTalosconfig, "talosconfig", "", "Talosconfig of the cluster to find the IP address of nodes without static IP address (default is talosconfig next to the first machine config)")
+}
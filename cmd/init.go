@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"log"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/budimanjojo/talhelper/v3/pkg/generate"
+)
+
+var (
+	initOutDir      string
+	initAnswersFile string
+	initForce       bool
+)
+
+var initCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Create talconfig.yaml and cluster secrets interactively.",
+	Long: `Create talconfig.yaml and the cluster secrets by answering questions about
+the cluster. The secrets are written into talsecret.sops.yaml encrypted with sops
+if there's a .sops.yaml for it, which can also be created by giving an age public
+key. Otherwise they're written into talsecret.yaml which is added into .gitignore.
+
+The questions can be answered from a YAML file with "--answers-file" instead:
+
+  clusterName: mycluster
+  endpoint: https://192.168.200.10:6443
+  talosVersion: v1.13.9
+  kubernetesVersion: v1.36.2
+  cni: flannel
+  extensions:
+    - siderolabs/intel-ucode
+  nodes:
+    - hostname: master1
+      ipAddress: 192.168.200.11
+      controlPlane: true
+      installDisk: /dev/sda
+  ageRecipient: age1...`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		var (
+			answers *generate.InitAnswers
+			err     error
+		)
+		if initAnswersFile != "" {
+			answers, err = generate.LoadInitAnswers(initAnswersFile)
+		} else {
+			answers, err = generate.PromptInitAnswers(os.Stdin, os.Stderr)
+		}
+		if err != nil {
+			log.Fatalf("failed to get answers: %s", err)
+		}
+
+		if err := generate.InitConfig(answers, generate.InitOptions{OutDir: initOutDir, Force: initForce}); err != nil {
+			log.Fatalf("failed to create config files: %s", err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(initCmd)
+
+	initCmd.Flags().StringVarP(&initOutDir, "out-dir", "o", ".", "Directory to create the files in")
+	initCmd.Flags().StringVarP(&initAnswersFile, "answers-file", "a", "", "YAML file containing the answers instead of asking them")
+	initCmd.Flags().BoolVar(&initForce, "force", false, "Overwrite the files that already exist")
+}
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"github.com/budimanjojo/talhelper/v3/pkg/config"
+)
+
+var (
+	migrateCfgFile string
+	migrateDryRun  bool
+)
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Rewrite deprecated fields in talhelper config file.",
+	Long: `Rewrite deprecated fields in talhelper config file into their replacements.
+The config file is rewritten in place with comments kept, and the list of
+changes is printed. Fields that can't be migrated automatically are printed
+as warnings and left untouched.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		source, err := config.FromFile(migrateCfgFile)
+		if err != nil {
+			log.Fatalf("failed to read config file: %s", err)
+		}
+
+		result, changes, err := config.Migrate(source)
+		if err != nil {
+			log.Fatalf("failed to migrate config file: %s", err)
+		}
+
+		if len(changes) == 0 {
+			fmt.Fprintf(os.Stderr, "nothing to migrate in %s\n", migrateCfgFile)
+			return
+		}
+
+		for _, c := range changes {
+			if c.Manual {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", color.YellowString("WARNING"), c)
+			} else {
+				fmt.Fprintf(os.Stderr, "%s %s\n", color.GreenString("migrated"), c)
+			}
+		}
+
+		if migrateDryRun {
+			fmt.Print(string(result))
+			return
+		}
+
+		info, err := os.Stat(migrateCfgFile)
+		if err != nil {
+			log.Fatalf("failed to stat config file: %s", err)
+		}
+		if err := os.WriteFile(migrateCfgFile, result, info.Mode().Perm()); err != nil {
+			log.Fatalf("failed to write config file: %s", err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(migrateCmd)
+
+	migrateCmd.Flags().StringVarP(&migrateCfgFile, "config-file", "c", "talconfig.yaml", "File containing configurations for talhelper")
+	migrateCmd.Flags().BoolVarP(&migrateDryRun, "dry-run", "n", false, "Print the migrated config file instead of rewriting it")
+}
@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/budimanjojo/talhelper/v3/pkg/config"
+)
+
+var (
+	nodeCfgFile string
+	nodeCluster string
+	nodeEnvFile []string
+)
+
+var nodeCmd = &cobra.Command{
+	Use:   "node",
+	Short: "Add, remove or edit nodes in talhelper config file.",
+	Long: `Add, remove or edit nodes in talhelper config file.
+The config file is validated before it's written and the comments in it
+are kept.`,
+}
+
+func init() {
+	rootCmd.AddCommand(nodeCmd)
+	nodeCmd.PersistentFlags().StringVarP(&nodeCfgFile, "config-file", "c", "talconfig.yaml", "File containing configurations for talhelper")
+	nodeCmd.PersistentFlags().StringVar(&nodeCluster, "cluster", "", "Name of the cluster to edit when config file has multiple clusters")
+	nodeCmd.PersistentFlags().StringSliceVarP(&nodeEnvFile, "env-file", "e", []string{"talenv.yaml", "talenv.sops.yaml", "talenv.yml", "talenv.sops.yml"}, "List of files containing env variables for config file")
+}
+
+// writeNodeConfig validates the edited config file `source` and replaces
+// the config file with it. It returns an error, if any.
+func writeNodeConfig(source []byte) error {
+	info, err := os.Stat(nodeCfgFile)
+	if err != nil {
+		return err
+	}
+
+	// the edited config is validated as the content of the config file so
+	// relative paths, `extends` and the reported positions work the same way
+	if _, err := config.LoadAndReportClusterFromSource(nodeCfgFile, source, nodeCluster, nodeEnvFile, nil, &config.Reporter{Format: config.ReportText, Output: os.Stderr}); err != nil {
+		return fmt.Errorf("%s is not changed: %s", nodeCfgFile, err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(nodeCfgFile), "."+filepath.Base(nodeCfgFile)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(source); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), nodeCfgFile)
+}
@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+
+	"github.com/siderolabs/talos/pkg/machinery/config/types/v1alpha1"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"github.com/budimanjojo/talhelper/v3/pkg/config"
+)
+
+var (
+	nodeAddIPAddress           string
+	nodeAddControlPlane        bool
+	nodeAddInstallDisk         string
+	nodeAddInstallDiskSelector map[string]string
+	nodeAddGroups              []string
+)
+
+var nodeAddCmd = &cobra.Command{
+	Use:   "add <hostname>",
+	Short: "Add a node into talhelper config file.",
+	Long: `Add a node into talhelper config file.
+Other configurations like the schematic can be shared with the node by
+putting it into node groups defined in "nodeGroups" with "--group".`,
+	Example: `  talhelper node add kworker3 --ip 192.168.200.13 --install-disk /dev/sda
+  talhelper node add kmaster2 --ip 192.168.200.12 --controlplane --install-disk-selector size=">= 100GB",type=nvme --group intel`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		node := config.Node{
+			Hostname:     args[0],
+			IPAddress:    nodeAddIPAddress,
+			ControlPlane: nodeAddControlPlane,
+			InstallDisk:  nodeAddInstallDisk,
+			Groups:       nodeAddGroups,
+		}
+
+		if len(nodeAddInstallDiskSelector) > 0 {
+			selector, err := parseInstallDiskSelector(nodeAddInstallDiskSelector)
+			if err != nil {
+				log.Fatalf("failed to parse install disk selector: %s", err)
+			}
+			node.InstallDiskSelector = selector
+		}
+
+		source, err := config.FromFile(nodeCfgFile)
+		if err != nil {
+			log.Fatalf("failed to read config file: %s", err)
+		}
+
+		result, err := config.AddNode(source, nodeCluster, node)
+		if err != nil {
+			log.Fatalf("failed to add node: %s", err)
+		}
+
+		if err := writeNodeConfig(result); err != nil {
+			log.Fatalf("failed to write config file: %s", err)
+		}
+		fmt.Printf("added node %s into %s\n", node.Hostname, nodeCfgFile)
+	},
+}
+
+// parseInstallDiskSelector converts `selector` flag into
+// `v1alpha1.InstallDiskSelector`. It returns an error, if any.
+func parseInstallDiskSelector(selector map[string]string) (*v1alpha1.InstallDiskSelector, error) {
+	b, err := yaml.Marshal(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	var result v1alpha1.InstallDiskSelector
+	decoder := yaml.NewDecoder(bytes.NewReader(b))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func init() {
+	nodeCmd.AddCommand(nodeAddCmd)
+
+	nodeAddCmd.Flags().StringVarP(&nodeAddIPAddress, "ip", "i", "", "IP address of the node")
+	nodeAddCmd.Flags().BoolVar(&nodeAddControlPlane, "controlplane", false, "Whether the node is a controlplane node")
+	nodeAddCmd.Flags().StringVar(&nodeAddInstallDisk, "install-disk", "", "Disk used for installation")
+	nodeAddCmd.Flags().StringToStringVar(&nodeAddInstallDiskSelector, "install-disk-selector", nil, "Look up disk used for installation (e.g. size=\">= 100GB\",type=ssd)")
+	nodeAddCmd.Flags().StringSliceVarP(&nodeAddGroups, "group", "g", nil, "Node groups defined in \"nodeGroups\" to apply to the node")
+	nodeAddCmd.MarkFlagsMutuallyExclusive("install-disk", "install-disk-selector")
+}
@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/spf13/cobra"
+
+	"github.com/budimanjojo/talhelper/v3/pkg/config"
+)
+
+var nodeRemoveCmd = &cobra.Command{
+	Use:   "remove <hostname>",
+	Short: "Remove a node from talhelper config file.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		source, err := config.FromFile(nodeCfgFile)
+		if err != nil {
+			log.Fatalf("failed to read config file: %s", err)
+		}
+
+		result, err := config.RemoveNode(source, nodeCluster, args[0])
+		if err != nil {
+			log.Fatalf("failed to remove node: %s", err)
+		}
+
+		if err := writeNodeConfig(result); err != nil {
+			log.Fatalf("failed to write config file: %s", err)
+		}
+		fmt.Printf("removed node %s from %s\n", args[0], nodeCfgFile)
+	},
+}
+
+func init() {
+	nodeCmd.AddCommand(nodeRemoveCmd)
+}
@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/spf13/cobra"
+
+	"github.com/budimanjojo/talhelper/v3/pkg/config"
+)
+
+var nodeSetCmd = &cobra.Command{
+	Use:   "set <hostname> <field> <value>",
+	Short: "Set a field of a node in talhelper config file.",
+	Long: `Set a field of a node in talhelper config file.
+The field is a path like "installDisk", "nodeLabels.rack" or
+"networkInterfaces[0].dhcp", keys with dots can be written as
+'nodeLabels["topology.kubernetes.io/zone"]'. The value is parsed as YAML,
+so "true" is a boolean and "[a, b]" is a list. Use "null" to remove the field.`,
+	Example: `  talhelper node set kworker1 installDisk /dev/nvme0n1
+  talhelper node set kworker1 'nodeLabels["topology.kubernetes.io/zone"]' a
+  talhelper node set kworker1 groups '[storage, gpu]'
+  talhelper node set kworker1 nodeTaints null`,
+	Args: cobra.ExactArgs(3),
+	Run: func(cmd *cobra.Command, args []string) {
+		source, err := config.FromFile(nodeCfgFile)
+		if err != nil {
+			log.Fatalf("failed to read config file: %s", err)
+		}
+
+		result, err := config.SetNodeField(source, nodeCluster, args[0], args[1], args[2])
+		if err != nil {
+			log.Fatalf("failed to set node field: %s", err)
+		}
+
+		if err := writeNodeConfig(result); err != nil {
+			log.Fatalf("failed to write config file: %s", err)
+		}
+		fmt.Printf("set %s of node %s in %s\n", args[1], args[0], nodeCfgFile)
+	},
+}
+
+func init() {
+	nodeCmd.AddCommand(nodeSetCmd)
+}
@@ -13,7 +13,8 @@ var rootLongHelp = strings.TrimSpace(`
 talhelper is a tool to help you create a Talos cluster.
 
 Workflow:
-  Create talconfig.yaml file defining your nodes information like so:
+  Run "talhelper init" to create talconfig.yaml and the cluster secrets by answering questions,
+  or create talconfig.yaml file defining your nodes information like so:
   ----------------------------------------
   clusterName: mycluster
   talosVersion: v1.0
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"log"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/budimanjojo/talhelper/v3/pkg/config"
+	"github.com/budimanjojo/talhelper/v3/pkg/generate"
+	"github.com/budimanjojo/talhelper/v3/pkg/talos"
+)
+
+var (
+	upgradePlanCfgFile               string
+	upgradePlanCluster               string
+	upgradePlanOutDir                string
+	upgradePlanEnvFile               []string
+	upgradePlanExtraFlags            []string
+	upgradePlanMaxUnavailable        int
+	upgradePlanOutput                string
+	upgradePlanOfflineMode           bool
+	upgradePlanNoSchematicCache      bool
+	upgradePlanRefreshSchematicCache bool
+)
+
+var upgradePlanCmd = &cobra.Command{
+	Use:   "upgrade-plan",
+	Short: "Generate an ordered plan to upgrade Talos on every node.",
+	Long: `Generate an ordered plan to upgrade Talos on every node.
+Controlplane nodes are upgraded one at a time before the worker nodes.
+Worker nodes are upgraded in batches of at most --max-unavailable nodes.
+Nodes are ordered by their "upgradeGroup", in the order each group first
+appears in the config file, and nodes from different groups are never upgraded
+in the same batch.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := config.LoadAndValidateClusterFromFile(upgradePlanCfgFile, upgradePlanCluster, upgradePlanEnvFile, false)
+		if err != nil {
+			log.Fatalf("failed to parse config file: %s", err)
+		}
+
+		talos.SetSchematicCache(upgradePlanNoSchematicCache, upgradePlanRefreshSchematicCache)
+
+		plan, err := generate.BuildUpgradePlan(cfg, upgradePlanOutDir, upgradePlanExtraFlags, upgradePlanOfflineMode, upgradePlanMaxUnavailable)
+		if err != nil {
+			log.Fatalf("failed to generate upgrade plan: %s", err)
+		}
+
+		if err := generate.PrintUpgradePlan(plan, upgradePlanOutput); err != nil {
+			log.Fatalf("failed to print upgrade plan: %s", err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(upgradePlanCmd)
+
+	upgradePlanCmd.Flags().StringVarP(&upgradePlanCfgFile, "config-file", "c", "talconfig.yaml", "File containing configurations for talhelper")
+	upgradePlanCmd.Flags().StringVar(&upgradePlanCluster, "cluster", "", "Name of the cluster to plan the upgrade for when config file has multiple clusters")
+	upgradePlanCmd.Flags().StringVarP(&upgradePlanOutDir, "out-dir", "o", "./clusterconfig", "Directory that contains the generated talosconfig.")
+	upgradePlanCmd.Flags().StringSliceVarP(&upgradePlanEnvFile, "env-file", "e", []string{"talenv.yaml", "talenv.sops.yaml", "talenv.yml", "talenv.sops.yml"}, "List of files containing env variables for config file")
+	upgradePlanCmd.Flags().StringSliceVar(&upgradePlanExtraFlags, "extra-flags", []string{}, "List of additional flags that will be injected into the generated commands.")
+	upgradePlanCmd.Flags().IntVar(&upgradePlanMaxUnavailable, "max-unavailable", 1, "Maximum number of worker nodes to upgrade at the same time")
+	upgradePlanCmd.Flags().StringVar(&upgradePlanOutput, "output", "script", "Output format of the plan ("+strings.Join(generate.UpgradePlanFormats, ", ")+")")
+	upgradePlanCmd.Flags().BoolVar(&upgradePlanOfflineMode, "offline-mode", false, "Generate schematic ID without doing POST request to image-factory")
+	upgradePlanCmd.Flags().BoolVar(&upgradePlanNoSchematicCache, "no-schematic-cache", false, "Always do POST request to image-factory instead of using cached schematic ID")
+	upgradePlanCmd.Flags().BoolVar(&upgradePlanRefreshSchematicCache, "refresh-schematic-cache", false, "Refresh cached schematic ID by doing POST request to image-factory")
+}
@@ -4,16 +4,21 @@ import (
 	"fmt"
 	"log"
 	"log/slog"
+	"os"
+	"strings"
 
 	"github.com/budimanjojo/talhelper/v3/pkg/config"
 	"github.com/budimanjojo/talhelper/v3/pkg/substitute"
-	"github.com/fatih/color"
 	"github.com/spf13/cobra"
 )
 
 var (
 	validateTHEnvFile      []string
+	validateTHCluster      string
 	validateTHNoSubstitute bool
+	validateTHFormat       string
+	validateTHIgnoreKind   []string
+	validateTHPolicy       []string
 )
 
 var validateTHCmd = &cobra.Command{
@@ -38,38 +43,33 @@ var validateTHCmd = &cobra.Command{
 			if err := substitute.LoadEnvFromFiles(validateTHEnvFile); err != nil {
 				log.Fatalf("failed to load env file: %s", err)
 			}
-			cfgByte, err = substitute.SubstituteEnvFromByte(cfgByte)
-			if err != nil {
-				log.Fatalf("failed trying to substitute env: %s", err)
-			}
 		}
 
-		errs, warns, err := config.ValidateFromByte(cfgByte)
+		policy, err := config.LoadPolicyFromFiles(validateTHPolicy)
+		if err != nil {
+			log.Fatalf("failed to load policy: %s", err)
+		}
+
+		if err := config.CheckIgnore(validateTHIgnoreKind, policy); err != nil {
+			log.Fatalf("failed to parse --ignore-kind: %s", err)
+		}
+
+		errs, warns, err := config.ValidateFromSource(cfg, cfgByte, validateTHCluster, !validateTHNoSubstitute, policy)
 		if err != nil {
 			log.Fatalf("failed to validate talhelper config file: %s", err)
 		}
 
-		if len(errs) > 0 || len(warns) > 0 {
-			color.Red("There are issues with your talhelper config file:")
-			grouped := make(map[string][]string)
-			for _, v := range errs {
-				grouped[v.Field] = append(grouped[v.Field], v.Message.Error())
-			}
-			for _, v := range warns {
-				grouped[v.Field] = append(grouped[v.Field], v.Message)
-			}
-			for field, list := range grouped {
-				color.Yellow("field: %q\n", field)
-				for _, l := range list {
-					fmt.Println(l)
-				}
-			}
-			if len(errs) > 0 {
-				log.Fatal()
-			}
-		} else {
+		warns = warns.Ignore(validateTHIgnoreKind)
+		if len(errs) == 0 && len(warns.Active()) == 0 && validateTHFormat == config.ReportText {
 			fmt.Println("Your talhelper config file is looking great!")
 		}
+
+		if err := config.WriteReport(os.Stdout, validateTHFormat, config.NewFindings(errs, warns)); err != nil {
+			log.Fatalf("failed to write validation report: %s", err)
+		}
+		if len(errs) > 0 {
+			log.Fatal()
+		}
 	},
 }
 
@@ -77,5 +77,9 @@ func init() {
 	validateCmd.AddCommand(validateTHCmd)
 
 	validateTHCmd.Flags().StringSliceVarP(&validateTHEnvFile, "env-file", "e", []string{"talenv.yaml", "talenv.sops.yaml", "talenv.yml", "talenv.sops.yml"}, "List of files containing env variables for config file")
+	validateTHCmd.Flags().StringVar(&validateTHCluster, "cluster", "", "Name of the cluster to validate when config file has multiple clusters")
 	validateTHCmd.Flags().BoolVar(&validateTHNoSubstitute, "no-substitute", false, "Whether to do envsubst on before validation")
+	validateTHCmd.Flags().StringVar(&validateTHFormat, "format", "text", "Output format of the validation result ("+strings.Join(config.ReportFormats, ", ")+")")
+	validateTHCmd.Flags().StringSliceVar(&validateTHIgnoreKind, "ignore-kind", []string{}, "List of warning rule IDs or kinds to ignore (e.g: TH005,EvenControlPlaneNodes)")
+	validateTHCmd.Flags().StringSliceVar(&validateTHPolicy, "policy", []string{}, "List of policy files containing custom validation rules, only the rules for config and node are evaluated")
 }
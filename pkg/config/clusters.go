@@ -0,0 +1,181 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/budimanjojo/talhelper/v3/pkg/substitute"
+	"github.com/budimanjojo/talhelper/v3/pkg/yamledit"
+	"gopkg.in/yaml.v3"
+)
+
+// loadConfigFile takes a file path, do envsubst if `substituteEnv` is true and
+// relative paths substitution and convert the contents into Talhelper config. If the config `extends` another
+// file, the other file is loaded the same way and used as the base of the config.
+// `visited` is the list of files already loaded, used to detect circular `extends`.
+// It returns an error, if any.
+func loadConfigFile(filePath string, substituteEnv bool, visited []string) (*TalhelperConfig, error) {
+	slog.Debug(fmt.Sprintf("reading %s", filePath))
+	cfgByte, err := FromFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %s", err)
+	}
+
+	return loadConfigSource(filePath, cfgByte, substituteEnv, visited)
+}
+
+// loadConfigSource is the same as `loadConfigFile` but the content of
+// `filePath` is `source`. envsubst is only done if `substituteEnv` is true.
+// It returns an error, if any.
+func loadConfigSource(filePath string, source []byte, substituteEnv bool, visited []string) (*TalhelperConfig, error) {
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if slices.Contains(visited, absPath) {
+		return nil, fmt.Errorf("circular extends found: %s", strings.Join(append(visited, absPath), " -> "))
+	}
+	visited = append(visited, absPath)
+
+	doc, err := yamledit.Parse(source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal config file: %s", err)
+	}
+	root := doc.Root()
+	if root == nil {
+		root = yamledit.NewMapping()
+	}
+
+	// the substitutions are done on the parsed nodes so their positions still
+	// point to the original file
+	if substituteEnv {
+		slog.Debug("substituting config file with environment variable")
+		if err := substitute.SubstituteEnvFromNode(root); err != nil {
+			return nil, fmt.Errorf("failed to substitute env: %s", err)
+		}
+	}
+
+	slog.Debug("substituting relative paths with absolute paths")
+	if err := substitute.SubstituteRelativePathsFromNode(filePath, root); err != nil {
+		return nil, fmt.Errorf("failed to evaluate relative paths: %s", err)
+	}
+
+	cfg := &TalhelperConfig{}
+	if err := root.Decode(cfg); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal config file: %s", err)
+	}
+	cfg.source = newConfigSource(filePath, root)
+
+	if cfg.Extends == "" {
+		return cfg, nil
+	}
+
+	basePath := cfg.Extends
+	if !filepath.IsAbs(basePath) {
+		basePath = filepath.Join(filepath.Dir(filePath), basePath)
+	}
+
+	slog.Debug(fmt.Sprintf("%s extends %s", filePath, basePath))
+	base, err := loadConfigFile(basePath, substituteEnv, visited)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load %s extended by %s: %s", basePath, filePath, err)
+	}
+
+	return mergeConfigs(*base, *cfg, root), nil
+}
+
+// SelectCluster returns the config of cluster `name` defined in `clusters` of
+// `c`. Every cluster in `clusters` is merged on top of the configurations defined
+// in `c`. If `c` doesn't have `clusters`, `c` itself is returned. If `name` is
+// empty, `c` must have only one cluster defined. It returns an error, if any.
+func (c *TalhelperConfig) SelectCluster(name string) (*TalhelperConfig, error) {
+	if len(c.Clusters) == 0 {
+		if name != "" && name != c.ClusterName {
+			return nil, fmt.Errorf("cluster %q not found in config file", name)
+		}
+		return c, nil
+	}
+
+	if name == "" {
+		if len(c.Clusters) > 1 {
+			return nil, fmt.Errorf("multiple clusters found in config file, please select one of: %s", strings.Join(c.ClusterNames(), ", "))
+		}
+		name = c.Clusters[0].ClusterName
+	}
+
+	for _, cluster := range c.Clusters {
+		if cluster.ClusterName != name {
+			continue
+		}
+		if cluster.Extends != "" || len(cluster.Clusters) > 0 {
+			return nil, fmt.Errorf("cluster %q: `extends` and `clusters` are not supported inside `clusters`", name)
+		}
+
+		base := *c
+		base.Clusters = nil
+		result := mergeConfigs(base, cluster, c.source.clusterNode(name))
+		result.source = c.source.selectCluster(name)
+		return result, nil
+	}
+
+	return nil, fmt.Errorf("cluster %q not found in config file, should be one of: %s", name, strings.Join(c.ClusterNames(), ", "))
+}
+
+// ClusterNames returns the name of every cluster defined in `clusters` of `c`.
+func (c *TalhelperConfig) ClusterNames() []string {
+	var result []string
+	for _, cluster := range c.Clusters {
+		result = append(result, cluster.ClusterName)
+	}
+	return result
+}
+
+// mergeConfigs returns `overlay` merged on top of `base`. Fields defined in
+// `overlay` override the ones in `base`, except for `patches` which are appended
+// to `base` patches and `controlPlane`, `worker` and `nodeGroups` which are merged
+// the same way node group configurations are merged into node configurations.
+// `overlayNode` is the YAML mapping `overlay` is decoded from, it's used to know
+// which fields are defined in `overlay` even if they're set to false or empty.
+// If it's nil, only the non-zero fields of `overlay` are defined.
+func mergeConfigs(base, overlay TalhelperConfig, overlayNode *yaml.Node) *TalhelperConfig {
+	overlay.Patches = slices.Concat(base.Patches, overlay.Patches)
+	strategy := newMergeStrategy(nil)
+	fields := newYamlFields(overlayNode)
+	overlay.ControlPlane = mergeNodeConfigs(overlay.ControlPlane, base.ControlPlane, strategy, fields.field("controlPlane"))
+	overlay.Worker = mergeNodeConfigs(overlay.Worker, base.Worker, strategy, fields.field("worker"))
+	overlay.Extends = ""
+
+	if len(base.NodeGroups) > 0 {
+		groups := maps.Clone(base.NodeGroups)
+		for name, cfg := range overlay.NodeGroups {
+			groups[name] = mergeNodeConfigs(cfg, groups[name], strategy, fields.field("nodeGroups").field(name))
+		}
+		overlay.NodeGroups = groups
+	}
+
+	baseValue := reflect.ValueOf(base)
+	overlayValue := reflect.ValueOf(overlay)
+
+	result := reflect.New(overlayValue.Type()).Elem()
+
+	for i := range overlayValue.NumField() {
+		// unexported fields can't be set with reflect
+		if !overlayValue.Type().Field(i).IsExported() {
+			continue
+		}
+		if fields.isSet(overlayValue.Field(i), yamlFieldName(overlayValue.Type().Field(i))) {
+			result.Field(i).Set(overlayValue.Field(i))
+		} else {
+			result.Field(i).Set(baseValue.Field(i))
+		}
+	}
+
+	cfg := result.Interface().(TalhelperConfig)
+	cfg.source = overlay.source.merge(base.source)
+	return &cfg
+}
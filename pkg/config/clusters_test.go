@@ -0,0 +1,110 @@
+package config
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadConfigFileExtends(t *testing.T) {
+	dir, err := filepath.Abs("testdata/clusters")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := loadConfigFile("testdata/clusters/overlay.yaml", true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.ClusterName != "overlay-cluster" {
+		t.Errorf("got clusterName %q, want %q", cfg.ClusterName, "overlay-cluster")
+	}
+	if cfg.KubernetesVersion != "v1.27.0" {
+		t.Errorf("got kubernetesVersion %q, want %q", cfg.KubernetesVersion, "v1.27.0")
+	}
+	if cfg.Extends != "" {
+		t.Errorf("expected extends to be resolved, got %q", cfg.Extends)
+	}
+
+	expectedPatches := []string{"@" + dir + "/base-patch.yaml", "@" + dir + "/overlay-patch.yaml"}
+	if !reflect.DeepEqual(cfg.Patches, expectedPatches) {
+		t.Errorf("got patches %v, want %v", cfg.Patches, expectedPatches)
+	}
+
+	expectedCertSANs := []string{"overlay.example.com", "base.example.com"}
+	if !reflect.DeepEqual(cfg.ControlPlane.CertSANs, expectedCertSANs) {
+		t.Errorf("got controlPlane certSANs %v, want %v", cfg.ControlPlane.CertSANs, expectedCertSANs)
+	}
+	if !cfg.ControlPlane.DisableSearchDomain {
+		t.Error("expected controlPlane disableSearchDomain from base to be kept")
+	}
+	if cfg.AllowSchedulingOnControlPlanes {
+		t.Error("expected allowSchedulingOnControlPlanes to be overridden to false by overlay")
+	}
+	if len(cfg.ControlPlane.Nameservers) != 0 {
+		t.Errorf("expected controlPlane nameservers to be overridden to empty by overlay, got %v", cfg.ControlPlane.Nameservers)
+	}
+
+	if len(cfg.Nodes) != 1 || cfg.Nodes[0].Hostname != "overlay-node" {
+		t.Errorf("expected nodes to be overridden by overlay, got %v", cfg.Nodes)
+	}
+
+	if _, err := loadConfigFile("testdata/clusters/circular.yaml", true, nil); err == nil {
+		t.Error("expected error for circular extends, got nil")
+	}
+}
+
+func TestLoadAndValidateClusterFromFile(t *testing.T) {
+	dir, err := filepath.Abs("testdata/clusters")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadAndValidateClusterFromFile("testdata/clusters/multi.yaml", "prod", nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.ClusterName != "prod" || cfg.Endpoint != "https://192.168.200.10:6443" {
+		t.Errorf("got cluster %q with endpoint %q, want prod", cfg.ClusterName, cfg.Endpoint)
+	}
+	if cfg.KubernetesVersion != "v1.28.0" || cfg.TalosVersion != "v1.5.4" {
+		t.Errorf("got kubernetesVersion %q and talosVersion %q, want v1.28.0 and v1.5.4", cfg.KubernetesVersion, cfg.TalosVersion)
+	}
+	if len(cfg.Clusters) != 0 {
+		t.Errorf("expected clusters to be removed from selected cluster, got %d", len(cfg.Clusters))
+	}
+	if cfg.AllowSchedulingOnControlPlanes {
+		t.Error("expected allowSchedulingOnControlPlanes to be overridden to false by prod")
+	}
+
+	expectedPatches := []string{"@" + dir + "/shared-patch.yaml", "@" + dir + "/prod-patch.yaml"}
+	if !reflect.DeepEqual(cfg.Patches, expectedPatches) {
+		t.Errorf("got patches %v, want %v", cfg.Patches, expectedPatches)
+	}
+
+	expectedNameservers := []string{"8.8.8.8"}
+	if !reflect.DeepEqual(cfg.Nodes[0].Nameservers, expectedNameservers) {
+		t.Errorf("got nameservers %v, want %v", cfg.Nodes[0].Nameservers, expectedNameservers)
+	}
+
+	cfg, err = LoadAndValidateClusterFromFile("testdata/clusters/multi.yaml", "staging", nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedNameservers = []string{"1.1.1.1"}
+	if !reflect.DeepEqual(cfg.Nodes[0].Nameservers, expectedNameservers) {
+		t.Errorf("got nameservers %v, want %v", cfg.Nodes[0].Nameservers, expectedNameservers)
+	}
+	if !cfg.AllowSchedulingOnControlPlanes {
+		t.Error("expected allowSchedulingOnControlPlanes to be kept true for staging")
+	}
+
+	if _, err := LoadAndValidateClusterFromFile("testdata/clusters/multi.yaml", "", nil, false); err == nil {
+		t.Error("expected error when no cluster is selected, got nil")
+	}
+	if _, err := LoadAndValidateClusterFromFile("testdata/clusters/multi.yaml", "dev", nil, false); err == nil {
+		t.Error("expected error for unknown cluster, got nil")
+	}
+}
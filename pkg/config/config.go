@@ -25,24 +25,55 @@ type TalhelperConfig struct {
 	CNIConfig                      *v1alpha1.CNIConfig    `yaml:"cniConfig,omitempty" jsonschema:"description=The CNI to be used for the cluster's network"`
 	Patches                        []string               `yaml:"patches,omitempty" jsonschema:"description=Patches to be applied to all nodes"`
 	Nodes                          []Node                 `yaml:"nodes" jsonschema:"required,description=List of configurations for Node"`
+	NodePools                      []NodePool             `yaml:"nodePools,omitempty" jsonschema:"description=List of node pools, each of them is expanded into nodes with the same configurations"`
 	ImageFactory                   ImageFactory           `yaml:"imageFactory,omitempty" jsonschema:"Configuration for image factory"`
 	ControlPlane                   NodeConfigs            `yaml:"controlPlane,omitempty" jsonschema:"description=Configurations targetted for all controlplane nodes"`
 	Worker                         NodeConfigs            `yaml:"worker,omitempty" jsonschema:"description=Configurations targetted for all worker nodes"`
+	NodeGroups                     map[string]NodeConfigs `yaml:"nodeGroups,omitempty" jsonschema:"description=Named configurations targetted for nodes that have the name in their groups"`
+	Extends                        string                 `yaml:"extends,omitempty" jsonschema:"example=../base/talconfig.yaml,description=Path to another talhelper config file this config is based on"`
+	Clusters                       []TalhelperConfig      `yaml:"clusters,omitempty" jsonschema:"description=List of clusters sharing the configurations defined here"`
+	Validation                     Validation             `yaml:"validate,omitempty" jsonschema:"description=Configurations for the validation of this config file"`
+
+	// source is where the config is loaded from, it's nil if the config is
+	// not loaded from a file
+	source *configSource
 }
 
 type Node struct {
 	Hostname                string                        `yaml:"hostname" jsonschema:"required,description=Hostname of the node"`
 	IPAddress               string                        `yaml:"ipAddress,omitempty" jsonschema:"required,example=192.168.200.11,description=IP address where the node can be reached, can also be a comma separated IP addresses"`
 	ControlPlane            bool                          `yaml:"controlPlane" jsonschema:"description=Whether the node is a controlplane"`
+	UpgradeGroup            string                        `yaml:"upgradeGroup,omitempty" jsonschema:"description=Name of the group this node is upgraded with by \"upgrade-plan\""`
+	Groups                  []string                      `yaml:"groups,omitempty" jsonschema:"description=List of node groups defined in \"nodeGroups\" to apply to this node, in order"`
 	InstallDisk             string                        `yaml:"installDisk,omitempty" jsonschema:"oneof_required=installDiskSelector,description=The disk used for installation"`
 	InstallDiskSelector     *v1alpha1.InstallDiskSelector `yaml:"installDiskSelector,omitempty" jsonschema:"oneof_required=installDisk,description=Look up disk used for installation"`
 	IgnoreHostname          bool                          `yaml:"ignoreHostname" jsonschema:"description=Whether to set \"machine.network.hostname\" to the generated config file"`
 	OverridePatches         bool                          `yaml:"overridePatches,omitempty" jsonschema:"description=Whether \"patches\" defined here should override the one defined in node group"`
 	OverrideExtraManifests  bool                          `yaml:"overrideExtraManifests,omitempty" jsonschema:"description=Whether \"extraManifests\" defined here should override the one defined in node group"`
 	OverrideMachineCertSANs bool                          `yaml:"overrideMachineCertSANs,omitempty" jsonschema:"description=Whether \"certSANs\" defined here should override the one defined in node group"`
+	Validation              Validation                    `yaml:"validate,omitempty" jsonschema:"description=Configurations for the validation of this node"`
+	MergeStrategy           map[string]string             `yaml:"mergeStrategy,omitempty" jsonschema:"description=How node configurations defined here are merged with the one defined in node group, map of field name to \"merge\", \"append\" or \"replace\""`
 	NodeConfigs             `yaml:",inline" jsonschema:"description=Node specific configurations that will override node group configurations"`
 }
 
+type NodePool struct {
+	Name                string                        `yaml:"name" jsonschema:"required,description=Name of the node pool"`
+	Count               int                           `yaml:"count" jsonschema:"required,description=Number of nodes in the node pool"`
+	StartIndex          *int                          `yaml:"startIndex,omitempty" jsonschema:"default=1,description=Index of the first node in the node pool"`
+	HostnameTmpl        string                        `yaml:"hostnameTmpl,omitempty" jsonschema:"default={{ .Name }}-{{ .Index }},description=Template for the hostname of the nodes"`
+	IPAddressStart      string                        `yaml:"ipAddressStart,omitempty" jsonschema:"example=192.168.200.21,description=IP address of the first node in the node pool"`
+	IPAddressCIDR       string                        `yaml:"ipAddressCIDR,omitempty" jsonschema:"example=192.168.200.0/24,description=CIDR where the IP address of the nodes are allocated from"`
+	ControlPlane        bool                          `yaml:"controlPlane" jsonschema:"description=Whether the nodes are controlplane"`
+	UpgradeGroup        string                        `yaml:"upgradeGroup,omitempty" jsonschema:"description=Name of the group the nodes are upgraded with by \"upgrade-plan\""`
+	Groups              []string                      `yaml:"groups,omitempty" jsonschema:"description=List of node groups defined in \"nodeGroups\" to apply to the nodes, in order"`
+	InstallDisk         string                        `yaml:"installDisk,omitempty" jsonschema:"oneof_required=installDiskSelector,description=The disk used for installation"`
+	InstallDiskSelector *v1alpha1.InstallDiskSelector `yaml:"installDiskSelector,omitempty" jsonschema:"oneof_required=installDisk,description=Look up disk used for installation"`
+	IgnoreHostname      bool                          `yaml:"ignoreHostname" jsonschema:"description=Whether to set \"machine.network.hostname\" to the generated config file"`
+	MergeStrategy       map[string]string             `yaml:"mergeStrategy,omitempty" jsonschema:"description=How node configurations defined here are merged with the one defined in node group, map of field name to \"merge\", \"append\" or \"replace\""`
+	Validation          Validation                    `yaml:"validate,omitempty" jsonschema:"description=Configurations for the validation of the nodes"`
+	NodeConfigs         `yaml:",inline" jsonschema:"description=Configurations for every node in the node pool that will override node group configurations"`
+}
+
 type NodeConfigs struct {
 	NodeLabels          map[string]string              `yaml:"nodeLabels" jsonschema:"description=Labels to be added to the node, supports templating"`
 	NodeAnnotations     map[string]string              `yaml:"nodeAnnotations" jsonschema:"description=Annotations to be added to the node, supports templating"`
@@ -68,6 +99,10 @@ type NodeConfigs struct {
 	FilenameTmpl        string                         `yaml:"filenameTmpl" jsonschema:"default={{.ClusterName}}-{{Hostname}}.yaml,description=Template for the generated filename"`
 }
 
+type Validation struct {
+	Ignore []string `yaml:"ignore,omitempty" jsonschema:"example=UnreleasedTalosVersion,description=List of warning rule IDs or kinds to ignore"`
+}
+
 type ImageFactory struct {
 	RegistryURL       string `yaml:"registryURL,omitempty" jsonschema:"default=factory.talos.dev,description=Registry url or the image"`
 	SchematicEndpoint string `yaml:"schematicEndpoint,omitempty" jsonschema:"default=/schematics,description:Endpoint to get schematic ID from the registry"`
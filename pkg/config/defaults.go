@@ -134,6 +134,14 @@ func (n *Node) GetIPAddresses() []string {
 	return result
 }
 
+// GetRole returns "controlplane" or "worker" depending on `n.ControlPlane`.
+func (n *Node) GetRole() string {
+	if n.ControlPlane {
+		return "controlplane"
+	}
+	return "worker"
+}
+
 func (n *Node) GetFilenameTmpl() string {
 	tmpl := "{{ .ClusterName }}-{{ .Hostname }}.yaml"
 	if n.FilenameTmpl != "" {
@@ -1,27 +1,71 @@
 package config
 
 import (
-	"bytes"
-
+	"github.com/budimanjojo/talhelper/v3/pkg/yamledit"
 	"gopkg.in/yaml.v3"
 )
 
-// Encode encodes Talhelper config into yaml bytes.
-// It also returns an error, if any.
+// Encode encodes Talhelper config into yaml bytes. The comments and the
+// order of fields in `cfg` are kept, and the fields not in `cfg` are only
+// added if they're not empty. It also returns an error, if any.
 func (c *TalhelperConfig) Encode(cfg []byte) ([]byte, error) {
 	err := yaml.Unmarshal(cfg, &c)
 	if err != nil {
 		return nil, err
 	}
 
-	buf := new(bytes.Buffer)
-	encoder := yaml.NewEncoder(buf)
-	encoder.SetIndent(2)
-
-	err = encoder.Encode(c)
+	doc, err := yamledit.Parse(cfg)
 	if err != nil {
 		return nil, err
 	}
 
-	return buf.Bytes(), nil
+	var node yaml.Node
+	if err := node.Encode(c); err != nil {
+		return nil, err
+	}
+
+	root := doc.Root()
+	pruneAddedEmpty(root, &node)
+	if root != nil {
+		yamledit.Merge(root, &node)
+	} else {
+		doc.Nodes = []*yaml.Node{{Kind: yaml.DocumentNode, Content: []*yaml.Node{&node}}}
+	}
+
+	return doc.Encode()
+}
+
+// pruneAddedEmpty removes the fields of `src` with null, empty or false value
+// that are not in `dst`, so merging `src` into `dst` doesn't add them while
+// the ones set in `dst` are kept.
+func pruneAddedEmpty(dst, src *yaml.Node) {
+	if dst == nil || dst.Kind != src.Kind {
+		yamledit.PruneEmpty(src)
+		return
+	}
+
+	switch src.Kind {
+	case yaml.MappingNode:
+		var content []*yaml.Node
+		for i := 0; i+1 < len(src.Content); i += 2 {
+			key, value := src.Content[i], src.Content[i+1]
+			if existing := yamledit.MappingValue(dst, key.Value); existing != nil {
+				pruneAddedEmpty(existing, value)
+				content = append(content, key, value)
+				continue
+			}
+			field := &yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{key, value}}
+			yamledit.PruneEmpty(field)
+			content = append(content, field.Content...)
+		}
+		src.Content = content
+	case yaml.SequenceNode:
+		for i, item := range src.Content {
+			var existing *yaml.Node
+			if i < len(dst.Content) {
+				existing = dst.Content[i]
+			}
+			pruneAddedEmpty(existing, item)
+		}
+	}
 }
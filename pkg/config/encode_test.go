@@ -0,0 +1,68 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEncode(t *testing.T) {
+	cfg := `---
+# my cluster
+talosVersion: v1.12.0
+clusterName: test # name
+unknownField: foo
+nodes:
+  - hostname: cp1
+    ipAddress: 10.0.0.1
+    controlPlane: true
+    ignoreHostname: false
+    nodeLabels: {}
+`
+	expected := `---
+# my cluster
+talosVersion: v1.12.0
+clusterName: test # name
+nodes:
+  - hostname: cp1
+    ipAddress: 10.0.0.1
+    controlPlane: true
+    ignoreHostname: false
+    nodeLabels: {}
+`
+
+	var c TalhelperConfig
+	result, err := c.Encode([]byte(cfg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(result) != expected {
+		t.Errorf("got\n%s\nwant\n%s", result, expected)
+	}
+	if c.ClusterName != "test" || len(c.Nodes) != 1 {
+		t.Errorf("unexpected config %+v", c)
+	}
+}
+
+func TestApplyInlinePatch(t *testing.T) {
+	c := TalhelperConfig{
+		ClusterName:  "test",
+		Endpoint:     "https://10.0.0.1:6443",
+		TalosVersion: "v1.12.0",
+		Nodes: []Node{
+			{Hostname: "cp1", IPAddress: "10.0.0.1", ControlPlane: true},
+		},
+	}
+
+	result, err := c.ApplyInlinePatch([]byte("endpoint: https://10.0.0.2:6443\ntalosVersion: null\ndomain: example.com\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := string(result)
+	if strings.Contains(out, "talosVersion") || !strings.Contains(out, "endpoint: https://10.0.0.2:6443") || !strings.Contains(out, "domain: example.com") {
+		t.Errorf("unexpected patched config:\n%s", out)
+	}
+	if strings.Index(out, "clusterName") > strings.Index(out, "endpoint") || strings.Index(out, "endpoint") > strings.Index(out, "nodes") {
+		t.Errorf("expected order of fields to be kept, got:\n%s", out)
+	}
+}
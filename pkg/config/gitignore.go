@@ -29,6 +29,12 @@ func (config *TalhelperConfig) GenerateGitignore(outputDir string) error {
 	return nil
 }
 
+// AddToGitignore adds `fileName` into `.gitignore` file in `outputDir` if
+// it's not ignored yet. It returns an error, if any.
+func AddToGitignore(outputDir, fileName string) error {
+	return createGitIgnore(outputDir, fileName)
+}
+
 func createGitIgnore(path, line string) error {
 	ignorefPath := path + "/.gitignore"
 
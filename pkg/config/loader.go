@@ -6,7 +6,6 @@ import (
 	"os"
 
 	"github.com/budimanjojo/talhelper/v3/pkg/substitute"
-	"github.com/fatih/color"
 	"gopkg.in/yaml.v3"
 )
 
@@ -14,97 +13,128 @@ import (
 // from envPaths. The resulted TalhelperConfig will be validated before being returned.
 // It returns an error, if any.
 func LoadAndValidateFromFile(filePath string, envPaths []string, showWarns bool) (*TalhelperConfig, error) {
-	slog.Debug("start loading and validating config file")
-	slog.Debug(fmt.Sprintf("reading %s", filePath))
+	return LoadAndValidateClusterFromFile(filePath, "", envPaths, showWarns)
+}
+
+// LoadAndValidateClusterFromFile is the same as `LoadAndValidateFromFile` but
+// it returns the config of `cluster` when the config file has `clusters` defined.
+// `cluster` can be empty if the config file only has one cluster.
+// It returns an error, if any.
+func LoadAndValidateClusterFromFile(filePath, cluster string, envPaths []string, showWarns bool) (*TalhelperConfig, error) {
+	return LoadAndReportClusterFromFile(filePath, cluster, envPaths, nil, &Reporter{Format: ReportText, Output: os.Stderr, ShowWarns: showWarns})
+}
 
-	cfgByte, err := FromFile(filePath)
+// LoadAndReportClusterFromFile is the same as `LoadAndValidateClusterFromFile`
+// but the validation result, including the issues found by the rules of
+// `policy` if it's not nil, is reported with `r`. It returns an error, if any.
+func LoadAndReportClusterFromFile(filePath, cluster string, envPaths []string, policy *Policy, r *Reporter) (*TalhelperConfig, error) {
+	slog.Debug(fmt.Sprintf("reading %s", filePath))
+	source, err := FromFile(filePath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read config file: %s", err)
 	}
 
+	return LoadAndReportClusterFromSource(filePath, source, cluster, envPaths, policy, r)
+}
+
+// LoadAndReportClusterFromSource is the same as `LoadAndReportClusterFromFile`
+// but the content of `filePath` is `source`, so a config that's not written
+// yet can be validated with its relative paths, `extends` and the reported
+// positions resolved from `filePath`. It returns an error, if any.
+func LoadAndReportClusterFromSource(filePath string, source []byte, cluster string, envPaths []string, policy *Policy, r *Reporter) (*TalhelperConfig, error) {
+	slog.Debug("start loading and validating config file")
+
 	if err := substitute.LoadEnvFromFiles(envPaths); err != nil {
 		return nil, fmt.Errorf("failed to load env file: %s", err)
 	}
 
-	slog.Debug("substituting config file with environment variable")
-	cfgByte, err = substitute.SubstituteEnvFromByte(cfgByte)
+	cfg, err := loadClusterFromSource(filePath, source, cluster, true)
 	if err != nil {
-		return nil, fmt.Errorf("failed to substitute env: %s", err)
+		return nil, err
 	}
 
-	slog.Debug("substituting relative paths with absolute paths")
-	cfgByte, err = substitute.SubstituteRelativePaths(filePath, cfgByte)
-	if err != nil {
-		return nil, fmt.Errorf("failed to evaluate relative paths: %s", err)
+	if err := cfg.prepareNodes(true); err != nil {
+		return nil, err
 	}
 
-	cfg, err := NewFromByte(cfgByte)
-	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal config file: %s", err)
+	errs, warns := cfg.ValidateWithPolicy(policy)
+	if err := r.Report(errs, warns); err != nil {
+		return nil, err
 	}
 
-	if len(cfg.ClusterInlineManifests) > 0 {
-		for i, manifest := range cfg.ClusterInlineManifests {
-			contents, err := substitute.SubstituteFileContent(manifest.InlineManifestContents, !manifest.SkipEnvsubst)
-			if err != nil {
-				return nil, fmt.Errorf("failed to get inlineManifest content for %s in `inlineManifest[%d]`: %s", manifest.InlineManifestContents, i, err)
-			}
-			manifest.InlineManifestContents = contents
-		}
+	return cfg, nil
+}
+
+// LoadClusterFromFile takes a file path and yaml encoded env files path, do envsubst
+// from envPaths and returns the config of `cluster` with `nodePools` expanded into
+// `nodes` like `LoadAndValidateClusterFromFile`. Unlike `LoadAndValidateClusterFromFile`,
+// node groups are not merged into the nodes and the result is not validated.
+// It returns an error, if any.
+func LoadClusterFromFile(filePath, cluster string, envPaths []string) (*TalhelperConfig, error) {
+	if err := substitute.LoadEnvFromFiles(envPaths); err != nil {
+		return nil, fmt.Errorf("failed to load env file: %s", err)
 	}
 
-	for k := range cfg.Nodes {
-		node := &cfg.Nodes[k]
+	slog.Debug(fmt.Sprintf("reading %s", filePath))
+	source, err := FromFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %s", err)
+	}
 
-		switch node.ControlPlane {
-		case true:
-			slog.Debug(fmt.Sprintf("overriding global controlplane node config for %s", node.Hostname))
-			node.OverrideGlobalCfg(cfg.ControlPlane)
-		case false:
-			slog.Debug(fmt.Sprintf("overriding global worker node config for %s", node.Hostname))
-			node.OverrideGlobalCfg(cfg.Worker)
-		}
+	return loadClusterFromSource(filePath, source, cluster, true)
+}
 
-		if len(node.MachineFiles) > 0 {
-			for i, file := range node.MachineFiles {
-				contents, err := substitute.SubstituteFileContent(file.FileContent, !file.SkipEnvsubst)
-				if err != nil {
-					return nil, fmt.Errorf("failed to get machine file content for %s in `machineFiles[%d]`: %s", node.Hostname, i, err)
-				}
-				file.FileContent = contents
-			}
-		}
+// loadClusterFromSource converts `source`, the content of `filePath`, into
+// Talhelper config with its `extends` resolved, then returns the config of
+// `cluster` with `nodePools` expanded into `nodes`. envsubst is only done if
+// `substituteEnv` is true. It returns an error, if any.
+func loadClusterFromSource(filePath string, source []byte, cluster string, substituteEnv bool) (*TalhelperConfig, error) {
+	cfg, err := loadConfigSource(filePath, source, substituteEnv, nil)
+	if err != nil {
+		return nil, err
 	}
 
-	errs, warns := cfg.Validate()
-	grouped := make(map[string][]string)
+	cfg, err = cfg.SelectCluster(cluster)
+	if err != nil {
+		return nil, err
+	}
 
-	for _, v := range errs {
-		grouped[v.Field] = append(grouped[v.Field], v.Message.Error())
+	if err := cfg.ExpandNodePools(); err != nil {
+		return nil, err
 	}
 
-	if showWarns {
-		for _, v := range warns {
-			grouped[v.Field] = append(grouped[v.Field], v.Message)
+	return cfg, nil
+}
+
+// prepareNodes merges the global and node groups configurations into the
+// nodes and replaces the `@file` contents of inline manifests and machine
+// files with the content of the files, envsubst is done on them if
+// `substituteEnv` is true. It returns an error, if any.
+func (c *TalhelperConfig) prepareNodes(substituteEnv bool) error {
+	for i, manifest := range c.ClusterInlineManifests {
+		contents, err := substitute.SubstituteFileContent(manifest.InlineManifestContents, substituteEnv && !manifest.SkipEnvsubst)
+		if err != nil {
+			return fmt.Errorf("failed to get inlineManifest content for %s in `inlineManifest[%d]`: %s", manifest.InlineManifestContents, i, err)
 		}
+		manifest.InlineManifestContents = contents
 	}
 
-	if len(grouped) > 0 {
-		color.Red("There are issues with your Talhelper config file:")
+	for k := range c.Nodes {
+		node := &c.Nodes[k]
 
-		for field, list := range grouped {
-			color.Yellow("field: %q\n", field)
-			for _, l := range list {
-				fmt.Println(l)
+		slog.Debug(fmt.Sprintf("overriding global %s node config for %s", node.GetRole(), node.Hostname))
+		node.overrideGlobalCfg(c.GetNodeGroupsCfg(node), c.source.fields(fmt.Sprintf("nodes[%d]", k)))
+
+		for i, file := range node.MachineFiles {
+			contents, err := substitute.SubstituteFileContent(file.FileContent, substituteEnv && !file.SkipEnvsubst)
+			if err != nil {
+				return fmt.Errorf("failed to get machine file content for %s in `machineFiles[%d]`: %s", node.Hostname, i, err)
 			}
+			file.FileContent = contents
 		}
 	}
 
-	if len(errs) > 0 {
-		return nil, fmt.Errorf("please fix issues with your config file")
-	}
-
-	return cfg, nil
+	return nil
 }
 
 // NewFromByte takes bytes and convert it into Talhelper config.
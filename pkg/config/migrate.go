@@ -0,0 +1,297 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/budimanjojo/talhelper/v3/pkg/yamledit"
+	"gopkg.in/yaml.v3"
+)
+
+// MigrateChange is a change made by `Migrate` into talhelper config.
+type MigrateChange struct {
+	// Field is the YAML path of the migrated field.
+	Field   string
+	Message string
+	// Manual is true if the field can't be migrated automatically.
+	Manual bool
+}
+
+func (c MigrateChange) String() string {
+	return fmt.Sprintf("%s: %s", c.Field, c.Message)
+}
+
+// Migrate takes talhelper config bytes and rewrites deprecated fields into
+// their replacements while keeping comments and the order of fields. It
+// returns the rewritten config and the list of changes, the config is
+// returned as is if there's nothing to migrate. It returns an error, if any.
+func Migrate(source []byte) ([]byte, []MigrateChange, error) {
+	doc, err := yamledit.Parse(source)
+	if err != nil {
+		return nil, nil, err
+	}
+	root := doc.Root()
+	if root == nil || root.Kind != yaml.MappingNode {
+		return nil, nil, fmt.Errorf("talhelper config must be a YAML map")
+	}
+
+	var changes []MigrateChange
+	migrateCluster(root, "", &changes)
+
+	if !hasAutomaticChange(changes) {
+		return source, changes, nil
+	}
+
+	result, err := doc.Encode()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return result, changes, nil
+}
+
+func hasAutomaticChange(changes []MigrateChange) bool {
+	for _, c := range changes {
+		if !c.Manual {
+			return true
+		}
+	}
+	return false
+}
+
+// migrateCluster migrates the deprecated fields of cluster config `m` in `field`.
+func migrateCluster(m *yaml.Node, field string, changes *[]MigrateChange) {
+	migrateAllowSchedulingOnMasters(m, field, changes)
+	migrateAdditionalMachineCertSans(m, field, changes)
+
+	for _, key := range []string{"controlPlane", "worker"} {
+		if v := yamledit.MappingValue(m, key); v != nil && v.Kind == yaml.MappingNode {
+			migrateNodeConfigs(v, joinField(field, key), changes)
+		}
+	}
+
+	if groups := yamledit.MappingValue(m, "nodeGroups"); groups != nil && groups.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(groups.Content); i += 2 {
+			if v := groups.Content[i+1]; v.Kind == yaml.MappingNode {
+				migrateNodeConfigs(v, joinField(field, "nodeGroups."+groups.Content[i].Value), changes)
+			}
+		}
+	}
+
+	for _, key := range []string{"nodes", "nodePools"} {
+		if seq := yamledit.MappingValue(m, key); seq != nil && seq.Kind == yaml.SequenceNode {
+			for i, v := range seq.Content {
+				if v.Kind == yaml.MappingNode {
+					migrateNodeConfigs(v, joinField(field, fmt.Sprintf("%s[%d]", key, i)), changes)
+				}
+			}
+		}
+	}
+
+	if seq := yamledit.MappingValue(m, "clusters"); seq != nil && seq.Kind == yaml.SequenceNode {
+		for i, v := range seq.Content {
+			if v.Kind == yaml.MappingNode {
+				migrateCluster(v, joinField(field, fmt.Sprintf("clusters[%d]", i)), changes)
+			}
+		}
+	}
+}
+
+// migrateNodeConfigs migrates the deprecated fields of `NodeConfigs` `m` in `field`.
+func migrateNodeConfigs(m *yaml.Node, field string, changes *[]MigrateChange) {
+	migrateExtraManifests(m, field, changes)
+	migrateMachineDisks(m, field, changes)
+}
+
+// migrateAllowSchedulingOnMasters renames `allowSchedulingOnMasters` into
+// `allowSchedulingOnControlPlanes`.
+func migrateAllowSchedulingOnMasters(m *yaml.Node, field string, changes *[]MigrateChange) {
+	idx := yamledit.MappingIndex(m, "allowSchedulingOnMasters")
+	if idx < 0 {
+		return
+	}
+
+	key, value := m.Content[idx], m.Content[idx+1]
+	if existing := yamledit.MappingValue(m, "allowSchedulingOnControlPlanes"); existing != nil {
+		if value.Value == "true" {
+			existing.Value = "true"
+		}
+		yamledit.MappingDelete(m, "allowSchedulingOnMasters")
+	} else {
+		key.Value = "allowSchedulingOnControlPlanes"
+	}
+
+	*changes = append(*changes, MigrateChange{
+		Field:   joinField(field, "allowSchedulingOnMasters"),
+		Message: "renamed to `allowSchedulingOnControlPlanes`",
+	})
+}
+
+// migrateAdditionalMachineCertSans moves `additionalMachineCertSans` into
+// `certSANs` of `controlPlane` and `worker`.
+func migrateAdditionalMachineCertSans(m *yaml.Node, field string, changes *[]MigrateChange) {
+	sans := yamledit.MappingValue(m, "additionalMachineCertSans")
+	if sans == nil {
+		return
+	}
+
+	f := joinField(field, "additionalMachineCertSans")
+	if sans.Kind != yaml.SequenceNode {
+		*changes = append(*changes, MigrateChange{Field: f, Message: "is not a list, please migrate it manually", Manual: true})
+		return
+	}
+
+	for _, group := range []string{"controlPlane", "worker"} {
+		g := yamledit.MappingValue(m, group)
+		if g == nil {
+			g = yamledit.NewMapping()
+			yamledit.MappingSet(m, group, g)
+		}
+		yamledit.AppendToSequence(g, "certSANs", sans.Content...)
+	}
+	yamledit.MappingDelete(m, "additionalMachineCertSans")
+
+	*changes = append(*changes, MigrateChange{
+		Field:   f,
+		Message: "moved to `controlPlane.certSANs` and `worker.certSANs`",
+	})
+
+	nodes := yamledit.MappingValue(m, "nodes")
+	if nodes == nil {
+		return
+	}
+	for i, node := range nodes.Content {
+		override := yamledit.MappingValue(node, "overrideMachineCertSANs")
+		strategy := yamledit.MappingValue(node, "mergeStrategy")
+		if (override != nil && override.Value == "true") || (strategy != nil && yamledit.MappingValue(strategy, "certSANs") != nil && yamledit.MappingValue(strategy, "certSANs").Value == "replace") {
+			*changes = append(*changes, MigrateChange{
+				Field:   joinField(field, fmt.Sprintf("nodes[%d].certSANs", i)),
+				Message: "replaces `certSANs` of its node group, add the previous `additionalMachineCertSans` into it manually",
+				Manual:  true,
+			})
+		}
+	}
+}
+
+// migrateExtraManifests moves `extraManifests` to the end of `patches`.
+func migrateExtraManifests(m *yaml.Node, field string, changes *[]MigrateChange) {
+	manifests := yamledit.MappingValue(m, "extraManifests")
+	if manifests == nil {
+		return
+	}
+
+	f := joinField(field, "extraManifests")
+	if override := yamledit.MappingValue(m, "overrideExtraManifests"); override != nil && override.Value == "true" {
+		*changes = append(*changes, MigrateChange{
+			Field:   f,
+			Message: "`overrideExtraManifests` is set and can't be converted into `overridePatches` automatically, please migrate it manually",
+			Manual:  true,
+		})
+		return
+	}
+	if manifests.Kind != yaml.SequenceNode {
+		*changes = append(*changes, MigrateChange{Field: f, Message: "is not a list, please migrate it manually", Manual: true})
+		return
+	}
+
+	yamledit.AppendToSequence(m, "patches", manifests.Content...)
+	yamledit.MappingDelete(m, "extraManifests")
+	yamledit.MappingDelete(m, "overrideExtraManifests")
+
+	*changes = append(*changes, MigrateChange{
+		Field:   f,
+		Message: fmt.Sprintf("moved %d item(s) to the end of `patches`", len(manifests.Content)),
+	})
+}
+
+type migratedUserVolume struct {
+	Name         string                     `yaml:"name"`
+	Provisioning migratedVolumeProvisioning `yaml:"provisioning"`
+}
+
+type migratedVolumeProvisioning struct {
+	DiskSelector struct {
+		Match string `yaml:"match"`
+	} `yaml:"diskSelector"`
+	MinSize string `yaml:"minSize,omitempty"`
+	MaxSize string `yaml:"maxSize,omitempty"`
+	Grow    bool   `yaml:"grow,omitempty"`
+}
+
+var invalidVolumeNameChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// migrateMachineDisks converts every partition in `machineDisks` into `userVolumes`.
+func migrateMachineDisks(m *yaml.Node, field string, changes *[]MigrateChange) {
+	disks := yamledit.MappingValue(m, "machineDisks")
+	if disks == nil {
+		return
+	}
+
+	f := joinField(field, "machineDisks")
+	if disks.Kind != yaml.SequenceNode {
+		*changes = append(*changes, MigrateChange{Field: f, Message: "is not a list, please migrate it manually", Manual: true})
+		return
+	}
+
+	var (
+		volumes []*yaml.Node
+		names   []string
+	)
+	for i, disk := range disks.Content {
+		device := yamledit.MappingValue(disk, "device")
+		partitions := yamledit.MappingValue(disk, "partitions")
+		if device == nil || partitions == nil || partitions.Kind != yaml.SequenceNode {
+			*changes = append(*changes, MigrateChange{Field: fmt.Sprintf("%s[%d]", f, i), Message: "doesn't have `device` or `partitions`, please migrate it manually", Manual: true})
+			return
+		}
+
+		for j, partition := range partitions.Content {
+			mountpoint := yamledit.MappingValue(partition, "mountpoint")
+			if mountpoint == nil || mountpoint.Value == "" {
+				*changes = append(*changes, MigrateChange{Field: fmt.Sprintf("%s[%d].partitions[%d]", f, i, j), Message: "doesn't have `mountpoint`, please migrate it manually", Manual: true})
+				return
+			}
+
+			var v migratedUserVolume
+			v.Name = strings.Trim(invalidVolumeNameChars.ReplaceAllString(strings.ToLower(path.Base(mountpoint.Value)), "-"), "-")
+			v.Provisioning.DiskSelector.Match = fmt.Sprintf("disk.dev_path == %q", device.Value)
+			if size := yamledit.MappingValue(partition, "size"); size != nil && size.Value != "" && size.Value != "0" {
+				v.Provisioning.MinSize = size.Value
+				v.Provisioning.MaxSize = size.Value
+			} else {
+				// the partition used to occupy the rest of the disk
+				v.Provisioning.MaxSize = "100%"
+				v.Provisioning.Grow = true
+			}
+
+			var node yaml.Node
+			if err := node.Encode(v); err != nil {
+				*changes = append(*changes, MigrateChange{Field: fmt.Sprintf("%s[%d].partitions[%d]", f, i, j), Message: err.Error(), Manual: true})
+				return
+			}
+			volumes = append(volumes, &node)
+			if mountPath := "/var/mnt/" + v.Name; mountPath != path.Clean(mountpoint.Value) {
+				names = append(names, fmt.Sprintf("`%s` (mounted at %s instead of %s)", v.Name, mountPath, mountpoint.Value))
+			} else {
+				names = append(names, fmt.Sprintf("`%s`", v.Name))
+			}
+		}
+	}
+
+	yamledit.AppendToSequence(m, "userVolumes", volumes...)
+	yamledit.MappingDelete(m, "machineDisks")
+
+	*changes = append(*changes, MigrateChange{
+		Field:   f,
+		Message: "converted to `userVolumes` " + strings.Join(names, ", ") + ", existing data in the partitions is not moved",
+	})
+}
+
+func joinField(field, key string) string {
+	if field == "" {
+		return key
+	}
+	return field + "." + key
+}
@@ -0,0 +1,148 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestMigrate(t *testing.T) {
+	source := `---
+# my cluster
+clusterName: test
+allowSchedulingOnMasters: true # keep me
+additionalMachineCertSans:
+  - 10.0.0.10
+nodes:
+  - hostname: cp1 # first node
+    controlPlane: true
+    nodeLabels:
+      folded: >-
+        {{
+          .Foo
+        }}
+  - hostname: worker1
+    overrideMachineCertSANs: true
+    extraManifests:
+      - manifest.yaml
+    patches:
+      - "@./patch.yaml"
+    machineDisks:
+      - device: /dev/sdb
+        partitions:
+          - mountpoint: /var/mnt/data
+            size: 10GB
+          - mountpoint: /var/lib/Extra Data
+worker:
+  extraManifests:
+    - worker.yaml
+  overrideExtraManifests: true
+`
+
+	result, changes, err := Migrate([]byte(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var fields []string
+	var manual []string
+	for _, c := range changes {
+		if c.Manual {
+			manual = append(manual, c.Field)
+		} else {
+			fields = append(fields, c.Field)
+		}
+	}
+	expectedFields := []string{"allowSchedulingOnMasters", "additionalMachineCertSans", "nodes[1].extraManifests", "nodes[1].machineDisks"}
+	if !reflect.DeepEqual(fields, expectedFields) {
+		t.Errorf("got migrated fields %v, want %v", fields, expectedFields)
+	}
+	expectedManual := []string{"nodes[1].certSANs", "worker.extraManifests"}
+	if !reflect.DeepEqual(manual, expectedManual) {
+		t.Errorf("got manual fields %v, want %v", manual, expectedManual)
+	}
+
+	out := string(result)
+	for _, s := range []string{"---\n", "# my cluster", "# keep me", "# first node"} {
+		if !strings.Contains(out, s) {
+			t.Errorf("expected result to contain %q, got:\n%s", s, out)
+		}
+	}
+
+	var got struct {
+		AllowSchedulingOnControlPlanes bool             `yaml:"allowSchedulingOnControlPlanes"`
+		AdditionalMachineCertSans      []string         `yaml:"additionalMachineCertSans"`
+		ControlPlane                   map[string]any   `yaml:"controlPlane"`
+		Worker                         map[string]any   `yaml:"worker"`
+		Nodes                          []map[string]any `yaml:"nodes"`
+	}
+	if err := yaml.Unmarshal(result, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if !got.AllowSchedulingOnControlPlanes || got.AdditionalMachineCertSans != nil {
+		t.Errorf("unexpected cluster fields %+v", got)
+	}
+	if !reflect.DeepEqual(got.ControlPlane["certSANs"], []any{"10.0.0.10"}) || !reflect.DeepEqual(got.Worker["certSANs"], []any{"10.0.0.10"}) {
+		t.Errorf("expected certSANs in controlPlane and worker, got %v and %v", got.ControlPlane, got.Worker)
+	}
+	if got.Worker["extraManifests"] == nil || got.Worker["overrideExtraManifests"] != true {
+		t.Errorf("expected worker extraManifests to be kept, got %v", got.Worker)
+	}
+
+	labels := got.Nodes[0]["nodeLabels"].(map[string]any)
+	if labels["folded"] != "{{\n  .Foo\n}}" {
+		t.Errorf("expected folded scalar to be kept, got %q", labels["folded"])
+	}
+
+	worker := got.Nodes[1]
+	if _, ok := worker["extraManifests"]; ok {
+		t.Errorf("expected extraManifests to be removed, got %v", worker)
+	}
+	if !reflect.DeepEqual(worker["patches"], []any{"@./patch.yaml", "manifest.yaml"}) {
+		t.Errorf("got patches %v", worker["patches"])
+	}
+	if _, ok := worker["machineDisks"]; ok {
+		t.Errorf("expected machineDisks to be removed, got %v", worker)
+	}
+	expectedVolumes := []any{
+		map[string]any{
+			"name": "data",
+			"provisioning": map[string]any{
+				"diskSelector": map[string]any{"match": `disk.dev_path == "/dev/sdb"`},
+				"minSize":      "10GB",
+				"maxSize":      "10GB",
+			},
+		},
+		map[string]any{
+			"name": "extra-data",
+			"provisioning": map[string]any{
+				"diskSelector": map[string]any{"match": `disk.dev_path == "/dev/sdb"`},
+				"maxSize":      "100%",
+				"grow":         true,
+			},
+		},
+	}
+	if !reflect.DeepEqual(worker["userVolumes"], expectedVolumes) {
+		t.Errorf("got userVolumes %v, want %v", worker["userVolumes"], expectedVolumes)
+	}
+
+	again, changes, err := Migrate(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(again) != string(result) {
+		t.Errorf("expected migrated config to be unchanged, got:\n%s", again)
+	}
+	for _, c := range changes {
+		if !c.Manual {
+			t.Errorf("expected no automatic changes, got %s", c)
+		}
+	}
+
+	if _, _, err := Migrate([]byte("- foo")); err == nil {
+		t.Error("expected error for non map config, got nil")
+	}
+}
@@ -1,28 +1,124 @@
 package config
 
 import (
+	"fmt"
+	"maps"
 	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/budimanjojo/talhelper/v3/pkg/yamledit"
+	"gopkg.in/yaml.v3"
 )
 
+// MergeStrategies is the list of supported values of `mergeStrategy`.
+// `merge` deep merges maps and structs and replaces lists, it is the default.
+// `append` is the same as `merge` but lists are appended instead.
+// `replace` takes the whole field from the node if it is defined.
+var MergeStrategies = []string{"merge", "append", "replace"}
+
+// defaultMergeStrategy is the strategy of fields that aren't merged with
+// `merge`, their lists have always been appended.
+var defaultMergeStrategy = map[string]string{
+	"patches":        "append",
+	"extraManifests": "append",
+	"certSANs":       "append",
+}
+
+// newMergeStrategy returns `defaultMergeStrategy` with `overrides` on top of it.
+// `merge` in `overrides` keeps the default strategy of the field.
+func newMergeStrategy(overrides map[string]string) map[string]string {
+	result := maps.Clone(defaultMergeStrategy)
+	for field, strategy := range overrides {
+		if strategy != "merge" {
+			result[field] = strategy
+		}
+	}
+	return result
+}
+
+// OverrideGlobalCfg merges `cfg`, the node groups configurations, into the
+// configurations of `node`. It doesn't know which fields are set in the config
+// file so only the non-zero fields of `node` override `cfg`, see `overrideGlobalCfg`.
 func (node *Node) OverrideGlobalCfg(cfg NodeConfigs) *Node {
-	node.NodeConfigs = mergeNodeConfigs(node.NodeConfigs, cfg, node.OverridePatches, node.OverrideExtraManifests, node.OverrideMachineCertSANs)
+	return node.overrideGlobalCfg(cfg, nil)
+}
+
+// overrideGlobalCfg is the same as `OverrideGlobalCfg` but every field of `node`
+// set in `fields`, even to its zero value, overrides `cfg`.
+func (node *Node) overrideGlobalCfg(cfg NodeConfigs, fields yamlFields) *Node {
+	node.NodeConfigs = mergeNodeConfigs(node.NodeConfigs, cfg, node.GetMergeStrategy(), fields)
 
 	return node
 }
 
-func mergeNodeConfigs(patch, src NodeConfigs, overridePatches, overrideExtraManifest, overrideMachineCertSANs bool) NodeConfigs {
-	if len(src.Patches) > 0 && !overridePatches {
-		// global patches should get applied first
-		// https://github.com/budimanjojo/talhelper/issues/388
-		patch.Patches = append(src.Patches, patch.Patches...)
+// NodeConfigsLayer is the `NodeConfigs` of a node group, `Source` is where it
+// is defined (e.g: `worker` or `nodeGroups.gpu`).
+type NodeConfigsLayer struct {
+	Source      string
+	NodeConfigs NodeConfigs
+}
+
+// GetNodeGroupsLayers returns the configurations of every node group `node`
+// belongs to, in the order they're merged: the `controlPlane` or `worker` group
+// first, then every group in `node.Groups` in order. Unknown groups are skipped,
+// they're reported by `Validate`.
+func (c *TalhelperConfig) GetNodeGroupsLayers(node *Node) []NodeConfigsLayer {
+	result := []NodeConfigsLayer{{Source: "worker", NodeConfigs: c.Worker}}
+	if node.ControlPlane {
+		result = []NodeConfigsLayer{{Source: "controlPlane", NodeConfigs: c.ControlPlane}}
+	}
+
+	for _, group := range node.Groups {
+		if cfg, ok := c.NodeGroups[group]; ok {
+			result = append(result, NodeConfigsLayer{Source: "nodeGroups." + group, NodeConfigs: cfg})
+		}
+	}
+
+	return result
+}
+
+// GetNodeGroupsCfg returns the configurations of every node group `node` belongs
+// to merged together in the order of `GetNodeGroupsLayers`, so later groups
+// override earlier ones. They're merged with `mergeStrategy` of `node`.
+func (c *TalhelperConfig) GetNodeGroupsCfg(node *Node) NodeConfigs {
+	var result NodeConfigs
+	strategy := newMergeStrategy(node.MergeStrategy)
+	for _, layer := range c.GetNodeGroupsLayers(node) {
+		key, group, _ := strings.Cut(layer.Source, ".")
+		fields := c.source.fields(key)
+		if group != "" {
+			fields = fields.field(group)
+		}
+		result = mergeNodeConfigs(layer.NodeConfigs, result, strategy, fields)
+	}
+
+	return result
+}
+
+// GetMergeStrategy returns `mergeStrategy` of `n` on top of the default one,
+// with `overridePatches`, `overrideExtraManifests` and `overrideMachineCertSANs`
+// converted into it.
+func (n *Node) GetMergeStrategy() map[string]string {
+	result := newMergeStrategy(n.MergeStrategy)
+	if n.OverridePatches {
+		result["patches"] = "replace"
 	}
-	if len(src.ExtraManifests) > 0 && !overrideExtraManifest {
-		patch.ExtraManifests = append(patch.ExtraManifests, src.ExtraManifests...)
+	if n.OverrideExtraManifests {
+		result["extraManifests"] = "replace"
 	}
-	if len(src.CertSANs) > 0 && !overrideMachineCertSANs {
-		patch.CertSANs = append(patch.CertSANs, src.CertSANs...)
+	if n.OverrideMachineCertSANs {
+		result["certSANs"] = "replace"
 	}
+	return result
+}
 
+// mergeNodeConfigs returns `patch` merged on top of `src`. `strategy` is a map
+// of field name to one of `MergeStrategies`, fields not found in it are merged.
+// `fields` are the YAML mappings `patch` is decoded from, only the fields set
+// in them are taken from `patch` so they can be set to their zero value. If it's
+// nil, only the non-zero fields are.
+func mergeNodeConfigs(patch, src NodeConfigs, strategy map[string]string, fields yamlFields) NodeConfigs {
 	patchValue := reflect.ValueOf(patch)
 	srcValue := reflect.ValueOf(src)
 
@@ -32,12 +128,232 @@ func mergeNodeConfigs(patch, src NodeConfigs, overridePatches, overrideExtraMani
 		patchField := patchValue.Field(i)
 		srcField := srcValue.Field(i)
 
-		if !patchField.IsZero() {
-			result.Field(i).Set(patchField)
-		} else {
+		name := yamlFieldName(patchValue.Type().Field(i))
+		switch fieldStrategy := strategy[name]; {
+		case !fields.isSet(patchField, name):
 			result.Field(i).Set(srcField)
+		case fieldStrategy == "replace":
+			result.Field(i).Set(patchField)
+		case fieldStrategy == "append" && patchValue.Type().Field(i).Name == "Patches":
+			// global patches should get applied first
+			// https://github.com/budimanjojo/talhelper/issues/388
+			result.Field(i).Set(reflect.AppendSlice(srcField, patchField))
+		default:
+			result.Field(i).Set(mergeValue(patchField, srcField, fields.field(name), fieldStrategy == "append"))
 		}
 	}
 
 	return result.Interface().(NodeConfigs)
 }
+
+// mergeValue returns `patch` deep merged on top of `src`, `patch` is set in
+// `fields` (see `mergeNodeConfigs`). Maps and structs are merged recursively
+// with only their fields set in `fields` taken from `patch`, lists are taken
+// from `patch` unless `appendLists` is true in which case `src` is appended
+// after `patch` without duplicates, and anything else is taken from `patch`
+// even if it is zero.
+func mergeValue(patch, src reflect.Value, fields yamlFields, appendLists bool) reflect.Value {
+	if src.IsZero() {
+		return patch
+	}
+
+	switch patch.Kind() {
+	case reflect.Map:
+		if patch.IsNil() {
+			return patch
+		}
+		result := reflect.MakeMapWithSize(patch.Type(), src.Len()+patch.Len())
+		iter := src.MapRange()
+		for iter.Next() {
+			result.SetMapIndex(iter.Key(), iter.Value())
+		}
+		iter = patch.MapRange()
+		for iter.Next() {
+			value := iter.Value()
+			if existing := result.MapIndex(iter.Key()); existing.IsValid() && isMergeable(value) {
+				value = mergeValue(value, existing, fields.field(fmt.Sprint(iter.Key().Interface())), appendLists)
+			}
+			result.SetMapIndex(iter.Key(), value)
+		}
+		return result
+	case reflect.Slice:
+		if !appendLists || patch.IsNil() {
+			return patch
+		}
+		result := reflect.AppendSlice(reflect.MakeSlice(patch.Type(), 0, patch.Len()+src.Len()), patch)
+		for i := range src.Len() {
+			if !containsValue(result, src.Index(i)) {
+				result = reflect.Append(result, src.Index(i))
+			}
+		}
+		return result
+	case reflect.Pointer:
+		if patch.IsNil() || patch.Elem().Kind() != reflect.Struct || !isMergeable(patch.Elem()) {
+			return patch
+		}
+		result := reflect.New(patch.Elem().Type())
+		result.Elem().Set(mergeValue(patch.Elem(), src.Elem(), fields, appendLists))
+		return result
+	case reflect.Struct:
+		if !isMergeable(patch) {
+			return patch
+		}
+		result := reflect.New(patch.Type()).Elem()
+		for i := range patch.NumField() {
+			name, inline := yamlFieldKey(patch.Type().Field(i))
+			fieldFields := fields.field(name)
+			if inline {
+				fieldFields = fields
+			}
+			if (inline && fields != nil) || fields.isSet(patch.Field(i), name) {
+				result.Field(i).Set(mergeValue(patch.Field(i), src.Field(i), fieldFields, appendLists))
+			} else {
+				result.Field(i).Set(src.Field(i))
+			}
+		}
+		return result
+	default:
+		return patch
+	}
+}
+
+// yamlFields are the YAML mappings a value is decoded from, a field of the
+// value is set if it has a key in any of them. Aliases and merge keys (`<<`)
+// are resolved. Nil means it's not known where the value is decoded from.
+type yamlFields []*yaml.Node
+
+// newYamlFields returns `yamlFields` of `nodes`, nil nodes are skipped.
+func newYamlFields(nodes ...*yaml.Node) yamlFields {
+	var result yamlFields
+	for _, n := range nodes {
+		if n != nil {
+			result = append(result, n)
+		}
+	}
+	return result
+}
+
+// mappings returns the mappings of `f` with their aliases and merge keys resolved.
+func (f yamlFields) mappings() []*yaml.Node {
+	var result []*yaml.Node
+	for _, n := range f {
+		for n != nil && n.Kind == yaml.AliasNode {
+			n = n.Alias
+		}
+		if n == nil || n.Kind != yaml.MappingNode {
+			continue
+		}
+		result = append(result, n)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if n.Content[i].Value != "<<" {
+				continue
+			}
+			if merged := n.Content[i+1]; merged.Kind == yaml.SequenceNode {
+				result = append(result, yamlFields(merged.Content).mappings()...)
+			} else {
+				result = append(result, yamlFields{merged}.mappings()...)
+			}
+		}
+	}
+	return result
+}
+
+// isSet returns true if field `name` with value `v` is set in `f`. If `f` is
+// nil, it's set if it's not zero.
+func (f yamlFields) isSet(v reflect.Value, name string) bool {
+	if f == nil {
+		return !v.IsZero()
+	}
+	return f.has(name)
+}
+
+// has returns true if field `name` is set in `f`.
+func (f yamlFields) has(name string) bool {
+	for _, m := range f.mappings() {
+		if yamledit.MappingIndex(m, name) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// field returns `yamlFields` of field `name` of `f`.
+func (f yamlFields) field(name string) yamlFields {
+	var result yamlFields
+	for _, m := range f.mappings() {
+		result = append(result, newYamlFields(yamledit.MappingValue(m, name))...)
+	}
+	return result
+}
+
+// item returns `yamlFields` of item `idx` of the sequences in `f`.
+func (f yamlFields) item(idx int) yamlFields {
+	var result yamlFields
+	for _, n := range f {
+		for n != nil && n.Kind == yaml.AliasNode {
+			n = n.Alias
+		}
+		if n != nil && n.Kind == yaml.SequenceNode && idx < len(n.Content) {
+			result = append(result, n.Content[idx])
+		}
+	}
+	return result
+}
+
+// isMergeable returns true if `v` can be merged by `mergeValue`. Structs with
+// unexported fields can't be merged because they can't be set with reflect.
+func isMergeable(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Map, reflect.Slice:
+		return true
+	case reflect.Pointer:
+		return v.Type().Elem().Kind() == reflect.Struct
+	case reflect.Struct:
+		for i := range v.NumField() {
+			if !v.Type().Field(i).IsExported() {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+func containsValue(list, v reflect.Value) bool {
+	for i := range list.Len() {
+		if reflect.DeepEqual(list.Index(i).Interface(), v.Interface()) {
+			return true
+		}
+	}
+	return false
+}
+
+// yamlFieldName returns the name of `field` in yaml.
+func yamlFieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+	return name
+}
+
+// yamlFieldKey returns the key of `field` in a YAML mapping the same way
+// yaml.v3 does, and whether its fields are inlined into the parent mapping.
+func yamlFieldKey(field reflect.StructField) (string, bool) {
+	name, flags, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+	if slices.Contains(strings.Split(flags, ","), "inline") {
+		return "", true
+	}
+	if name == "" {
+		name = strings.ToLower(field.Name)
+	}
+	return name, false
+}
+
+// nodeConfigsFieldNames returns the yaml name of every field in `NodeConfigs`.
+func nodeConfigsFieldNames() []string {
+	var result []string
+	t := reflect.TypeFor[NodeConfigs]()
+	for i := range t.NumField() {
+		result = append(result, yamlFieldName(t.Field(i)))
+	}
+	return slices.Sorted(slices.Values(result))
+}
@@ -83,3 +83,196 @@ func TestOverrideNodeConfigs(t *testing.T) {
 		t.Errorf("got:\n%v\nwant:\n%v", node, expectedNode)
 	}
 }
+
+func TestGetNodeGroupsCfg(t *testing.T) {
+	c := &TalhelperConfig{
+		Worker: NodeConfigs{
+			Nameservers: []string{"1.1.1.1"},
+			Patches:     []string{"worker"},
+		},
+		NodeGroups: map[string]NodeConfigs{
+			"gpu": {
+				NodeLabels:  map[string]string{"gpu": "true"},
+				Nameservers: []string{"8.8.8.8"},
+				Patches:     []string{"gpu"},
+			},
+			"storage": {
+				NodeLabels: map[string]string{"storage": "true"},
+				Patches:    []string{"storage"},
+			},
+		},
+	}
+
+	node := Node{
+		Hostname: "worker1",
+		Groups:   []string{"gpu", "storage"},
+		NodeConfigs: NodeConfigs{
+			Patches: []string{"node"},
+		},
+	}
+
+	expected := NodeConfigs{
+		NodeLabels:  map[string]string{"gpu": "true", "storage": "true"},
+		Nameservers: []string{"8.8.8.8"},
+		Patches:     []string{"worker", "gpu", "storage", "node"},
+	}
+
+	node.OverrideGlobalCfg(c.GetNodeGroupsCfg(&node))
+
+	if !reflect.DeepEqual(node.NodeConfigs, expected) {
+		t.Errorf("got:\n%v\nwant:\n%v", node.NodeConfigs, expected)
+	}
+}
+
+func TestMergeNodeConfigsStrategy(t *testing.T) {
+	group := NodeConfigs{
+		NodeLabels: map[string]string{"zone": "a", "disk": "hdd"},
+		MachineSpec: MachineSpec{
+			Arch:       "amd64",
+			Secureboot: true,
+		},
+		Schematic: &schematic.Schematic{
+			Customization: schematic.Customization{
+				ExtraKernelArgs: []string{"net.ifnames=0"},
+			},
+		},
+		CertSANs: []string{"group.example.com"},
+	}
+
+	node := Node{
+		MergeStrategy:           map[string]string{"schematic": "replace"},
+		OverrideMachineCertSANs: true,
+		NodeConfigs: NodeConfigs{
+			NodeLabels: map[string]string{"disk": "ssd"},
+			MachineSpec: MachineSpec{
+				Arch: "arm64",
+			},
+			Schematic: &schematic.Schematic{
+				Customization: schematic.Customization{
+					ExtraKernelArgs: []string{"console=ttyS0"},
+				},
+			},
+			CertSANs: []string{"node.example.com"},
+		},
+	}
+
+	expected := NodeConfigs{
+		NodeLabels: map[string]string{"zone": "a", "disk": "ssd"},
+		MachineSpec: MachineSpec{
+			Arch:       "arm64",
+			Secureboot: true,
+		},
+		Schematic: &schematic.Schematic{
+			Customization: schematic.Customization{
+				ExtraKernelArgs: []string{"console=ttyS0"},
+			},
+		},
+		CertSANs: []string{"node.example.com"},
+	}
+
+	node.OverrideGlobalCfg(group)
+
+	if !reflect.DeepEqual(node.NodeConfigs, expected) {
+		t.Errorf("got:\n%v\nwant:\n%v", node.NodeConfigs, expected)
+	}
+}
+
+func TestMergeNodeConfigsAppend(t *testing.T) {
+	c := &TalhelperConfig{
+		Worker: NodeConfigs{
+			Nameservers: []string{"1.1.1.1"},
+			Schematic: &schematic.Schematic{
+				Customization: schematic.Customization{
+					ExtraKernelArgs: []string{"net.ifnames=0"},
+				},
+			},
+		},
+		NodeGroups: map[string]NodeConfigs{
+			"gpu": {
+				Nameservers: []string{"8.8.8.8"},
+			},
+		},
+	}
+
+	node := Node{
+		Groups:        []string{"gpu"},
+		MergeStrategy: map[string]string{"nameservers": "append", "schematic": "append"},
+		NodeConfigs: NodeConfigs{
+			Nameservers: []string{"9.9.9.9", "1.1.1.1"},
+			Schematic: &schematic.Schematic{
+				Customization: schematic.Customization{
+					ExtraKernelArgs: []string{"console=ttyS0"},
+				},
+			},
+		},
+	}
+
+	expected := NodeConfigs{
+		Nameservers: []string{"9.9.9.9", "1.1.1.1", "8.8.8.8"},
+		Schematic: &schematic.Schematic{
+			Customization: schematic.Customization{
+				ExtraKernelArgs: []string{"console=ttyS0", "net.ifnames=0"},
+			},
+		},
+	}
+
+	node.OverrideGlobalCfg(c.GetNodeGroupsCfg(&node))
+
+	if !reflect.DeepEqual(node.NodeConfigs, expected) {
+		t.Errorf("got:\n%v\nwant:\n%v", node.NodeConfigs, expected)
+	}
+}
+
+func TestMergeNodeConfigsZeroValue(t *testing.T) {
+	source := []byte(`clusterName: test
+worker: &worker
+  machineSpec:
+    arch: arm64
+    secureboot: true
+  nodeLabels:
+    zone: a
+nodeGroups:
+  plain:
+    machineSpec:
+      useUKI: true
+nodes:
+  - hostname: w1
+    machineSpec:
+      secureboot: false
+  - hostname: w2
+    groups:
+      - plain
+  - hostname: w3
+    <<: *worker
+    nodeLabels: {}
+nodePools:
+  - name: pool
+    count: 1
+    ipAddressStart: 10.0.0.10
+    machineSpec:
+      secureboot: false
+`)
+
+	c, err := loadClusterFromSource("talconfig.yaml", source, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.prepareNodes(false); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []MachineSpec{
+		{Arch: "arm64"},
+		{Arch: "arm64", Secureboot: true, UseUKI: true},
+		{Arch: "arm64", Secureboot: true},
+		{Arch: "arm64"},
+	}
+	for i, node := range c.Nodes {
+		if node.MachineSpec != expected[i] {
+			t.Errorf("%s: got %+v, want %+v", node.Hostname, node.MachineSpec, expected[i])
+		}
+	}
+	if !reflect.DeepEqual(c.Nodes[2].NodeLabels, map[string]string{"zone": "a"}) {
+		t.Errorf("expected node labels merged with the group, got %v", c.Nodes[2].NodeLabels)
+	}
+}
@@ -0,0 +1,165 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/budimanjojo/talhelper/v3/pkg/yamledit"
+	"gopkg.in/yaml.v3"
+)
+
+// AddNode takes talhelper config bytes and appends `node` into `nodes` of
+// `cluster` with the fields that are not set left out. The comments and the
+// order of fields in `source` are kept. It returns an error if `nodes` of
+// `cluster` is inherited from the file it `extends` or from the top level of
+// `clusters`, because defining `nodes` would replace the inherited ones.
+func AddNode(source []byte, cluster string, node Node) ([]byte, error) {
+	return editClusterConfig(source, cluster, func(root, cfg *yaml.Node) error {
+		if node.Hostname == "" {
+			return fmt.Errorf("hostname can't be empty")
+		}
+		if _, idx := findNode(cfg, node.Hostname); idx >= 0 {
+			return fmt.Errorf("node %q already exists", node.Hostname)
+		}
+		if yamledit.MappingIndex(cfg, "nodes") < 0 {
+			if cfg != root && yamledit.MappingIndex(root, "nodes") >= 0 {
+				return fmt.Errorf("`nodes` of the cluster is defined outside of `clusters`, add the node there")
+			}
+			if extends := yamledit.MappingValue(root, "extends"); extends != nil && extends.Value != "" {
+				return fmt.Errorf("`nodes` might be inherited from %s, add the node there or define `nodes` in this file", extends.Value)
+			}
+		}
+
+		var n yaml.Node
+		if err := n.Encode(node); err != nil {
+			return err
+		}
+		yamledit.PruneEmpty(&n)
+		yamledit.AppendToSequence(cfg, "nodes", &n)
+
+		return nil
+	})
+}
+
+// RemoveNode takes talhelper config bytes and removes the node with
+// `hostname` from `nodes` of `cluster`. The comments and the order of fields
+// in `source` are kept. It returns an error, if any.
+func RemoveNode(source []byte, cluster, hostname string) ([]byte, error) {
+	return editClusterConfig(source, cluster, func(_, cfg *yaml.Node) error {
+		nodes, idx := findNode(cfg, hostname)
+		if idx < 0 {
+			return fmt.Errorf("node %q not found in `nodes`", hostname)
+		}
+		nodes.Content = append(nodes.Content[:idx], nodes.Content[idx+1:]...)
+
+		return nil
+	})
+}
+
+// SetNodeField takes talhelper config bytes and sets `field` of the node with
+// `hostname` in `cluster` to `value`. `field` is a path like `nodeLabels.foo`
+// or `networkInterfaces[0].dhcp` and `value` is parsed as YAML, the field is
+// removed if `value` is `null`. The comments and the order of fields in
+// `source` are kept. It returns an error, if any.
+func SetNodeField(source []byte, cluster, hostname, field, value string) ([]byte, error) {
+	path, err := yamledit.ParsePath(field)
+	if err != nil {
+		return nil, err
+	}
+
+	v := yamledit.NewString(value)
+	if strings.TrimSpace(value) != "" {
+		var parsed yaml.Node
+		if err := yaml.Unmarshal([]byte(value), &parsed); err != nil {
+			return nil, fmt.Errorf("failed to parse value: %s", err)
+		}
+		if len(parsed.Content) > 0 {
+			v = parsed.Content[0]
+		}
+	}
+
+	return editClusterConfig(source, cluster, func(_, cfg *yaml.Node) error {
+		nodes, idx := findNode(cfg, hostname)
+		if idx < 0 {
+			return fmt.Errorf("node %q not found in `nodes`", hostname)
+		}
+		node := nodes.Content[idx]
+
+		if v.Kind == yaml.ScalarNode && v.Tag == "!!null" {
+			if !yamledit.DeletePath(node, path) {
+				return fmt.Errorf("field %q not found in node %q", field, hostname)
+			}
+			return nil
+		}
+
+		return yamledit.SetPath(node, path, v)
+	})
+}
+
+// editClusterConfig takes talhelper config bytes and calls `fn` with the root
+// node and the config node of `cluster`, which is the root node if there's no
+// `clusters`. The edited config is returned. It returns an error, if any.
+func editClusterConfig(source []byte, cluster string, fn func(root, cfg *yaml.Node) error) ([]byte, error) {
+	doc, err := yamledit.Parse(source)
+	if err != nil {
+		return nil, err
+	}
+	root := doc.Root()
+	if root == nil || root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("talhelper config must be a YAML map")
+	}
+
+	cfg, err := selectClusterNode(root, cluster)
+	if err != nil {
+		return nil, err
+	}
+	if err := fn(root, cfg); err != nil {
+		return nil, err
+	}
+
+	return doc.Encode()
+}
+
+// selectClusterNode returns the config node of `cluster` in `root` like
+// `SelectCluster`. It returns an error, if any.
+func selectClusterNode(root *yaml.Node, cluster string) (*yaml.Node, error) {
+	clusters := yamledit.MappingValue(root, "clusters")
+	if clusters == nil || clusters.Kind != yaml.SequenceNode || len(clusters.Content) == 0 {
+		if name := yamledit.MappingValue(root, "clusterName"); cluster != "" && (name == nil || name.Value != cluster) {
+			return nil, fmt.Errorf("cluster %q not found in config file", cluster)
+		}
+		return root, nil
+	}
+
+	var names []string
+	for _, c := range clusters.Content {
+		name := yamledit.MappingValue(c, "clusterName")
+		if name == nil {
+			continue
+		}
+		if name.Value == cluster || (cluster == "" && len(clusters.Content) == 1) {
+			return c, nil
+		}
+		names = append(names, name.Value)
+	}
+
+	if cluster == "" {
+		return nil, fmt.Errorf("multiple clusters found in config file, please select one of: %s", strings.Join(names, ", "))
+	}
+	return nil, fmt.Errorf("cluster %q not found in config file, should be one of: %s", cluster, strings.Join(names, ", "))
+}
+
+// findNode returns `nodes` of `cfg` and the index of the node with `hostname`
+// in it or -1 if not found.
+func findNode(cfg *yaml.Node, hostname string) (*yaml.Node, int) {
+	nodes := yamledit.MappingValue(cfg, "nodes")
+	if nodes == nil || nodes.Kind != yaml.SequenceNode {
+		return nil, -1
+	}
+	for i, n := range nodes.Content {
+		if h := yamledit.MappingValue(n, "hostname"); h != nil && h.Value == hostname {
+			return nodes, i
+		}
+	}
+	return nodes, -1
+}
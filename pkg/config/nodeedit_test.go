@@ -0,0 +1,135 @@
+package config
+
+import (
+	"testing"
+)
+
+func TestEditNodes(t *testing.T) {
+	source := `---
+clusterName: test
+nodes:
+  # controlplane
+  - hostname: cp1
+    ipAddress: 10.0.0.1 # static
+    controlPlane: true
+    installDisk: /dev/sda
+`
+
+	result, err := AddNode([]byte(source), "", Node{Hostname: "worker1", IPAddress: "10.0.0.2", InstallDisk: "/dev/sdb", Groups: []string{"gpu"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err = SetNodeField(result, "test", "worker1", `nodeLabels["topology.kubernetes.io/zone"]`, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err = SetNodeField(result, "", "cp1", "installDisk", "null")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err = SetNodeField(result, "", "cp1", "schematic.customization.extraKernelArgs", "[net.ifnames=0]")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `---
+clusterName: test
+nodes:
+  # controlplane
+  - hostname: cp1
+    ipAddress: 10.0.0.1 # static
+    controlPlane: true
+    schematic:
+      customization:
+        extraKernelArgs: [net.ifnames=0]
+  - hostname: worker1
+    ipAddress: 10.0.0.2
+    groups:
+      - gpu
+    installDisk: /dev/sdb
+    nodeLabels:
+      topology.kubernetes.io/zone: a
+`
+	if string(result) != expected {
+		t.Errorf("got\n%s\nwant\n%s", result, expected)
+	}
+
+	result, err = RemoveNode(result, "", "worker1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewFromByte(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Nodes) != 1 || c.Nodes[0].Hostname != "cp1" {
+		t.Errorf("expected only cp1 to be left, got %+v", c.Nodes)
+	}
+
+	for name, fn := range map[string]func() ([]byte, error){
+		"duplicate hostname": func() ([]byte, error) { return AddNode([]byte(source), "", Node{Hostname: "cp1"}) },
+		"empty hostname":     func() ([]byte, error) { return AddNode([]byte(source), "", Node{}) },
+		"unknown cluster":    func() ([]byte, error) { return AddNode([]byte(source), "prod", Node{Hostname: "worker1"}) },
+		"remove unknown":     func() ([]byte, error) { return RemoveNode([]byte(source), "", "worker1") },
+		"set unknown node":   func() ([]byte, error) { return SetNodeField([]byte(source), "", "worker1", "installDisk", "/dev/sda") },
+		"delete unknown":     func() ([]byte, error) { return SetNodeField([]byte(source), "", "cp1", "nodeLabels", "null") },
+		"invalid path":       func() ([]byte, error) { return SetNodeField([]byte(source), "", "cp1", "nodeLabels.", "a") },
+	} {
+		if _, err := fn(); err == nil {
+			t.Errorf("%s: expected error, got nil", name)
+		}
+	}
+}
+
+func TestEditNodesInClusters(t *testing.T) {
+	source := `clusters:
+  - clusterName: prod
+    nodes:
+      - hostname: cp1
+  - clusterName: staging
+    nodes:
+      - hostname: cp1
+`
+
+	if _, err := RemoveNode([]byte(source), "", "cp1"); err == nil {
+		t.Error("expected error without cluster name for multiple clusters, got nil")
+	}
+
+	result, err := RemoveNode([]byte(source), "staging", "cp1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `clusters:
+  - clusterName: prod
+    nodes:
+      - hostname: cp1
+  - clusterName: staging
+    nodes: []
+`
+	if string(result) != expected {
+		t.Errorf("got\n%s\nwant\n%s", result, expected)
+	}
+}
+
+func TestAddNodeInheritedNodes(t *testing.T) {
+	node := Node{Hostname: "worker1", IPAddress: "10.0.0.2"}
+
+	extends := `clusterName: staging
+extends: base.yaml
+`
+	if _, err := AddNode([]byte(extends), "", node); err == nil {
+		t.Error("expected error when nodes might be inherited from extended file, got nil")
+	}
+	if _, err := AddNode([]byte(extends+"nodes: []\n"), "", node); err != nil {
+		t.Errorf("didn't expect an error when nodes is defined, got %s", err)
+	}
+
+	shared := `nodes:
+  - hostname: cp1
+clusters:
+  - clusterName: prod
+`
+	if _, err := AddNode([]byte(shared), "prod", node); err == nil {
+		t.Error("expected error when nodes is inherited from the top level of clusters, got nil")
+	}
+}
@@ -0,0 +1,184 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+	"net/netip"
+	"slices"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+type nodePoolHostnameTmpl struct {
+	ClusterName string
+	Name        string
+	Index       int
+	IPAddress   string
+}
+
+// GetHostnameTmpl returns `hostnameTmpl` of `p` or the default template if not specified.
+func (p *NodePool) GetHostnameTmpl() string {
+	tmpl := "{{ .Name }}-{{ .Index }}"
+	if p.HostnameTmpl != "" {
+		tmpl = p.HostnameTmpl
+	}
+
+	return tmpl
+}
+
+// GetStartIndex returns `startIndex` of `p` or 1 if not specified.
+func (p *NodePool) GetStartIndex() int {
+	if p.StartIndex != nil {
+		return *p.StartIndex
+	}
+	return 1
+}
+
+// ExpandNodePools appends the nodes of every pool in `c.NodePools` into
+// `c.Nodes` and removes the pools, so the rest of talhelper only has to
+// deal with `c.Nodes`. It returns an error, if any.
+func (c *TalhelperConfig) ExpandNodePools() error {
+	count, pools := len(c.Nodes), make([]int, len(c.NodePools))
+	for i := range c.NodePools {
+		nodes, err := c.NodePools[i].expand(c.ClusterName)
+		if err != nil {
+			return fmt.Errorf("failed to expand `nodePools[%d]`: %s", i, err)
+		}
+		c.Nodes = append(c.Nodes, nodes...)
+		pools[i] = len(nodes)
+	}
+	c.NodePools = nil
+	c.source.expandNodePools(count, pools)
+
+	return nil
+}
+
+// expand returns `p.Count` nodes with hostname rendered from `p.HostnameTmpl`
+// and IP address allocated from `p.IPAddressStart` and `p.IPAddressCIDR`.
+// It returns an error, if any.
+func (p *NodePool) expand(clusterName string) ([]Node, error) {
+	if p.Name == "" {
+		return nil, fmt.Errorf("%q is required to be not empty", "name")
+	}
+	if p.Count < 0 {
+		return nil, fmt.Errorf("%q can't be negative", "count")
+	}
+
+	ips, err := p.allocateIPAddresses()
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := template.New("hostname").Parse(p.GetHostnameTmpl())
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %q: %s", "hostnameTmpl", err)
+	}
+
+	// every node gets its own copy of `NodeConfigs` and the other fields
+	// because some of them are modified in place later (e.g: `machineFiles`
+	// contents)
+	nodeConfigs, err := yaml.Marshal(p.NodeConfigs)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []Node
+	for i, ip := range ips {
+		tmplData := nodePoolHostnameTmpl{
+			ClusterName: clusterName,
+			Name:        p.Name,
+			Index:       p.GetStartIndex() + i,
+			IPAddress:   ip,
+		}
+
+		buf := new(bytes.Buffer)
+		if err := t.Execute(buf, tmplData); err != nil {
+			return nil, fmt.Errorf("failed to render %q: %s", "hostnameTmpl", err)
+		}
+
+		var nc NodeConfigs
+		if err := yaml.Unmarshal(nodeConfigs, &nc); err != nil {
+			return nil, err
+		}
+
+		result = append(result, Node{
+			Hostname:            buf.String(),
+			IPAddress:           ip,
+			ControlPlane:        p.ControlPlane,
+			UpgradeGroup:        p.UpgradeGroup,
+			Groups:              slices.Clone(p.Groups),
+			InstallDisk:         p.InstallDisk,
+			InstallDiskSelector: p.InstallDiskSelector.DeepCopy(),
+			IgnoreHostname:      p.IgnoreHostname,
+			MergeStrategy:       maps.Clone(p.MergeStrategy),
+			Validation:          Validation{Ignore: slices.Clone(p.Validation.Ignore)},
+			NodeConfigs:         nc,
+		})
+	}
+
+	return result, nil
+}
+
+// allocateIPAddresses returns `p.Count` consecutive IP addresses starting from
+// `p.IPAddressStart`, or the first host address of `p.IPAddressCIDR` if it is
+// not specified. If `p.IPAddressCIDR` is specified, every address must be a
+// host address inside it. It returns an error, if any.
+func (p *NodePool) allocateIPAddresses() ([]string, error) {
+	if p.IPAddressStart == "" && p.IPAddressCIDR == "" {
+		return nil, fmt.Errorf("one of %q or %q is required to be not empty", "ipAddressStart", "ipAddressCIDR")
+	}
+
+	var (
+		prefix netip.Prefix
+		addr   netip.Addr
+		err    error
+	)
+
+	if p.IPAddressCIDR != "" {
+		prefix, err = netip.ParsePrefix(p.IPAddressCIDR)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a valid CIDR", p.IPAddressCIDR)
+		}
+		prefix = prefix.Masked()
+		addr = prefix.Addr()
+		// the network address is not a host address unless there's no other address
+		if prefix.Bits() < prefix.Addr().BitLen()-1 {
+			addr = addr.Next()
+		}
+	}
+
+	if p.IPAddressStart != "" {
+		addr, err = netip.ParseAddr(p.IPAddressStart)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a valid IP address", p.IPAddressStart)
+		}
+	}
+
+	var result []string
+	for range p.Count {
+		if prefix.IsValid() && !isHostAddress(prefix, addr) {
+			return nil, fmt.Errorf("not enough IP addresses in %q for %d nodes", p.IPAddressCIDR, p.Count)
+		}
+		if !addr.IsValid() {
+			return nil, fmt.Errorf("not enough IP addresses after %q for %d nodes", p.IPAddressStart, p.Count)
+		}
+		result = append(result, addr.String())
+		addr = addr.Next()
+	}
+
+	return result, nil
+}
+
+// isHostAddress returns true if `addr` is inside `prefix` and it is not the
+// network or broadcast address of an IPv4 `prefix`.
+func isHostAddress(prefix netip.Prefix, addr netip.Addr) bool {
+	if !addr.IsValid() || !prefix.Contains(addr) {
+		return false
+	}
+	if !addr.Is4() || prefix.Bits() >= 31 {
+		return true
+	}
+	return addr != prefix.Addr() && prefix.Contains(addr.Next())
+}
@@ -0,0 +1,162 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/siderolabs/talos/pkg/machinery/config/types/v1alpha1"
+)
+
+func TestAllocateIPAddresses(t *testing.T) {
+	tests := []struct {
+		name     string
+		pool     NodePool
+		expected []string
+		wantErr  bool
+	}{
+		{name: "from CIDR", pool: NodePool{Count: 3, IPAddressCIDR: "10.0.0.0/24"}, expected: []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}},
+		{name: "from start", pool: NodePool{Count: 2, IPAddressStart: "10.0.0.254"}, expected: []string{"10.0.0.254", "10.0.0.255"}},
+		{name: "from start inside CIDR", pool: NodePool{Count: 2, IPAddressCIDR: "10.0.0.0/24", IPAddressStart: "10.0.0.21"}, expected: []string{"10.0.0.21", "10.0.0.22"}},
+		{name: "IPv6", pool: NodePool{Count: 2, IPAddressCIDR: "fd00::/64"}, expected: []string{"fd00::1", "fd00::2"}},
+		{name: "zero count", pool: NodePool{IPAddressCIDR: "10.0.0.0/24"}},
+		{name: "broadcast address", pool: NodePool{Count: 3, IPAddressCIDR: "10.0.0.0/30"}, wantErr: true},
+		{name: "start outside CIDR", pool: NodePool{Count: 1, IPAddressCIDR: "10.0.0.0/24", IPAddressStart: "10.0.1.1"}, wantErr: true},
+		{name: "no IP address", pool: NodePool{Count: 1}, wantErr: true},
+		{name: "invalid CIDR", pool: NodePool{Count: 1, IPAddressCIDR: "10.0.0.0"}, wantErr: true},
+		{name: "invalid start", pool: NodePool{Count: 1, IPAddressStart: "10.0.0"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.pool.allocateIPAddresses()
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("got %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestExpandNodePools(t *testing.T) {
+	startIndex := 0
+	c := &TalhelperConfig{
+		ClusterName: "test",
+		Nodes: []Node{
+			{Hostname: "cp1", IPAddress: "10.0.0.1", ControlPlane: true},
+		},
+		NodePools: []NodePool{
+			{
+				Name:           "worker",
+				Count:          2,
+				IPAddressCIDR:  "10.0.0.0/24",
+				IPAddressStart: "10.0.0.21",
+				InstallDisk:    "/dev/sda",
+				Groups:         []string{"storage"},
+				MergeStrategy:  map[string]string{"patches": "append"},
+				InstallDiskSelector: &v1alpha1.InstallDiskSelector{
+					Model: "WDC*",
+				},
+				NodeConfigs: NodeConfigs{
+					NodeLabels: map[string]string{"pool": "worker"},
+				},
+			},
+			{
+				Name:           "gpu",
+				Count:          1,
+				StartIndex:     &startIndex,
+				HostnameTmpl:   "{{ .ClusterName }}-{{ .Name }}{{ .Index }}",
+				IPAddressStart: "10.0.1.1",
+			},
+		},
+	}
+
+	if err := c.ExpandNodePools(); err != nil {
+		t.Fatal(err)
+	}
+
+	if c.NodePools != nil {
+		t.Errorf("expected nodePools to be removed, got %v", c.NodePools)
+	}
+
+	expected := [][2]string{
+		{"cp1", "10.0.0.1"},
+		{"worker-1", "10.0.0.21"},
+		{"worker-2", "10.0.0.22"},
+		{"test-gpu0", "10.0.1.1"},
+	}
+	if len(c.Nodes) != len(expected) {
+		t.Fatalf("got %d nodes, want %d", len(c.Nodes), len(expected))
+	}
+	for i, e := range expected {
+		if c.Nodes[i].Hostname != e[0] || c.Nodes[i].IPAddress != e[1] {
+			t.Errorf("nodes[%d]: got %s (%s), want %s (%s)", i, c.Nodes[i].Hostname, c.Nodes[i].IPAddress, e[0], e[1])
+		}
+	}
+
+	if c.Nodes[1].InstallDisk != "/dev/sda" || !reflect.DeepEqual(c.Nodes[1].Groups, []string{"storage"}) {
+		t.Errorf("expected pool fields to be copied, got %+v", c.Nodes[1])
+	}
+
+	c.Nodes[1].NodeLabels["foo"] = "bar"
+	if _, ok := c.Nodes[2].NodeLabels["foo"]; ok {
+		t.Error("expected nodes of the same pool to not share node configs")
+	}
+
+	c.Nodes[1].Groups[0] = "foo"
+	c.Nodes[1].MergeStrategy["patches"] = "replace"
+	c.Nodes[1].InstallDiskSelector.Model = "foo"
+	if c.Nodes[2].Groups[0] != "storage" || c.Nodes[2].MergeStrategy["patches"] != "append" || c.Nodes[2].InstallDiskSelector.Model != "WDC*" {
+		t.Errorf("expected nodes of the same pool to not share fields, got %+v", c.Nodes[2])
+	}
+
+	c = &TalhelperConfig{
+		NodePools: []NodePool{{Name: "worker", Count: 1, IPAddressStart: "10.0.0.1", HostnameTmpl: "{{ .Foo }}"}},
+	}
+	if err := c.ExpandNodePools(); err == nil {
+		t.Error("expected error for invalid hostnameTmpl, got nil")
+	}
+}
+
+func TestValidateFromSourceNodePools(t *testing.T) {
+	source := []byte(`clusterName: test
+talosVersion: v1.9.0
+kubernetesVersion: v1.32.0
+endpoint: https://10.0.0.10:6443
+nodes:
+  - hostname: cp1
+    ipAddress: 10.0.0.21
+    controlPlane: true
+    installDisk: /dev/sda
+nodePools:
+  - name: worker
+    count: 2
+    ipAddressStart: 10.0.0.20
+    installDisk: /dev/sda
+`)
+
+	_, warns, err := ValidateFromSource("talconfig.yaml", source, "", false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var found *Warning
+	for _, w := range warns {
+		if w.Kind == "DuplicateNodeIPAddress" {
+			found = w
+		}
+	}
+	if found == nil {
+		t.Fatalf("expected duplicate IP address of pool node, got %v", warns)
+	}
+	if found.Field != "nodes[2].ipAddress" || found.Position.Line != 11 {
+		t.Errorf("got %s at %s, want nodes[2].ipAddress at the pool", found.Field, found.Position)
+	}
+}
@@ -0,0 +1,101 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// NodeSelector selects a subset of `TalhelperConfig.Nodes`.
+// Empty fields match every node.
+type NodeSelector struct {
+	// Nodes is a list of hostname or IP address of the selected nodes.
+	Nodes []string
+	// Role is either `controlplane` or `worker`.
+	Role string
+	// Labels must all be found in `nodeLabels` of the selected nodes.
+	Labels map[string]string
+}
+
+// NewNodeSelector returns `NodeSelector` for `nodes`, `role` and `selectors`
+// in form of `key=value`. It returns an error, if any.
+func NewNodeSelector(nodes []string, role string, selectors []string) (*NodeSelector, error) {
+	if role != "" && role != "controlplane" && role != "worker" {
+		return nil, fmt.Errorf("unknown role %q, should be one of controlplane, worker", role)
+	}
+
+	s := &NodeSelector{Nodes: nodes, Role: role, Labels: map[string]string{}}
+	for _, sel := range selectors {
+		k, v, ok := strings.Cut(sel, "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid selector %q, should be in form of key=value", sel)
+		}
+		s.Labels[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+
+	return s, nil
+}
+
+// IsEmpty returns true if `s` selects every node.
+func (s *NodeSelector) IsEmpty() bool {
+	return s == nil || (len(s.Nodes) == 0 && s.Role == "" && len(s.Labels) == 0)
+}
+
+// Matches returns true if node `n` is selected by `s`.
+func (s *NodeSelector) Matches(n *Node) bool {
+	if s.IsEmpty() {
+		return true
+	}
+
+	if len(s.Nodes) > 0 && !s.matchesNode(n) {
+		return false
+	}
+
+	if s.Role != "" && n.GetRole() != s.Role {
+		return false
+	}
+
+	for k, v := range s.Labels {
+		if label, ok := n.NodeLabels[k]; !ok || label != v {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (s *NodeSelector) matchesNode(n *Node) bool {
+	return slices.ContainsFunc(s.Nodes, n.isHostnameOrIP)
+}
+
+// isHostnameOrIP returns true if `node` is the hostname or one of IP address of `n`.
+func (n *Node) isHostnameOrIP(node string) bool {
+	return node == n.Hostname || n.ContainsIP(node)
+}
+
+// SelectNodes returns the index of nodes in `c.Nodes` selected by `s`.
+// It returns an error if no node is selected or one of `s.Nodes` is not found.
+func (c *TalhelperConfig) SelectNodes(s *NodeSelector) ([]int, error) {
+	var result []int
+	for i := range c.Nodes {
+		if s.Matches(&c.Nodes[i]) {
+			result = append(result, i)
+		}
+	}
+
+	if s.IsEmpty() {
+		return result, nil
+	}
+
+	for _, node := range s.Nodes {
+		if !slices.ContainsFunc(c.Nodes, func(n Node) bool { return n.isHostnameOrIP(node) }) {
+			return nil, fmt.Errorf("node with IP or hostname %s not found", node)
+		}
+	}
+
+	if len(result) == 0 {
+		return nil, fmt.Errorf("no node matches the given selector")
+	}
+
+	return result, nil
+}
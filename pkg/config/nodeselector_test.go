@@ -0,0 +1,64 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSelectNodes(t *testing.T) {
+	c := &TalhelperConfig{
+		Nodes: []Node{
+			{Hostname: "cp1", IPAddress: "10.0.0.1", ControlPlane: true, NodeConfigs: NodeConfigs{NodeLabels: map[string]string{"zone": "a"}}},
+			{Hostname: "worker1", IPAddress: "10.0.0.2, 10.0.0.3", NodeConfigs: NodeConfigs{NodeLabels: map[string]string{"zone": "a", "disk": "ssd"}}},
+			{Hostname: "worker2", IPAddress: "10.0.0.4", NodeConfigs: NodeConfigs{NodeLabels: map[string]string{"zone": "b"}}},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		nodes     []string
+		role      string
+		selectors []string
+		expected  []int
+	}{
+		{name: "all", expected: []int{0, 1, 2}},
+		{name: "by hostname and IP", nodes: []string{"cp1", "10.0.0.3"}, expected: []int{0, 1}},
+		{name: "by role", role: "worker", expected: []int{1, 2}},
+		{name: "by label", selectors: []string{"zone=a"}, expected: []int{0, 1}},
+		{name: "by multiple labels", selectors: []string{"zone=a", "disk=ssd"}, expected: []int{1}},
+		{name: "by role and label", role: "controlplane", selectors: []string{"zone=a"}, expected: []int{0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewNodeSelector(tt.nodes, tt.role, tt.selectors)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := c.SelectNodes(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("got %v, want %v", got, tt.expected)
+			}
+		})
+	}
+
+	s, _ := NewNodeSelector([]string{"worker3"}, "", nil)
+	if _, err := c.SelectNodes(s); err == nil {
+		t.Error("expected error for unknown node, got nil")
+	}
+
+	s, _ = NewNodeSelector(nil, "", []string{"zone=c"})
+	if _, err := c.SelectNodes(s); err == nil {
+		t.Error("expected error when no node is selected, got nil")
+	}
+
+	if _, err := NewNodeSelector(nil, "master", nil); err == nil {
+		t.Error("expected error for unknown role, got nil")
+	}
+	if _, err := NewNodeSelector(nil, "", []string{"zone"}); err == nil {
+		t.Error("expected error for invalid selector, got nil")
+	}
+}
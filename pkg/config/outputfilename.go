@@ -13,16 +13,11 @@ type filenameTmpl struct {
 }
 
 func (n *Node) GetOutputFileName(c *TalhelperConfig) (string, error) {
-	role := "controlplane"
-	if !n.ControlPlane {
-		role = "worker"
-	}
-
 	tmplData := filenameTmpl{
 		ClusterName: c.ClusterName,
 		Hostname:    n.Hostname,
 		IPAddress:   n.IPAddress,
-		Role:        role,
+		Role:        n.GetRole(),
 	}
 
 	t, err := template.New("filename").Parse(n.GetFilenameTmpl())
@@ -1,17 +1,28 @@
 package config
 
 import (
-	"github.com/budimanjojo/talhelper/v3/pkg/patcher"
+	"github.com/budimanjojo/talhelper/v3/pkg/yamledit"
 	"gopkg.in/yaml.v3"
 )
 
+// ApplyInlinePatch applies JSON Merge Patch `patch` into Talhelper config and
+// returns it as yaml bytes with the order of fields kept. It also returns an
+// error, if any.
 func (c *TalhelperConfig) ApplyInlinePatch(patch []byte) ([]byte, error) {
-	cfg, err := yaml.Marshal(c)
+	var node yaml.Node
+	if err := node.Encode(c); err != nil {
+		return nil, err
+	}
+
+	p, err := yamledit.Parse(patch)
 	if err != nil {
 		return nil, err
 	}
+	if root := p.Root(); root != nil {
+		yamledit.MergePatch(&node, root)
+	}
 
-	cfg, err = patcher.JSON7396FromYAML(patch, cfg)
+	cfg, err := yamledit.Encode(&node)
 	if err != nil {
 		return nil, err
 	}
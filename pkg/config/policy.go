@@ -0,0 +1,410 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/hashicorp/go-multierror"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// PolicyTargetConfig rules are evaluated once against the talhelper config.
+	PolicyTargetConfig = "config"
+	// PolicyTargetNode rules are evaluated against every node of the
+	// talhelper config.
+	PolicyTargetNode = "node"
+	// PolicyTargetMachineConfig rules are evaluated against the generated
+	// Talos machine config of every node.
+	PolicyTargetMachineConfig = "machineconfig"
+)
+
+// PolicyTargets are the supported `PolicyRule` targets.
+var PolicyTargets = []string{PolicyTargetConfig, PolicyTargetNode, PolicyTargetMachineConfig}
+
+// Policy is a set of custom validation rules written in CEL.
+type Policy struct {
+	Rules []PolicyRule `yaml:"rules"`
+}
+
+// PolicyRule is a custom validation rule. The `Expression` must evaluate to
+// true, otherwise `Message` is reported as an `Error` (or a `Warning`) for
+// `Field`.
+type PolicyRule struct {
+	// Name is the `Kind` of the reported issues, it must be unique and can be
+	// used in `validate.ignore`.
+	Name string `yaml:"name"`
+	// Target is one of `PolicyTargets`, defaults to `PolicyTargetNode`.
+	Target string `yaml:"target,omitempty"`
+	// Match is a CEL expression selecting where the rule is evaluated, the
+	// rule is evaluated everywhere if it's empty.
+	Match string `yaml:"match,omitempty"`
+	// Expression is the CEL expression that must evaluate to true.
+	Expression string `yaml:"expression"`
+	// Field is the field the issue is reported for. It's relative to the node
+	// for `PolicyTargetNode` and `PolicyTargetMachineConfig` and required for
+	// `PolicyTargetConfig`.
+	Field   string `yaml:"field,omitempty"`
+	Message string `yaml:"message"`
+	// Severity is either "error" or "warning", defaults to "error".
+	Severity string `yaml:"severity,omitempty"`
+
+	match      cel.Program
+	expression cel.Program
+}
+
+// LoadPolicyFromFiles loads and compiles the rules of every policy file in
+// `paths` into a single `Policy`. It returns nil if `paths` is empty.
+// It returns an error, if any.
+func LoadPolicyFromFiles(paths []string) (*Policy, error) {
+	if len(paths) == 0 {
+		return nil, nil
+	}
+
+	result := &Policy{}
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read policy file: %s", err)
+		}
+
+		p, err := NewPolicyFromByte(content)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load policy file %s: %s", path, err)
+		}
+		for _, r := range p.Rules {
+			if result.hasRule(r.Name) {
+				return nil, fmt.Errorf("failed to load policy file %s: rule %q is already defined", path, r.Name)
+			}
+			result.Rules = append(result.Rules, r)
+		}
+	}
+
+	return result, nil
+}
+
+// NewPolicyFromByte takes bytes of a policy file, converts it into `Policy`
+// and compiles its rules. It returns an error, if any.
+func NewPolicyFromByte(source []byte) (*Policy, error) {
+	var result Policy
+
+	dec := yaml.NewDecoder(bytes.NewReader(source))
+	dec.KnownFields(true)
+	if err := dec.Decode(&result); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	env, err := newPolicyEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for i := range result.Rules {
+		r := &result.Rules[i]
+		if err := r.compile(env); err != nil {
+			return nil, fmt.Errorf("rules[%d]: %s", i, err)
+		}
+		if slices.Contains(names, r.Name) {
+			return nil, fmt.Errorf("rules[%d]: rule %q is already defined", i, r.Name)
+		}
+		names = append(names, r.Name)
+	}
+
+	return &result, nil
+}
+
+// newPolicyEnv returns the CEL environment of the policy rules. `config` is
+// the talhelper config, `node` is the node being evaluated, `machineconfig`
+// is the v1alpha1 document of the generated Talos machine config and
+// `documents` are every document of it.
+func newPolicyEnv() (*cel.Env, error) {
+	return cel.NewEnv(
+		cel.Variable("config", cel.DynType),
+		cel.Variable("node", cel.DynType),
+		cel.Variable("machineconfig", cel.DynType),
+		cel.Variable("documents", cel.ListType(cel.DynType)),
+	)
+}
+
+func (r *PolicyRule) compile(env *cel.Env) error {
+	switch {
+	case r.Name == "":
+		return fmt.Errorf("`name` is required")
+	case r.Expression == "":
+		return fmt.Errorf("`expression` of %q is required", r.Name)
+	case r.Message == "":
+		return fmt.Errorf("`message` of %q is required", r.Name)
+	}
+	if _, ok := GetRule(r.Name); ok {
+		return fmt.Errorf("%q is already a built-in validation rule", r.Name)
+	}
+
+	if r.Target == "" {
+		r.Target = PolicyTargetNode
+	}
+	if !slices.Contains(PolicyTargets, r.Target) {
+		return fmt.Errorf("`target` of %q should be one of %v", r.Name, PolicyTargets)
+	}
+	if r.Target == PolicyTargetConfig && r.Field == "" {
+		return fmt.Errorf("`field` of %q is required for %q target", r.Name, PolicyTargetConfig)
+	}
+
+	if r.Severity == "" {
+		r.Severity = "error"
+	}
+	if r.Severity != "error" && r.Severity != "warning" {
+		return fmt.Errorf("`severity` of %q should be either error or warning", r.Name)
+	}
+
+	var err error
+	if r.Match != "" {
+		if r.match, err = compilePolicyExpression(env, r.Match); err != nil {
+			return fmt.Errorf("`match` of %q: %s", r.Name, err)
+		}
+	}
+	if r.expression, err = compilePolicyExpression(env, r.Expression); err != nil {
+		return fmt.Errorf("`expression` of %q: %s", r.Name, err)
+	}
+
+	return nil
+}
+
+// compilePolicyExpression compiles `expr` that must return a boolean.
+func compilePolicyExpression(env *cel.Env, expr string) (cel.Program, error) {
+	ast, iss := env.Compile(expr)
+	if iss.Err() != nil {
+		return nil, iss.Err()
+	}
+	if t := ast.OutputType(); !t.IsExactType(cel.BoolType) && !t.IsExactType(cel.DynType) {
+		return nil, fmt.Errorf("should return bool, got %s", t)
+	}
+
+	return env.Program(ast)
+}
+
+// hasRule returns true if `p` has a rule named `name`.
+func (p *Policy) hasRule(name string) bool {
+	if p == nil {
+		return false
+	}
+	return slices.ContainsFunc(p.Rules, func(r PolicyRule) bool { return r.Name == name })
+}
+
+// getRule returns the rule of `p` named `name` and whether it's found.
+func (p *Policy) getRule(name string) (PolicyRule, bool) {
+	if p == nil {
+		return PolicyRule{}, false
+	}
+	idx := slices.IndexFunc(p.Rules, func(r PolicyRule) bool { return r.Name == name })
+	if idx < 0 {
+		return PolicyRule{}, false
+	}
+	return p.Rules[idx], true
+}
+
+// checkPolicy evaluates the rules of `p` with `PolicyTargetConfig` and
+// `PolicyTargetNode` target against `c`.
+func checkPolicy(c TalhelperConfig, p *Policy, result *Errors, warns *Warnings) (*Errors, *Warnings) {
+	if p == nil {
+		return result, warns
+	}
+
+	vars, nodes, err := policyConfigVars(c)
+	if err != nil {
+		result.Append(&Error{
+			Kind:    "InvalidPolicy",
+			Field:   "policy",
+			Message: formatError(multierror.Append(fmt.Errorf("failed to convert config for policy: %s", err))),
+		})
+		return result, warns
+	}
+
+	for _, r := range p.Rules {
+		switch r.Target {
+		case PolicyTargetConfig:
+			r.evaluate(vars, r.Field, result, warns)
+		case PolicyTargetNode:
+			for k := range c.Nodes {
+				if k < len(nodes) {
+					vars["node"] = nodes[k]
+				}
+				r.evaluate(vars, r.nodeField(k), result, warns)
+			}
+		}
+	}
+
+	return result, warns
+}
+
+// ValidateMachineConfigs evaluates the rules of `p` with
+// `PolicyTargetMachineConfig` target against `cfgs`, which are the generated
+// Talos machine configs of the nodes of `c` at `nodes` index.
+func (p *Policy) ValidateMachineConfigs(c TalhelperConfig, nodes []int, cfgs [][]byte) (Errors, Warnings) {
+	var (
+		result Errors
+		warns  Warnings
+	)
+	if p == nil || !slices.ContainsFunc(p.Rules, func(r PolicyRule) bool { return r.Target == PolicyTargetMachineConfig }) {
+		return result, warns
+	}
+
+	vars, nodeVars, err := policyConfigVars(c)
+	if err != nil {
+		result.Append(&Error{
+			Kind:    "InvalidPolicy",
+			Field:   "policy",
+			Message: formatError(multierror.Append(fmt.Errorf("failed to convert config for policy: %s", err))),
+		})
+		return result, warns
+	}
+
+	for i, idx := range nodes {
+		node := c.Nodes[idx]
+		docs, err := decodeDocuments(cfgs[i])
+		if err != nil {
+			result.Append(&Error{
+				Kind:    "InvalidPolicy",
+				Field:   getNodeFieldYamlTag(node, idx, "Hostname"),
+				Message: formatError(multierror.Append(fmt.Errorf("failed to convert machine config for policy: %s", err))),
+			})
+			continue
+		}
+
+		if idx < len(nodeVars) {
+			vars["node"] = nodeVars[idx]
+		}
+		vars["documents"] = docs
+		vars["machineconfig"] = map[string]any{}
+		for _, doc := range docs {
+			if m, ok := doc.(map[string]any); ok && m["version"] == "v1alpha1" {
+				vars["machineconfig"] = m
+				break
+			}
+		}
+
+		for _, r := range p.Rules {
+			if r.Target == PolicyTargetMachineConfig {
+				r.evaluate(vars, r.nodeField(idx), &result, &warns)
+			}
+		}
+	}
+
+	c.resolveIssues(result, warns)
+
+	return result, warns
+}
+
+// evaluate reports `r` for `field` if its `Match` is true and its
+// `Expression` is false with `vars`. Failing to evaluate them is reported
+// as an error.
+func (r PolicyRule) evaluate(vars map[string]any, field string, result *Errors, warns *Warnings) {
+	if r.match != nil {
+		ok, err := evalPolicyProgram(r.match, vars)
+		if err != nil {
+			result.Append(&Error{
+				Kind:    r.Name,
+				Field:   field,
+				Message: formatError(multierror.Append(fmt.Errorf("failed to evaluate `match` of policy rule: %s", err))),
+			})
+			return
+		}
+		if !ok {
+			return
+		}
+	}
+
+	ok, err := evalPolicyProgram(r.expression, vars)
+	switch {
+	case err != nil:
+		result.Append(&Error{
+			Kind:    r.Name,
+			Field:   field,
+			Message: formatError(multierror.Append(fmt.Errorf("failed to evaluate `expression` of policy rule: %s", err))),
+		})
+	case ok:
+	case r.Severity == "warning":
+		warns.Append(&Warning{
+			Kind:    r.Name,
+			Field:   field,
+			Message: formatWarning(r.Message),
+		})
+	default:
+		result.Append(&Error{
+			Kind:    r.Name,
+			Field:   field,
+			Message: formatError(multierror.Append(errors.New(r.Message))),
+		})
+	}
+}
+
+// nodeField returns the field of the node at `idx` the issues of `r` are
+// reported for.
+func (r PolicyRule) nodeField(idx int) string {
+	if r.Field == "" {
+		return fmt.Sprintf("nodes[%d]", idx)
+	}
+	return fmt.Sprintf("nodes[%d].%s", idx, r.Field)
+}
+
+func evalPolicyProgram(prg cel.Program, vars map[string]any) (bool, error) {
+	out, _, err := prg.Eval(vars)
+	if err != nil {
+		return false, err
+	}
+	result, ok := out.(types.Bool)
+	if !ok {
+		return false, fmt.Errorf("should return bool, got %s", out.Type().TypeName())
+	}
+	return bool(result), nil
+}
+
+// policyConfigVars returns the variables of the policy rules with `config`
+// set to `c` and the nodes of `c`.
+func policyConfigVars(c TalhelperConfig) (map[string]any, []any, error) {
+	content, err := yaml.Marshal(c)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var cfg map[string]any
+	if err := yaml.Unmarshal(content, &cfg); err != nil {
+		return nil, nil, err
+	}
+
+	nodes, _ := cfg["nodes"].([]any)
+	vars := map[string]any{
+		"config":        cfg,
+		"node":          map[string]any{},
+		"machineconfig": map[string]any{},
+		"documents":     []any{},
+	}
+
+	return vars, nodes, nil
+}
+
+// decodeDocuments returns every YAML document in `content`.
+func decodeDocuments(content []byte) ([]any, error) {
+	var result []any
+
+	dec := yaml.NewDecoder(bytes.NewReader(content))
+	for {
+		var doc any
+		err := dec.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			return result, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if doc != nil {
+			result = append(result, doc)
+		}
+	}
+}
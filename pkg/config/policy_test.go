@@ -0,0 +1,171 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const policyTestRules = `rules:
+  - name: WorkerZoneLabel
+    match: '!node.controlPlane'
+    expression: '"zone" in node.nodeLabels'
+    field: nodeLabels
+    message: worker nodes need a zone label
+  - name: InstallDiskSelector
+    expression: '!has(node.installDisk)'
+    field: installDisk
+    message: use installDiskSelector instead of installDisk
+    severity: warning
+  - name: ProdSchedulingOnControlPlanes
+    target: config
+    match: config.clusterName == "prod"
+    expression: '!config.allowSchedulingOnControlPlanes'
+    field: allowSchedulingOnControlPlanes
+    message: workloads are not allowed on controlplane nodes in prod
+  - name: MachineConfigSchedulingOnControlPlanes
+    target: machineconfig
+    expression: '!has(machineconfig.cluster.allowSchedulingOnControlPlanes) || !machineconfig.cluster.allowSchedulingOnControlPlanes'
+    message: workloads are not allowed on controlplane nodes
+`
+
+func TestPolicy(t *testing.T) {
+	p, err := NewPolicyFromByte([]byte(policyTestRules))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewFromByte([]byte(`clusterName: prod
+allowSchedulingOnControlPlanes: true
+nodes:
+  - hostname: cp1
+    controlPlane: true
+    installDiskSelector:
+      size: ">= 100GB"
+  - hostname: worker1
+    installDisk: /dev/sda
+    nodeLabels:
+      zone: a
+    validate:
+      ignore:
+        - InstallDiskSelector
+  - hostname: worker2
+    installDiskSelector:
+      size: ">= 100GB"
+    validate:
+      ignore:
+        - WorkerZoneLabel
+  - hostname: worker3
+    installDiskSelector:
+      size: ">= 100GB"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errs, warns := c.ValidateWithPolicy(p)
+	found := make(map[string]bool)
+	for _, e := range errs {
+		if p.hasRule(e.Kind) {
+			found[e.Kind+" "+e.Field] = false
+		}
+	}
+	for _, w := range warns {
+		if p.hasRule(w.Kind) {
+			found[w.Kind+" "+w.Field] = w.Suppressed
+		}
+	}
+
+	expected := map[string]bool{
+		"ProdSchedulingOnControlPlanes allowSchedulingOnControlPlanes": false,
+		"InstallDiskSelector nodes[1].installDisk":                     true,
+		"WorkerZoneLabel nodes[2].nodeLabels":                          false,
+		"WorkerZoneLabel nodes[3].nodeLabels":                          false,
+	}
+	if len(found) != len(expected) {
+		t.Errorf("got %v, want %v", found, expected)
+	}
+	for k, v := range expected {
+		if s, ok := found[k]; !ok || s != v {
+			t.Errorf("%s: got suppressed %t (found %t), want %t", k, s, ok, v)
+		}
+	}
+	if !warns.HasField("nodes[1].installDisk") {
+		t.Error("expected InstallDiskSelector to be a warning")
+	}
+	if warns.HasField("nodes[1].validate.ignore") {
+		t.Error("expected policy rule to be a known validate.ignore kind")
+	}
+	if !warns.HasField("nodes[2].validate.ignore") {
+		t.Error("expected ignoring policy error rule to be warned")
+	}
+
+	cfgs := [][]byte{
+		[]byte("version: v1alpha1\ncluster:\n  allowSchedulingOnControlPlanes: true\n---\napiVersion: v1alpha1\nkind: HostnameConfig\n"),
+		[]byte("version: v1alpha1\ncluster: {}\n"),
+	}
+	errs, _ = p.ValidateMachineConfigs(*c, []int{0, 1}, cfgs)
+	if len(errs) != 1 || errs[0].Field != "nodes[0]" || errs[0].Kind != "MachineConfigSchedulingOnControlPlanes" {
+		t.Errorf("unexpected machine config errors: %v", errs)
+	}
+}
+
+func TestPolicyEvaluationError(t *testing.T) {
+	p, err := NewPolicyFromByte([]byte(`rules:
+  - name: Foo
+    expression: node.foo == "bar"
+    message: foo
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewFromByte([]byte("nodes:\n  - hostname: node1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs, _ := c.ValidateWithPolicy(p)
+	if !errs.HasField("nodes[0]") {
+		t.Errorf("expected evaluation error for nodes[0], got %v", errs)
+	}
+}
+
+func TestNewPolicyFromByteInvalid(t *testing.T) {
+	tests := map[string]string{
+		"`name` is required":             "rules:\n  - expression: 'true'\n    message: foo\n",
+		"already a built-in":             "rules:\n  - name: NodesRequired\n    expression: 'true'\n    message: foo\n",
+		"`target` of \"Foo\"":            "rules:\n  - name: Foo\n    target: bar\n    expression: 'true'\n    message: foo\n",
+		"`field` of \"Foo\" is required": "rules:\n  - name: Foo\n    target: config\n    expression: 'true'\n    message: foo\n",
+		"should return bool":             "rules:\n  - name: Foo\n    expression: '1 + 1'\n    message: foo\n",
+		"`expression` of \"Foo\"":        "rules:\n  - name: Foo\n    expression: 'node.'\n    message: foo\n",
+		"already defined":                "rules:\n  - name: Foo\n    expression: 'true'\n    message: foo\n  - name: Foo\n    expression: 'true'\n    message: foo\n",
+		"field foo not found":            "foo: bar\n",
+	}
+	for expected, source := range tests {
+		if _, err := NewPolicyFromByte([]byte(source)); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%s: got %v", expected, err)
+		}
+	}
+}
+
+func TestLoadPolicyFromFiles(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.yaml"), filepath.Join(dir, "b.yaml")
+	if err := os.WriteFile(a, []byte(policyTestRules), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(b, []byte("rules:\n  - name: WorkerZoneLabel\n    expression: 'true'\n    message: foo\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if p, err := LoadPolicyFromFiles(nil); p != nil || err != nil {
+		t.Errorf("got %v, %v, want nil", p, err)
+	}
+	if p, err := LoadPolicyFromFiles([]string{a}); err != nil || len(p.Rules) != 4 {
+		t.Errorf("got %v, %v", p, err)
+	}
+	if _, err := LoadPolicyFromFiles([]string{a, b}); err == nil || !strings.Contains(err.Error(), "already defined") {
+		t.Errorf("expected duplicated rule error, got %v", err)
+	}
+}
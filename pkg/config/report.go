@@ -0,0 +1,459 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/hashicorp/go-multierror"
+)
+
+const (
+	// ReportText is the human readable report format.
+	ReportText = "text"
+	// ReportJSON is the report format of a JSON array of `Finding`.
+	ReportJSON = "json"
+	// ReportSARIF is the report format of SARIF 2.1.0 log.
+	ReportSARIF = "sarif"
+	// ReportGitHub is the report format of GitHub Actions workflow commands.
+	ReportGitHub = "github"
+)
+
+// codeFrameContext is the number of lines shown before and after the line of
+// an issue in the code frame of text report.
+const codeFrameContext = 1
+
+// ReportFormats are the supported report formats.
+var ReportFormats = []string{ReportText, ReportJSON, ReportSARIF, ReportGitHub}
+
+// Finding is a validation `Error` or `Warning` with the position of its field
+// in the talhelper config file. `Line` and `Column` are zero if the field
+// can't be found in the file.
+type Finding struct {
+	Level      string `json:"level"`
+	ID         string `json:"id,omitempty"`
+	Kind       string `json:"kind"`
+	Field      string `json:"field"`
+	Message    string `json:"message"`
+	File       string `json:"file,omitempty"`
+	Line       int    `json:"line,omitempty"`
+	Column     int    `json:"column,omitempty"`
+	Suppressed bool   `json:"suppressed,omitempty"`
+}
+
+// NewFindings returns `errs` and `warns` as `Finding`.
+func NewFindings(errs Errors, warns Warnings) []Finding {
+	var result []Finding
+
+	for _, e := range errs {
+		f := newFinding("error", e.Kind, e.Field, errorMessages(e.Message), e.Position)
+		f.ID = e.ID
+		result = append(result, f)
+	}
+	for _, w := range warns {
+		msg := strings.TrimPrefix(strings.TrimSpace(w.Message), "* WARNING: ")
+		f := newFinding("warning", w.Kind, w.Field, []string{msg}, w.Position)
+		f.ID, f.Suppressed = w.ID, w.Suppressed
+		result = append(result, f)
+	}
+
+	return result
+}
+
+// WriteReport writes `findings` into `w` in `format` which is one of
+// `ReportFormats`. Nothing is written for `ReportText` if `findings` is
+// empty. Suppressed findings are only counted in the summary, except for
+// `ReportJSON` and `ReportSARIF` which have them marked as suppressed.
+// It returns an error, if any.
+func WriteReport(w io.Writer, format string, findings []Finding) error {
+	switch format {
+	case ReportText, "":
+		return writeTextReport(w, findings)
+	case ReportJSON:
+		if findings == nil {
+			findings = []Finding{}
+		}
+		return writeJSON(w, findings)
+	case ReportSARIF:
+		return writeJSON(w, newSarifLog(findings))
+	case ReportGitHub:
+		return writeGitHubReport(w, findings)
+	default:
+		return fmt.Errorf("unknown report format %q, should be one of: %s", format, strings.Join(ReportFormats, ", "))
+	}
+}
+
+// Reporter writes validation issues like `LoadAndReportClusterFromFile`.
+type Reporter struct {
+	// Format is one of `ReportFormats`, defaults to `ReportText`.
+	Format string
+	// Output is where the report is written to, defaults to `os.Stderr`.
+	Output io.Writer
+	// Ignore are the IDs or kinds of the warning rules to suppress like the
+	// ones in `validate.ignore`, errors are never suppressed.
+	Ignore []string
+	// ShowWarns reports warnings too.
+	ShowWarns bool
+}
+
+// Report writes `errs` and `warns` with the rules in `Ignore` suppressed.
+// It returns an error if there is any of `errs` or the report can't be
+// written.
+func (r *Reporter) Report(errs Errors, warns Warnings) error {
+	if r == nil {
+		r = &Reporter{}
+	}
+	w := r.Output
+	if w == nil {
+		w = os.Stderr
+	}
+
+	warns = warns.Ignore(r.Ignore)
+	if !r.ShowWarns {
+		warns = nil
+	}
+
+	if err := WriteReport(w, r.Format, NewFindings(errs, warns)); err != nil {
+		return fmt.Errorf("failed to write validation report: %s", err)
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("please fix issues with your config file")
+	}
+
+	return nil
+}
+
+func newFinding(level, kind, field string, messages []string, pos Position) Finding {
+	return Finding{
+		Level:   level,
+		Kind:    kind,
+		Field:   field,
+		Message: strings.Join(messages, "\n"),
+		File:    pos.File,
+		Line:    pos.Line,
+		Column:  pos.Column,
+	}
+}
+
+// errorMessages returns the messages in `err` without the bullet points
+// added by `formatError`.
+func errorMessages(err error) []string {
+	if err == nil {
+		return nil
+	}
+
+	var merr *multierror.Error
+	if !errors.As(err, &merr) {
+		return []string{err.Error()}
+	}
+
+	var result []string
+	for _, e := range merr.Errors {
+		result = append(result, e.Error())
+	}
+	return result
+}
+
+func writeTextReport(w io.Writer, findings []Finding) error {
+	var fields []string
+	grouped := make(map[string][]Finding)
+	for _, f := range findings {
+		if f.Suppressed {
+			continue
+		}
+		if _, ok := grouped[f.Field]; !ok {
+			fields = append(fields, f.Field)
+		}
+		grouped[f.Field] = append(grouped[f.Field], f)
+	}
+
+	if len(fields) > 0 {
+		color.New(color.FgRed).Fprintln(w, "There are issues with your talhelper config file:")
+	}
+	sources := make(map[string][]string)
+	for _, field := range fields {
+		list := grouped[field]
+		pos := list[0].position()
+		if pos.String() != "" {
+			color.New(color.FgYellow).Fprintf(w, "field: %q (%s)\n", field, pos)
+		} else {
+			color.New(color.FgYellow).Fprintf(w, "field: %q\n", field)
+		}
+
+		for _, f := range list {
+			for _, msg := range strings.Split(f.Message, "\n") {
+				if f.Level == "warning" {
+					msg = "WARNING: " + msg
+				}
+				if f.ID != "" {
+					msg = fmt.Sprintf("%s [%s]", msg, f.ID)
+				}
+				if _, err := fmt.Fprintf(w, "  * %s\n", msg); err != nil {
+					return err
+				}
+			}
+		}
+
+		if pos.File == "" || pos.Line == 0 {
+			continue
+		}
+		lines, ok := sources[pos.File]
+		if !ok {
+			if b, err := os.ReadFile(pos.File); err == nil {
+				lines = strings.Split(string(b), "\n")
+			}
+			sources[pos.File] = lines
+		}
+		if _, err := io.WriteString(w, codeFrame(lines, pos.Line, pos.Column)); err != nil {
+			return err
+		}
+	}
+
+	if summary := ignoreSummary(findings); summary != "" {
+		color.New(color.FgYellow).Fprintln(w, summary)
+	}
+
+	return nil
+}
+
+// codeFrame returns the lines around `line` of `lines` with the line number
+// and a marker pointing to `column`, like how compilers show errors:
+//
+//	  2 | talosVersion: v1.9.0
+//	> 3 | kubernetesVersion: foo
+//	    |                    ^
+//	  4 | endpoint: https://192.168.200.10:6443
+func codeFrame(lines []string, line, column int) string {
+	if line < 1 || line > len(lines) {
+		return ""
+	}
+
+	first, last := max(line-codeFrameContext, 1), min(line+codeFrameContext, len(lines))
+	width := len(strconv.Itoa(last))
+
+	var b strings.Builder
+	for i := first; i <= last; i++ {
+		marker := " "
+		if i == line {
+			marker = ">"
+		}
+		fmt.Fprintf(&b, "  %s %*d | %s\n", marker, width, i, strings.TrimRight(lines[i-1], "\r"))
+		if i == line && column > 0 {
+			fmt.Fprintf(&b, "    %s | %s^\n", strings.Repeat(" ", width), strings.Repeat(" ", column-1))
+		}
+	}
+
+	return b.String()
+}
+
+// position returns the position of `f`.
+func (f Finding) position() Position {
+	return Position{File: f.File, Line: f.Line, Column: f.Column}
+}
+
+func writeJSON(w io.Writer, v any) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// writeGitHubReport writes `findings` as GitHub Actions workflow commands so
+// they are shown as annotations.
+// See https://docs.github.com/en/actions/reference/workflow-commands-for-github-actions
+func writeGitHubReport(w io.Writer, findings []Finding) error {
+	for _, f := range findings {
+		if f.Suppressed {
+			continue
+		}
+
+		props := []string{}
+		if f.File != "" {
+			props = append(props, "file="+escapeGitHubProperty(f.File))
+			if f.Line > 0 {
+				props = append(props, fmt.Sprintf("line=%d", f.Line), fmt.Sprintf("col=%d", f.Column))
+			}
+		}
+		props = append(props, "title="+escapeGitHubProperty(ruleName(f)))
+
+		msg := fmt.Sprintf("%s: %s", f.Field, f.Message)
+		if _, err := fmt.Fprintf(w, "::%s %s::%s\n", f.Level, strings.Join(props, ","), escapeGitHubData(msg)); err != nil {
+			return err
+		}
+	}
+
+	if summary := ignoreSummary(findings); summary != "" {
+		if _, err := fmt.Fprintf(w, "::notice title=talhelper::%s\n", escapeGitHubData(summary)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ruleName returns the ID and `Kind` of `f` like "TH005 UnreleasedTalosVersion".
+func ruleName(f Finding) string {
+	if f.ID == "" {
+		return f.Kind
+	}
+	return f.ID + " " + f.Kind
+}
+
+func escapeGitHubData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+func escapeGitHubProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID   string `json:"id"`
+	Name string `json:"name,omitempty"`
+}
+
+type sarifResult struct {
+	RuleID       string             `json:"ruleId"`
+	Level        string             `json:"level"`
+	Message      sarifMessage       `json:"message"`
+	Locations    []sarifLocation    `json:"locations,omitempty"`
+	Suppressions []sarifSuppression `json:"suppressions,omitempty"`
+}
+
+type sarifSuppression struct {
+	Kind string `json:"kind"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+}
+
+// newSarifLog returns `findings` as SARIF 2.1.0 log with every `Kind` as
+// a rule.
+func newSarifLog(findings []Finding) sarifLog {
+	driver := sarifDriver{
+		Name:           "talhelper",
+		InformationURI: "https://github.com/budimanjojo/talhelper",
+		Rules:          []sarifRule{},
+	}
+	results := []sarifResult{}
+
+	var ids []string
+	for _, f := range findings {
+		id := f.ID
+		if id == "" {
+			id = f.Kind
+		}
+		if !slices.Contains(ids, id) {
+			ids = append(ids, id)
+			driver.Rules = append(driver.Rules, sarifRule{ID: id, Name: f.Kind})
+		}
+
+		r := sarifResult{
+			RuleID:  id,
+			Level:   f.Level,
+			Message: sarifMessage{Text: fmt.Sprintf("%s: %s", f.Field, f.Message)},
+		}
+		if f.Suppressed {
+			r.Suppressions = []sarifSuppression{{Kind: "external"}}
+		}
+		if f.File != "" {
+			loc := sarifLocation{
+				PhysicalLocation: sarifPhysicalLocation{
+					ArtifactLocation: sarifArtifactLocation{URI: f.File},
+				},
+			}
+			if f.Line > 0 {
+				loc.PhysicalLocation.Region = &sarifRegion{StartLine: f.Line, StartColumn: f.Column}
+			}
+			r.Locations = append(r.Locations, loc)
+		}
+		results = append(results, r)
+	}
+
+	return sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{{Tool: sarifTool{Driver: driver}, Results: results}},
+	}
+}
+
+// ignoreSummary returns the number of suppressed `findings` by their kind like
+// "3 issues are ignored: UnreleasedTalosVersion (2), EvenControlPlaneNodes (1)"
+// or empty string if none of them is suppressed.
+func ignoreSummary(findings []Finding) string {
+	var (
+		kinds  []string
+		counts = map[string]int{}
+		total  int
+	)
+	for _, f := range findings {
+		if !f.Suppressed {
+			continue
+		}
+		if counts[f.Kind] == 0 {
+			kinds = append(kinds, f.Kind)
+		}
+		counts[f.Kind]++
+		total++
+	}
+	if total == 0 {
+		return ""
+	}
+
+	list := make([]string, len(kinds))
+	for i, k := range kinds {
+		list[i] = fmt.Sprintf("%s (%d)", k, counts[k])
+	}
+
+	noun := "issues are"
+	if total == 1 {
+		noun = "issue is"
+	}
+	return fmt.Sprintf("%d %s ignored: %s", total, noun, strings.Join(list, ", "))
+}
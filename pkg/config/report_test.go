@@ -0,0 +1,209 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/fatih/color"
+	"github.com/hashicorp/go-multierror"
+)
+
+func reportTestFindings() []Finding {
+	errs := Errors{
+		{
+			Kind:     "InvalidInstallDisk",
+			Field:    "nodes[1].installDisk",
+			Message:  formatError(multierror.Append(errors.New("first"), errors.New("second"))),
+			Position: Position{File: "talconfig.yaml", Line: 9, Column: 5},
+		},
+	}
+	warns := Warnings{
+		{
+			Kind:     "UnreleasedTalosVersion",
+			Field:    "endpoint",
+			Message:  formatWarning("100% sure, maybe"),
+			Position: Position{File: "talconfig.yaml", Line: 2, Column: 1},
+		},
+	}
+
+	return NewFindings(errs, warns)
+}
+
+func TestNewFindings(t *testing.T) {
+	expected := []Finding{
+		{
+			Level:   "error",
+			Kind:    "InvalidInstallDisk",
+			Field:   "nodes[1].installDisk",
+			Message: "first\nsecond",
+			File:    "talconfig.yaml",
+			Line:    9,
+			Column:  5,
+		},
+		{
+			Level:   "warning",
+			Kind:    "UnreleasedTalosVersion",
+			Field:   "endpoint",
+			Message: "100% sure, maybe",
+			File:    "talconfig.yaml",
+			Line:    2,
+			Column:  1,
+		},
+	}
+
+	result := reportTestFindings()
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("got %+v, want %+v", result, expected)
+	}
+
+	result = NewFindings(Errors{{Kind: "Foo", Field: "bar", Message: errors.New("baz")}}, nil)
+	expected = []Finding{{Level: "error", Kind: "Foo", Field: "bar", Message: "baz"}}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("got %+v, want %+v", result, expected)
+	}
+}
+
+func TestWriteReport(t *testing.T) {
+	color.NoColor = true
+
+	tests := map[string]string{
+		ReportText: `There are issues with your talhelper config file:
+field: "nodes[1].installDisk" (talconfig.yaml:9:5)
+  * first
+  * second
+field: "endpoint" (talconfig.yaml:2:1)
+  * WARNING: 100% sure, maybe
+`,
+		ReportGitHub: `::error file=talconfig.yaml,line=9,col=5,title=InvalidInstallDisk::nodes[1].installDisk: first%0Asecond
+::warning file=talconfig.yaml,line=2,col=1,title=UnreleasedTalosVersion::endpoint: 100%25 sure, maybe
+`,
+	}
+	for format, expected := range tests {
+		var buf bytes.Buffer
+		if err := WriteReport(&buf, format, reportTestFindings()); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != expected {
+			t.Errorf("%s: got:\n%s\nwant:\n%s", format, buf.String(), expected)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := WriteReport(&buf, ReportJSON, reportTestFindings()); err != nil {
+		t.Fatal(err)
+	}
+	var findings []Finding
+	if err := json.Unmarshal(buf.Bytes(), &findings); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(findings, reportTestFindings()) {
+		t.Errorf("json: got %+v, want %+v", findings, reportTestFindings())
+	}
+
+	buf.Reset()
+	if err := WriteReport(&buf, ReportSARIF, reportTestFindings()); err != nil {
+		t.Fatal(err)
+	}
+	var log sarifLog
+	if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+		t.Fatal(err)
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 1 || len(log.Runs[0].Results) != 2 || len(log.Runs[0].Tool.Driver.Rules) != 2 {
+		t.Fatalf("unexpected sarif log: %s", buf.String())
+	}
+	result := log.Runs[0].Results[0]
+	if result.RuleID != "InvalidInstallDisk" || result.Level != "error" || result.Locations[0].PhysicalLocation.Region.StartLine != 9 {
+		t.Errorf("unexpected sarif result: %+v", result)
+	}
+
+	for _, format := range []string{ReportText, ReportJSON, ReportSARIF, ReportGitHub} {
+		buf.Reset()
+		if err := WriteReport(&buf, format, nil); err != nil {
+			t.Fatal(err)
+		}
+		if (format == ReportText || format == ReportGitHub) && buf.Len() > 0 {
+			t.Errorf("%s: expected empty report, got %q", format, buf.String())
+		}
+		if format == ReportJSON && strings.TrimSpace(buf.String()) != "[]" {
+			t.Errorf("json: expected empty array, got %q", buf.String())
+		}
+	}
+
+	if err := WriteReport(&buf, "foo", nil); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
+
+func TestCodeFrame(t *testing.T) {
+	lines := strings.Split("a: 1\nb:\n  c: 2\nd: 3\n", "\n")
+
+	tests := []struct {
+		line, column int
+		expected     string
+	}{
+		{3, 3, "    2 | b:\n  > 3 |   c: 2\n      |   ^\n    4 | d: 3\n"},
+		{1, 1, "  > 1 | a: 1\n      | ^\n    2 | b:\n"},
+		{3, 0, "    2 | b:\n  > 3 |   c: 2\n    4 | d: 3\n"},
+		{9, 1, ""},
+	}
+	for _, test := range tests {
+		if result := codeFrame(lines, test.line, test.column); result != test.expected {
+			t.Errorf("%d:%d: got:\n%s\nwant:\n%s", test.line, test.column, result, test.expected)
+		}
+	}
+}
+
+func TestWriteReportSuppressed(t *testing.T) {
+	color.NoColor = true
+
+	findings := []Finding{
+		{Level: "error", ID: "TH015", Kind: "NodeIPAddressRequired", Field: "nodes[0].ipAddress", Message: "foo"},
+		{Level: "warning", ID: "TH005", Kind: "UnreleasedTalosVersion", Field: "talosVersion", Message: "bar", Suppressed: true},
+		{Level: "warning", ID: "TH005", Kind: "UnreleasedTalosVersion", Field: "talosVersion", Message: "baz", Suppressed: true},
+	}
+
+	tests := map[string]string{
+		ReportText: `There are issues with your talhelper config file:
+field: "nodes[0].ipAddress"
+  * foo [TH015]
+2 issues are ignored: UnreleasedTalosVersion (2)
+`,
+		ReportGitHub: `::error title=TH015 NodeIPAddressRequired::nodes[0].ipAddress: foo
+::notice title=talhelper::2 issues are ignored: UnreleasedTalosVersion (2)
+`,
+	}
+	for format, expected := range tests {
+		var buf bytes.Buffer
+		if err := WriteReport(&buf, format, findings); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != expected {
+			t.Errorf("%s: got:\n%s\nwant:\n%s", format, buf.String(), expected)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := WriteReport(&buf, ReportText, findings[1:2]); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "1 issue is ignored: UnreleasedTalosVersion (1)\n"; buf.String() != expected {
+		t.Errorf("got %q, want %q", buf.String(), expected)
+	}
+
+	buf.Reset()
+	if err := WriteReport(&buf, ReportSARIF, findings); err != nil {
+		t.Fatal(err)
+	}
+	var log sarifLog
+	if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+		t.Fatal(err)
+	}
+	results := log.Runs[0].Results
+	if len(log.Runs[0].Tool.Driver.Rules) != 2 || results[0].RuleID != "TH015" || len(results[0].Suppressions) != 0 || len(results[1].Suppressions) != 1 {
+		t.Errorf("unexpected sarif log: %s", buf.String())
+	}
+}
@@ -0,0 +1,131 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// Rule is a check done when validating talhelper config file.
+type Rule struct {
+	// ID is the stable identifier of the rule, it never changes and is never
+	// reused for another rule.
+	ID string
+	// Kind is the `Kind` of `Error` or `Warning` reported by the rule.
+	Kind string
+	// Severity is either "error" or "warning", only warnings can be ignored.
+	Severity    string
+	Description string
+}
+
+// Rules are every rule of the validator, new rules are appended with the next
+// ID. Every `Kind` reported by the validator must be here.
+var Rules = []Rule{
+	{"TH001", "ClusterNameRequired", "error", "`clusterName` is empty"},
+	{"TH002", "KubernetesVersionRequired", "error", "`kubernetesVersion` is empty"},
+	{"TH003", "EndpointRequired", "error", "`endpoint` is empty"},
+	{"TH004", "NodesRequired", "error", "`nodes` is empty"},
+	{"TH005", "UnreleasedTalosVersion", "warning", "`talosVersion` is not released yet and might not be compatible with talhelper"},
+	{"TH006", "InvalidTalosVersion", "error", "`talosVersion` is not supported"},
+	{"TH007", "InvalidKubernetesVersion", "error", "`kubernetesVersion` is not compatible with `talosVersion`"},
+	{"TH008", "InvalidTalosEndpoint", "error", "`endpoint` is not a valid URL"},
+	{"TH009", "InvalidDomain", "error", "`domain` is not a valid domain"},
+	{"TH010", "InvalidClusterPodNets", "error", "`clusterPodNets` is not a list of CIDR"},
+	{"TH011", "InvalidClusterSvcNets", "error", "`clusterSvcNets` is not a list of CIDR"},
+	{"TH012", "InvalidCNIConfig", "error", "`cniConfig` is not valid"},
+	{"TH013", "InvalidClusterInlineManifests", "error", "`inlineManifests` are not valid"},
+	{"TH014", "NodeHostnameRequired", "error", "`hostname` of the node is empty"},
+	{"TH015", "NodeIPAddressRequired", "error", "`ipAddress` of the node is empty"},
+	{"TH016", "NodeInstallRequired", "error", "neither `installDisk` nor `installDiskSelector` of the node is set"},
+	{"TH017", "InvalidNodeGroups", "error", "`groups` of the node are not defined in `nodeGroups`"},
+	{"TH018", "InvalidNodeMergeStrategy", "error", "`mergeStrategy` of the node has unknown field or strategy"},
+	{"TH019", "InvalidNodeDiskSelector", "error", "`installDiskSelector` of the node is not valid"},
+	{"TH020", "InvalidNodeIPAddress", "error", "`ipAddress` of the node is not a valid domain or IP address"},
+	{"TH021", "InvalidNodeHostname", "error", "`hostname` of the node is not a valid hostname"},
+	{"TH022", "InvalidNodeTalosImageURL", "error", "`talosImageURL` of the node is not a valid image reference"},
+	{"TH023", "InvalidNodeLabels", "error", "`nodeLabels` of the node are not valid Kubernetes labels"},
+	{"TH024", "InvalidNodeAnnotations", "error", "`nodeAnnotations` of the node are not valid Kubernetes annotations"},
+	{"TH025", "InvalidNodeTaints", "error", "`nodeTaints` of the node are not valid Kubernetes taints"},
+	{"TH026", "DeprecatedNodeMachineDisks", "warning", "`machineDisks` of the node is deprecated"},
+	{"TH027", "InvalidMachineDisks", "error", "`machineDisks` of the node are not valid"},
+	{"TH028", "InvalidMachineFiles", "error", "`machineFiles` of the node are not valid"},
+	{"TH029", "InvalidNodeSchematic", "error", "`schematic` of the node has unknown extensions or is not valid"},
+	{"TH030", "InvalidNodeNameservers", "error", "`nameservers` of the node are not valid IP addresses"},
+	{"TH031", "InvalidNodeNetworkInterfaces", "error", "`networkInterfaces` of the node are not valid"},
+	{"TH032", "InvalidNodeMachineSpec", "error", "`machineSpec` of the node is not valid"},
+	{"TH033", "InvalidNodeIngressFirewall", "error", "`ingressFirewall` of the node is not valid"},
+	{"TH034", "DeprecatedNodeExtraManifests", "warning", "`extraManifests` of the node is deprecated"},
+	{"TH035", "InvalidNodeExtraManifests", "error", "`extraManifests` of the node don't exist"},
+	{"TH036", "DuplicateNodeHostname", "warning", "the same `hostname` is used by more than one node"},
+	{"TH037", "DuplicateNodeIPAddress", "warning", "the same `ipAddress` is used by more than one node"},
+	{"TH038", "EvenControlPlaneNodes", "warning", "the number of controlplane nodes is even, which doesn't improve etcd fault tolerance"},
+	{"TH039", "NodeIPAddressInClusterNets", "warning", "`ipAddress` of the node is inside `clusterPodNets` or `clusterSvcNets`"},
+	{"TH040", "VIPNotMatchingEndpoint", "warning", "`vip` of the node interface is not the IP address of `endpoint`"},
+	{"TH041", "ConflictingVIPInterfaces", "warning", "the same `vip` is set on different interfaces"},
+	{"TH042", "UnknownValidateIgnore", "warning", "`validate.ignore` has unknown rule ID or kind, or a rule reporting errors"},
+	{"TH043", "InvalidPolicy", "error", "the config can't be evaluated by the policy rules"},
+}
+
+// GetRule returns the rule with `id` or `Kind` of `id` and whether it's found.
+func GetRule(id string) (Rule, bool) {
+	for _, r := range Rules {
+		if r.ID == id || r.Kind == id {
+			return r, true
+		}
+	}
+	return Rule{}, false
+}
+
+// getRuleID returns the ID of the rule of `kind` or empty string if not found.
+func getRuleID(kind string) string {
+	for _, r := range Rules {
+		if r.Kind == kind {
+			return r.ID
+		}
+	}
+	return ""
+}
+
+// getRuleSeverity returns the severity of the rule or the rule of `policy`
+// with ID or kind of `id` and whether it's found.
+func getRuleSeverity(id string, policy *Policy) (string, bool) {
+	if r, ok := GetRule(id); ok {
+		return r.Severity, true
+	}
+	if r, ok := policy.getRule(id); ok {
+		return r.Severity, true
+	}
+	return "", false
+}
+
+// CheckIgnore returns an error if `ignore` has unknown rule ID or kind or a
+// rule reporting errors, because only warnings can be ignored. Rules of
+// `policy` are known too.
+func CheckIgnore(ignore []string, policy *Policy) error {
+	var result *multierror.Error
+	for _, id := range ignore {
+		switch severity, ok := getRuleSeverity(id, policy); {
+		case !ok:
+			result = multierror.Append(result, fmt.Errorf("%q is not a known validation rule ID or kind", id))
+		case severity != "warning":
+			result = multierror.Append(result, fmt.Errorf("%q reports errors which can't be ignored, only warnings can", id))
+		}
+	}
+	return result.ErrorOrNil()
+}
+
+// getValidationIgnore returns the rules ignored for `field`, which are the
+// top level `validate.ignore` and the one of the node if `field` is in a node.
+func (c TalhelperConfig) getValidationIgnore(field string) []string {
+	result := c.Validation.Ignore
+	if idx, _, ok := splitNodeField(field); ok && idx < len(c.Nodes) {
+		result = slices.Concat(result, c.Nodes[idx].Validation.Ignore)
+	}
+	return result
+}
+
+// isIgnored returns true if `ignore` has `id` or `kind`.
+func isIgnored(ignore []string, id, kind string) bool {
+	return slices.Contains(ignore, id) || slices.Contains(ignore, kind)
+}
@@ -0,0 +1,168 @@
+package config
+
+import (
+	"io"
+	"os"
+	"regexp"
+	"testing"
+)
+
+func TestRules(t *testing.T) {
+	ids := make(map[string]bool)
+	kinds := make(map[string]bool)
+	for _, r := range Rules {
+		if ids[r.ID] || kinds[r.Kind] {
+			t.Errorf("duplicated rule %s %s", r.ID, r.Kind)
+		}
+		ids[r.ID], kinds[r.Kind] = true, true
+	}
+
+	source, err := os.ReadFile("validator.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range regexp.MustCompile(`Kind:\s+"(\w+)"`).FindAllSubmatch(source, -1) {
+		if !kinds[string(m[1])] {
+			t.Errorf("%s is not in Rules", m[1])
+		}
+	}
+
+	if r, ok := GetRule("EvenControlPlaneNodes"); !ok || r.ID != "TH038" {
+		t.Errorf("got %+v, want TH038", r)
+	}
+	if r, ok := GetRule("TH038"); !ok || r.Kind != "EvenControlPlaneNodes" {
+		t.Errorf("got %+v, want EvenControlPlaneNodes", r)
+	}
+	if _, ok := GetRule("Foo"); ok {
+		t.Error("expected Foo to not be found")
+	}
+}
+
+func TestValidationIgnore(t *testing.T) {
+	c, err := NewFromByte([]byte(`clusterName: test
+talosVersion: v1.9.0
+kubernetesVersion: v1.32.0
+endpoint: https://1.1.1.1:6443
+validate:
+  ignore:
+    - EvenControlPlaneNodes
+    - Foo
+nodes:
+  - hostname: cp1
+    ipAddress: 1.1.1.1
+    controlPlane: true
+    installDisk: /dev/sda
+  - hostname: cp2
+    controlPlane: true
+    installDisk: /dev/sda
+    validate:
+      ignore:
+        - TH015
+  - hostname: cp3
+    controlPlane: true
+    installDisk: /dev/sda
+  - hostname: cp4
+    ipAddress: 1.1.1.4
+    controlPlane: true
+    installDisk: /dev/sda
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errs, warns := c.Validate()
+	suppressed := make(map[string]bool)
+	for _, e := range errs {
+		suppressed[e.Field] = false
+	}
+	for _, w := range warns {
+		suppressed[w.Field] = w.Suppressed
+	}
+
+	expected := map[string]bool{
+		"nodes":              true,
+		"nodes[1].ipAddress": false,
+		"nodes[2].ipAddress": false,
+		"validate.ignore":    false,
+	}
+	for field, e := range expected {
+		if s, ok := suppressed[field]; !ok || s != e {
+			t.Errorf("%s: got suppressed %t (found %t), want %t", field, s, ok, e)
+		}
+	}
+
+	if !warns.HasField("nodes[1].validate.ignore") {
+		t.Error("expected ignoring an error rule to be warned")
+	}
+
+	r := &Reporter{Output: io.Discard, Ignore: []string{"NodeIPAddressRequired"}}
+	if err := r.Report(errs, warns); err == nil {
+		t.Error("expected ignored errors to still fail")
+	}
+	if active := warns.Ignore([]string{"TH042"}).Active(); len(active) != 0 {
+		t.Errorf("expected no active warnings, got %v", active)
+	}
+}
+
+func TestCheckIgnore(t *testing.T) {
+	if err := CheckIgnore([]string{"TH005", "EvenControlPlaneNodes"}, nil); err != nil {
+		t.Errorf("didn't expect an error but received %s", err)
+	}
+	if err := CheckIgnore([]string{"TH015"}, nil); err == nil {
+		t.Error("expected an error for ignoring an error rule")
+	}
+	if err := CheckIgnore([]string{"Foo"}, nil); err == nil {
+		t.Error("expected an error for unknown rule")
+	}
+}
+
+func TestIgnoreCrossNodeRules(t *testing.T) {
+	c, err := NewFromByte([]byte(`clusterName: test
+talosVersion: v1.9.0
+kubernetesVersion: v1.32.0
+endpoint: https://10.96.0.10:6443
+validate:
+  ignore:
+    - TH036
+    - DuplicateNodeIPAddress
+nodes:
+  - hostname: cp1
+    ipAddress: 10.0.0.1
+    controlPlane: true
+    installDisk: /dev/sda
+  - hostname: cp1
+    ipAddress: 10.0.0.1
+    installDisk: /dev/sda
+  - hostname: w1
+    ipAddress: 10.96.0.20
+    installDisk: /dev/sda
+    validate:
+      ignore:
+        - NodeIPAddressInClusterNets
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errs, warns := c.Validate()
+	for _, kind := range []string{"DuplicateNodeHostname", "DuplicateNodeIPAddress", "NodeIPAddressInClusterNets"} {
+		found := false
+		for _, w := range warns {
+			if w.Kind == kind {
+				found = true
+				if !w.Suppressed {
+					t.Errorf("expected %s at %s to be suppressed", kind, w.Field)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("expected %s warning, got %v", kind, warns)
+		}
+	}
+	if err := (&Reporter{Output: io.Discard}).Report(errs, warns); err != nil {
+		t.Errorf("expected ignored cross node checks not to fail, got %s: %v", err, errs)
+	}
+	if err := CheckIgnore([]string{"TH036", "TH037", "NodeIPAddressInClusterNets"}, nil); err != nil {
+		t.Errorf("didn't expect an error but received %s", err)
+	}
+}
@@ -0,0 +1,237 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/budimanjojo/talhelper/v3/pkg/yamledit"
+	"gopkg.in/yaml.v3"
+)
+
+// Position is the position of a field in a talhelper config file. `Line` and
+// `Column` are zero if the position is unknown.
+type Position struct {
+	File   string
+	Line   int
+	Column int
+}
+
+// String returns `p` as `file:line:column` or empty string if unknown.
+func (p Position) String() string {
+	switch {
+	case p.Line == 0 && p.File == "":
+		return ""
+	case p.Line == 0:
+		return p.File
+	case p.File == "":
+		return fmt.Sprintf("%d:%d", p.Line, p.Column)
+	default:
+		return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
+	}
+}
+
+// configSource keeps the YAML nodes a `TalhelperConfig` is loaded from, so
+// its fields can be resolved to their position in the original files.
+type configSource struct {
+	// layers are ordered from the highest precedence, e.g: the selected
+	// cluster of `clusters` comes before the file it's defined in, which
+	// comes before the file it `extends`.
+	layers []sourceLayer
+	// nodes are the paths of every node in `nodes` after `nodePools` are
+	// expanded, e.g: `nodes[0]` or `nodePools[1]`.
+	nodes []string
+}
+
+type sourceLayer struct {
+	file string
+	root *yaml.Node
+}
+
+// mergedFields are the fields merged from every layer instead of taken from
+// the layer with the highest precedence that has them.
+var mergedFields = []string{"controlPlane", "worker", "nodeGroups", "patches"}
+
+func newConfigSource(file string, root *yaml.Node) *configSource {
+	return &configSource{layers: []sourceLayer{{file: file, root: root}}}
+}
+
+// merge returns the layers of `s` followed by the layers of `base`.
+func (s *configSource) merge(base *configSource) *configSource {
+	if s == nil {
+		return base
+	}
+	if base == nil {
+		return s
+	}
+	return &configSource{layers: append(append([]sourceLayer{}, s.layers...), base.layers...)}
+}
+
+// selectCluster returns `s` with the config of cluster `name` in `clusters`
+// of every layer put before them.
+func (s *configSource) selectCluster(name string) *configSource {
+	if s == nil {
+		return nil
+	}
+
+	result := &configSource{}
+	for _, l := range s.layers {
+		clusters := yamledit.MappingValue(l.root, "clusters")
+		if clusters == nil || clusters.Kind != yaml.SequenceNode {
+			continue
+		}
+		for _, c := range clusters.Content {
+			if n := yamledit.MappingValue(c, "clusterName"); n != nil && n.Value == name {
+				result.layers = append(result.layers, sourceLayer{file: l.file, root: c})
+			}
+		}
+	}
+	result.layers = append(result.layers, s.layers...)
+
+	return result
+}
+
+// clusterNode returns the YAML node of cluster `name` in `clusters` of the
+// layer with the highest precedence that has it, or nil if not found.
+func (s *configSource) clusterNode(name string) *yaml.Node {
+	if s == nil {
+		return nil
+	}
+
+	for _, l := range s.layers {
+		clusters := yamledit.MappingValue(l.root, "clusters")
+		if clusters == nil || clusters.Kind != yaml.SequenceNode {
+			continue
+		}
+		for _, c := range clusters.Content {
+			if n := yamledit.MappingValue(c, "clusterName"); n != nil && n.Value == name {
+				return c
+			}
+		}
+	}
+
+	return nil
+}
+
+// expandNodePools records that `nodes` of the config has `count` nodes followed
+// by the nodes of every pool in `pools`.
+func (s *configSource) expandNodePools(count int, pools []int) {
+	if s == nil {
+		return
+	}
+
+	s.nodes = nil
+	for i := range count {
+		s.nodes = append(s.nodes, fmt.Sprintf("nodes[%d]", i))
+	}
+	for i, n := range pools {
+		for range n {
+			s.nodes = append(s.nodes, fmt.Sprintf("nodePools[%d]", i))
+		}
+	}
+}
+
+// locate returns the position of `field` or of its closest parent found in
+// the layers of `s`. The position of scalar value is where the value is and
+// the position of anything else is where its key is. Fields of nodes expanded from `nodePools` are resolved
+// to their pool.
+func (s *configSource) locate(field string) Position {
+	if s == nil || len(s.layers) == 0 {
+		return Position{}
+	}
+
+	field = s.nodeField(field)
+	path, err := yamledit.ParsePath(field)
+	if err != nil || path[0].IsIndex {
+		return Position{File: s.layers[0].file}
+	}
+
+	// the field is taken from the layer with the highest precedence that has
+	// it, except for the merged ones that can come from any layer
+	var found *sourceLayer
+	for i, l := range s.layers {
+		if yamledit.MappingIndex(l.root, path[0].Key) < 0 {
+			continue
+		}
+		if found == nil {
+			found = &s.layers[i]
+		}
+		if !slices.Contains(mergedFields, path[0].Key) || yamledit.Lookup(l.root, path) != nil {
+			found = &s.layers[i]
+			break
+		}
+	}
+	if found == nil {
+		return Position{File: s.layers[0].file}
+	}
+
+	// point to the value itself if it's a scalar, otherwise to its key
+	n := yamledit.Lookup(found.root, path)
+	if n == nil || n.Kind != yaml.ScalarNode {
+		n = yamledit.Locate(found.root, path)
+	}
+	return Position{File: found.file, Line: n.Line, Column: n.Column}
+}
+
+// fields returns `yamlFields` of `field` resolved the same way as `locate`,
+// from every layer for the fields in `mergedFields` and from the layer with
+// the highest precedence that has it for the others.
+func (s *configSource) fields(field string) yamlFields {
+	if s == nil {
+		return nil
+	}
+
+	path, err := yamledit.ParsePath(s.nodeField(field))
+	if err != nil || path[0].IsIndex {
+		return nil
+	}
+
+	var result yamlFields
+	for _, l := range s.layers {
+		f := newYamlFields(l.root)
+		if !f.has(path[0].Key) {
+			continue
+		}
+		for _, e := range path {
+			if e.IsIndex {
+				f = f.item(e.Index)
+			} else {
+				f = f.field(e.Key)
+			}
+		}
+		result = append(result, f...)
+		if !slices.Contains(mergedFields, path[0].Key) {
+			break
+		}
+	}
+	return result
+}
+
+// nodeField returns `field` with its `nodes[N]` prefix replaced with the path
+// of the node in the config file.
+func (s *configSource) nodeField(field string) string {
+	idx, rest, ok := splitNodeField(field)
+	if !ok || idx >= len(s.nodes) {
+		return field
+	}
+
+	return s.nodes[idx] + rest
+}
+
+// splitNodeField returns the index of the node and the rest of `field` if it
+// starts with `nodes[N]`.
+func splitNodeField(field string) (int, string, bool) {
+	rest, ok := strings.CutPrefix(field, "nodes[")
+	end := strings.Index(rest, "]")
+	if !ok || end < 0 {
+		return 0, "", false
+	}
+
+	idx, err := strconv.Atoi(rest[:end])
+	if err != nil || idx < 0 {
+		return 0, "", false
+	}
+
+	return idx, rest[end+1:], true
+}
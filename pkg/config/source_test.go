@@ -0,0 +1,138 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConfigSourceLocate(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TALHELPER_TEST_LABELS", "{zone: a,\n  rack: b}")
+
+	files := map[string]string{
+		"base.yaml": `clusterName: base
+endpoint: https://1.1.1.1:6443
+controlPlane:
+  nameservers:
+    - 1.1.1.1
+`,
+		"talconfig.yaml": `extends: base.yaml
+talosVersion: v1.9.0
+nodes:
+  - hostname: node1
+    nodeLabels: ${TALHELPER_TEST_LABELS}
+
+    installDisk: /dev/sda
+nodePools:
+  - name: pool
+    count: 2
+    ipAddressStart: 10.0.0.1
+    installDisk: /dev/sdb
+clusters:
+  - clusterName: prod
+    kubernetesVersion: v1.30.0
+`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg, err := LoadClusterFromFile(filepath.Join(dir, "talconfig.yaml"), "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base, overlay := filepath.Join(dir, "base.yaml"), filepath.Join(dir, "talconfig.yaml")
+	tests := map[string]Position{
+		"endpoint":                     {File: base, Line: 2, Column: 11},
+		"controlPlane.nameservers":     {File: base, Line: 4, Column: 3},
+		"talosVersion":                 {File: overlay, Line: 2, Column: 15},
+		"kubernetesVersion":            {File: overlay, Line: 15, Column: 24},
+		"nodes[0].installDisk":         {File: overlay, Line: 7, Column: 18},
+		"nodes[0].nodeLabels.rack":     {File: overlay, Line: 5, Column: 17},
+		"nodes[0].ipAddress":           {File: overlay, Line: 4, Column: 5},
+		"nodes[2].installDisk":         {File: overlay, Line: 12, Column: 18},
+		"nodes[2].hostname":            {File: overlay, Line: 9, Column: 5},
+		"nodes[9].hostname":            {File: overlay, Line: 3, Column: 1},
+		"domain":                       {File: overlay},
+		"controlPlane.kernelModules":   {File: base, Line: 3, Column: 1},
+		"nodes[0].nodeLabels[\"foo\"]": {File: overlay, Line: 5, Column: 5},
+	}
+	for field, expected := range tests {
+		if result := cfg.source.locate(field); result != expected {
+			t.Errorf("%s: got %s, want %s", field, result, expected)
+		}
+	}
+}
+
+func TestValidateFromSourcePosition(t *testing.T) {
+	t.Setenv("TALHELPER_TEST_VERSION", "foo")
+
+	source := []byte(`clusterName: test
+
+talosVersion: ${TALHELPER_TEST_VERSION}
+`)
+
+	errs, _, err := ValidateFromSource("talconfig.yaml", source, "", true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]Position{
+		"talosVersion":      {File: "talconfig.yaml", Line: 3, Column: 15},
+		"endpoint":          {File: "talconfig.yaml"},
+		"kubernetesVersion": {File: "talconfig.yaml"},
+	}
+	for _, e := range errs {
+		if pos, ok := expected[e.Field]; ok && e.Position != pos {
+			t.Errorf("%s: got %s, want %s", e.Field, e.Position, pos)
+		}
+	}
+	if !errs.HasField("talosVersion") {
+		t.Error("expected error for talosVersion")
+	}
+}
+
+func TestValidateFromSourceCluster(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "base.yaml")
+	if err := os.WriteFile(base, []byte(`endpoint: https://192.168.200.10:6443
+domain: "not a domain"
+talosVersion: v1.9.0
+kubernetesVersion: v1.32.0
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(dir, "talconfig.yaml")
+	source := []byte(`extends: base.yaml
+clusters:
+  - clusterName: prod
+    nodes:
+      - hostname: cp1
+        ipAddress: 192.168.200.11
+        controlPlane: true
+        installDisk: /dev/sda
+  - clusterName: staging
+    nodes: []
+`)
+
+	if _, _, err := ValidateFromSource(file, source, "", false, nil); err == nil {
+		t.Error("expected error for multiple clusters without selecting one")
+	}
+
+	errs, _, err := ValidateFromSource(file, source, "prod", false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(errs) != 1 || errs[0].Field != "domain" {
+		t.Fatalf("expected only domain error, got %v", errs)
+	}
+	if expected := (Position{File: base, Line: 2, Column: 9}); errs[0].Position != expected {
+		t.Errorf("got %s, want %s", errs[0].Position, expected)
+	}
+}
@@ -10,6 +10,14 @@ type Warning struct {
 	Kind    string
 	Field   string
 	Message string
+	// Position is where `Field` is in the config file, it's only known if
+	// the config is loaded from a file
+	Position Position
+	// ID is the ID of the `Rule` of `Kind`
+	ID string
+	// Suppressed is true if the rule is ignored with `validate.ignore` or
+	// `Ignore`
+	Suppressed bool
 }
 
 type Warnings []*Warning
@@ -18,12 +26,18 @@ type Error struct {
 	Kind    string
 	Field   string
 	Message error
+	// Position is where `Field` is in the config file, it's only known if
+	// the config is loaded from a file
+	Position Position
+	// ID is the ID of the `Rule` of `Kind`
+	ID string
 }
 
+// Errors can't be ignored, only `Warnings` can.
 type Errors []*Error
 
 func ValidateFromByte(source []byte) (Errors, Warnings, error) {
-	return runValidate(source)
+	return ValidateFromSource("", source, "", false, nil)
 }
 
 func ValidateFromFile(path string) (Errors, Warnings, error) {
@@ -31,12 +45,40 @@ func ValidateFromFile(path string) (Errors, Warnings, error) {
 	if err != nil {
 		return nil, nil, err
 	}
-	return runValidate(byte)
+	return ValidateFromSource(path, byte, "", false, nil)
+}
+
+// ValidateFromSource takes the path and the content of a talhelper config
+// file and validates the config of `cluster` the same way as
+// `LoadAndValidateClusterFromFile`: `extends` is resolved, the cluster is
+// selected from `clusters`, `nodePools` are expanded and the node groups are
+// merged into the nodes. `envsubst` is done on the content if `substituteEnv`
+// is true. The rules of `policy` are evaluated too if it's not nil. The
+// returned `Errors` and `Warnings` have the positions of their fields in the
+// file defining them. It returns an error if the config can't be loaded.
+func ValidateFromSource(file string, source []byte, cluster string, substituteEnv bool, policy *Policy) (Errors, Warnings, error) {
+	c, err := loadClusterFromSource(file, source, cluster, substituteEnv)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := c.prepareNodes(substituteEnv); err != nil {
+		return nil, nil, err
+	}
+
+	errors, warnings := c.ValidateWithPolicy(policy)
+	return errors, warnings, nil
 }
 
 // Validate returns `Errors` and `Warnings` if the given
 // `TalhelperConfig` is not correct
 func (c TalhelperConfig) Validate() (Errors, Warnings) {
+	return c.ValidateWithPolicy(nil)
+}
+
+// ValidateWithPolicy is the same as `Validate` but the rules of `policy` with
+// `PolicyTargetConfig` and `PolicyTargetNode` target are evaluated too.
+func (c TalhelperConfig) ValidateWithPolicy(policy *Policy) (Errors, Warnings) {
 	var result Errors
 	var warns Warnings
 	slog.Debug("start validating talconfig file")
@@ -51,6 +93,8 @@ func (c TalhelperConfig) Validate() (Errors, Warnings) {
 	for k, node := range c.Nodes {
 		slog.Debug(fmt.Sprintf("validating config file for node %s", node.Hostname))
 		checkNodeRequiredCfg(node, k, &result)
+		checkNodeGroups(c, node, k, &result)
+		checkNodeMergeStrategy(node, k, &result)
 		checkNodeIPAddress(node, k, &result)
 		checkNodeInstallDiskSelector(node, k, &result)
 		checkNodeHostname(node, k, &result)
@@ -70,16 +114,32 @@ func (c TalhelperConfig) Validate() (Errors, Warnings) {
 		checkNodeIngressFirewall(node, k, &result)
 		checkNodeExtraManifests(node, k, &result, &warns)
 	}
+	checkDuplicateNodeHostnames(c, &warns)
+	checkDuplicateNodeIPAddresses(c, &warns)
+	checkControlPlaneCount(c, &warns)
+	checkNodeIPAddressesInClusterNets(c, &warns)
+	checkVIPEndpoint(c, &warns)
+	checkVIPInterfaces(c, &warns)
+	checkPolicy(c, policy, &result, &warns)
+	checkValidationIgnore(c, policy, &warns)
+
+	c.resolveIssues(result, warns)
+
 	return result, warns
 }
 
-func runValidate(source []byte) (Errors, Warnings, error) {
-	c, err := NewFromByte(source)
-	if err != nil {
-		return nil, nil, err
+// resolveIssues sets the position and the rule ID of `errs` and `warns`, and
+// whether `warns` are suppressed by `validate.ignore`.
+func (c TalhelperConfig) resolveIssues(errs Errors, warns Warnings) {
+	for _, e := range errs {
+		e.Position = c.source.locate(e.Field)
+		e.ID = getRuleID(e.Kind)
+	}
+	for _, w := range warns {
+		w.Position = c.source.locate(w.Field)
+		w.ID = getRuleID(w.Kind)
+		w.Suppressed = isIgnored(c.getValidationIgnore(w.Field), w.ID, w.Kind)
 	}
-	errors, warnings := c.Validate()
-	return errors, warnings, nil
 }
 
 func (errs Errors) HasField(field string) bool {
@@ -109,3 +169,24 @@ func (warns *Warnings) Append(warn *Warning) *Warnings {
 	*warns = append(*warns, warn)
 	return warns
 }
+
+// Ignore marks the warnings with ID or `Kind` in `ignore` as suppressed.
+func (warns Warnings) Ignore(ignore []string) Warnings {
+	for _, warn := range warns {
+		if isIgnored(ignore, warn.ID, warn.Kind) {
+			warn.Suppressed = true
+		}
+	}
+	return warns
+}
+
+// Active returns the warnings that are not suppressed.
+func (warns Warnings) Active() Warnings {
+	var result Warnings
+	for _, warn := range warns {
+		if !warn.Suppressed {
+			result = append(result, warn)
+		}
+	}
+	return result
+}
@@ -2,6 +2,9 @@ package config
 
 import (
 	"fmt"
+	"maps"
+	"net/netip"
+	"net/url"
 	"os"
 	"reflect"
 	"regexp"
@@ -280,6 +283,46 @@ func checkNodeRequiredCfg(node Node, idx int, result *Errors) *Errors {
 	return result
 }
 
+func checkNodeGroups(c TalhelperConfig, node Node, idx int, result *Errors) *Errors {
+	var messages *multierror.Error
+	for _, group := range node.Groups {
+		if _, ok := c.NodeGroups[group]; !ok {
+			messages = multierror.Append(messages, fmt.Errorf("%q is not defined in %q", group, getFieldYamlTag(c, "NodeGroups")))
+		}
+	}
+
+	if messages.ErrorOrNil() != nil {
+		return result.Append(&Error{
+			Kind:    "InvalidNodeGroups",
+			Field:   getNodeFieldYamlTag(node, idx, "Groups"),
+			Message: formatError(messages),
+		})
+	}
+	return result
+}
+
+func checkNodeMergeStrategy(node Node, idx int, result *Errors) *Errors {
+	var messages *multierror.Error
+	fields := nodeConfigsFieldNames()
+	for _, field := range slices.Sorted(maps.Keys(node.MergeStrategy)) {
+		if !slices.Contains(fields, field) {
+			messages = multierror.Append(messages, fmt.Errorf("%q is not a node configuration field", field))
+		}
+		if strategy := node.MergeStrategy[field]; !slices.Contains(MergeStrategies, strategy) {
+			messages = multierror.Append(messages, fmt.Errorf("%q is not a valid merge strategy for %q, should be one of %s", strategy, field, strings.Join(MergeStrategies, ", ")))
+		}
+	}
+
+	if messages.ErrorOrNil() != nil {
+		return result.Append(&Error{
+			Kind:    "InvalidNodeMergeStrategy",
+			Field:   getNodeFieldYamlTag(node, idx, "MergeStrategy"),
+			Message: formatError(messages),
+		})
+	}
+	return result
+}
+
 func checkNodeInstallDiskSelector(node Node, idx int, result *Errors) *Errors {
 	if node.InstallDiskSelector != nil {
 		var ic v1alpha1.InstallConfig
@@ -674,7 +717,7 @@ func checkNodeIngressFirewall(node Node, idx int, result *Errors) *Errors {
 func checkNodeExtraManifests(node Node, idx int, result *Errors, warns *Warnings) (*Errors, *Warnings) {
 	if len(node.ExtraManifests) > 0 {
 		warns.Append(&Warning{
-			Kind:    "DeprecatedNodeMachineDisks",
+			Kind:    "DeprecatedNodeExtraManifests",
 			Field:   getNodeFieldYamlTag(node, idx, "ExtraManifests"),
 			Message: formatWarning("`extraManifests` is deprecated, please use `patches` instead"),
 		})
@@ -699,6 +742,225 @@ func checkNodeExtraManifests(node Node, idx int, result *Errors, warns *Warnings
 	return result, warns
 }
 
+func checkDuplicateNodeHostnames(c TalhelperConfig, warns *Warnings) *Warnings {
+	seen := map[string]int{}
+	for k, node := range c.Nodes {
+		if node.Hostname == "" {
+			continue
+		}
+		if other, exists := seen[node.Hostname]; exists {
+			warns.Append(&Warning{
+				Kind:    "DuplicateNodeHostname",
+				Field:   getNodeFieldYamlTag(node, k, "Hostname"),
+				Message: formatWarning(fmt.Sprintf("hostname %q is already used by `nodes[%d]`", node.Hostname, other)),
+			})
+			continue
+		}
+		seen[node.Hostname] = k
+	}
+	return warns
+}
+
+func checkDuplicateNodeIPAddresses(c TalhelperConfig, warns *Warnings) *Warnings {
+	seen := map[string]int{}
+	for k, node := range c.Nodes {
+		if node.IPAddress == "" {
+			continue
+		}
+
+		for _, ip := range node.GetIPAddresses() {
+			if other, exists := seen[ip]; exists && other != k {
+				warns.Append(&Warning{
+					Kind:    "DuplicateNodeIPAddress",
+					Field:   getNodeFieldYamlTag(node, k, "IPAddress"),
+					Message: formatWarning(fmt.Sprintf("%q is already used by `nodes[%d]`", ip, other)),
+				})
+				continue
+			}
+			seen[ip] = k
+		}
+	}
+	return warns
+}
+
+func checkControlPlaneCount(c TalhelperConfig, warns *Warnings) *Warnings {
+	var count int
+	for _, node := range c.Nodes {
+		if node.ControlPlane {
+			count++
+		}
+	}
+
+	// an even number of etcd members tolerates the same number of failures
+	// as one member less, e.g: 4 members tolerate 1 failure like 3 members
+	if count > 0 && count%2 == 0 {
+		warns.Append(&Warning{
+			Kind:    "EvenControlPlaneNodes",
+			Field:   getFieldYamlTag(c, "Nodes"),
+			Message: formatWarning(fmt.Sprintf("there are %d controlplane nodes, an odd number of them is recommended for etcd quorum", count)),
+		})
+	}
+	return warns
+}
+
+func checkNodeIPAddressesInClusterNets(c TalhelperConfig, warns *Warnings) *Warnings {
+	var nets []netip.Prefix
+	for _, cidr := range slices.Concat(c.GetClusterPodNets(), c.GetClusterSvcNets()) {
+		// invalid CIDR is reported by `checkClusterNets`
+		if prefix, err := netip.ParsePrefix(cidr); err == nil {
+			nets = append(nets, prefix)
+		}
+	}
+
+	for k, node := range c.Nodes {
+		for _, ip := range node.GetIPAddresses() {
+			addr, err := netip.ParseAddr(ip)
+			if err != nil {
+				continue
+			}
+			for _, prefix := range nets {
+				if prefix.Contains(addr) {
+					warns.Append(&Warning{
+						Kind:    "NodeIPAddressInClusterNets",
+						Field:   getNodeFieldYamlTag(node, k, "IPAddress"),
+						Message: formatWarning(fmt.Sprintf("%q is inside %q of `clusterPodNets` or `clusterSvcNets`", ip, prefix)),
+					})
+				}
+			}
+		}
+	}
+	return warns
+}
+
+func checkVIPEndpoint(c TalhelperConfig, warns *Warnings) *Warnings {
+	u, err := url.Parse(c.Endpoint)
+	if err != nil {
+		return warns
+	}
+	// the VIP can't be compared with endpoint using domain name
+	endpoint, err := netip.ParseAddr(u.Hostname())
+	if err != nil {
+		return warns
+	}
+
+	for k, node := range c.Nodes {
+		for _, vip := range getNodeVIPs(node, k) {
+			if addr, err := netip.ParseAddr(vip.ip); err == nil && addr != endpoint {
+				warns.Append(&Warning{
+					Kind:    "VIPNotMatchingEndpoint",
+					Field:   vip.field,
+					Message: formatWarning(fmt.Sprintf("vip %q doesn't match the IP address of `endpoint` %q", vip.ip, endpoint)),
+				})
+			}
+		}
+	}
+	return warns
+}
+
+func checkVIPInterfaces(c TalhelperConfig, warns *Warnings) *Warnings {
+	interfaces := map[string][]nodeVIP{}
+	var ips []string
+	for k, node := range c.Nodes {
+		for _, vip := range getNodeVIPs(node, k) {
+			// the interface can't be compared if it's selected with `deviceSelector`
+			if vip.iface == "" {
+				continue
+			}
+			if _, exists := interfaces[vip.ip]; !exists {
+				ips = append(ips, vip.ip)
+			}
+			interfaces[vip.ip] = append(interfaces[vip.ip], vip)
+		}
+	}
+
+	for _, ip := range ips {
+		first := interfaces[ip][0]
+		for _, vip := range interfaces[ip][1:] {
+			if vip.iface != first.iface || vip.node == first.node {
+				warns.Append(&Warning{
+					Kind:    "ConflictingVIPInterfaces",
+					Field:   vip.field,
+					Message: formatWarning(fmt.Sprintf("vip %q is set on interface %q here and on interface %q in `%s`", ip, vip.iface, first.iface, first.field)),
+				})
+			}
+		}
+	}
+	return warns
+}
+
+func checkValidationIgnore(c TalhelperConfig, policy *Policy, warns *Warnings) *Warnings {
+	check := func(field string, ignore []string) {
+		for _, id := range ignore {
+			switch severity, ok := getRuleSeverity(id, policy); {
+			case !ok:
+				warns.Append(&Warning{
+					Kind:    "UnknownValidateIgnore",
+					Field:   field,
+					Message: formatWarning(fmt.Sprintf("%q is not a known validation rule ID or kind", id)),
+				})
+			case severity != "warning":
+				warns.Append(&Warning{
+					Kind:    "UnknownValidateIgnore",
+					Field:   field,
+					Message: formatWarning(fmt.Sprintf("%q reports errors which can't be ignored, only warnings can", id)),
+				})
+			}
+		}
+	}
+
+	check(getFieldYamlTag(c, "Validation")+".ignore", c.Validation.Ignore)
+	for k, node := range c.Nodes {
+		check(getNodeFieldYamlTag(node, k, "Validation")+".ignore", node.Validation.Ignore)
+	}
+	return warns
+}
+
+// nodeVIP is a VIP defined in `networkInterfaces` of a node.
+type nodeVIP struct {
+	node  int
+	field string
+	iface string
+	ip    string
+}
+
+// getNodeVIPs returns the VIPs of `node` defined in its interfaces and their
+// VLANs.
+func getNodeVIPs(node Node, idx int) []nodeVIP {
+	var result []nodeVIP
+	field := getNodeFieldYamlTag(node, idx, "NetworkInterfaces")
+
+	for i, device := range node.NetworkInterfaces {
+		if device == nil {
+			continue
+		}
+		if device.DeviceVIPConfig != nil && device.DeviceVIPConfig.SharedIP != "" {
+			result = append(result, nodeVIP{
+				node:  idx,
+				field: fmt.Sprintf("%s[%d].vip", field, i),
+				iface: device.DeviceInterface,
+				ip:    device.DeviceVIPConfig.SharedIP,
+			})
+		}
+		for j, vlan := range device.DeviceVlans {
+			if vlan == nil || vlan.VlanVIP == nil || vlan.VlanVIP.SharedIP == "" {
+				continue
+			}
+			iface := ""
+			if device.DeviceInterface != "" {
+				iface = fmt.Sprintf("%s.%d", device.DeviceInterface, vlan.VlanID)
+			}
+			result = append(result, nodeVIP{
+				node:  idx,
+				field: fmt.Sprintf("%s[%d].vlans[%d].vip", field, i, j),
+				iface: iface,
+				ip:    vlan.VlanVIP.SharedIP,
+			})
+		}
+	}
+
+	return result
+}
+
 var hostnamePattern = sync.OnceValue(func() *regexp.Regexp {
 	return regexp.MustCompile(`^([a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9\-]{0,61}[a-zA-Z0-9])(\.([a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9\-]{0,61}[a-zA-Z0-9]))*$`)
 })
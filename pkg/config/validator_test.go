@@ -1,6 +1,7 @@
 package config
 
 import (
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -209,3 +210,110 @@ func TestCheckNodeAnnotations(t *testing.T) {
 		}
 	}
 }
+
+func TestCheckNodeGroups(t *testing.T) {
+	c := TalhelperConfig{
+		NodeGroups: map[string]NodeConfigs{"gpu": {}},
+	}
+
+	var result Errors
+	checkNodeGroups(c, Node{Groups: []string{"gpu"}}, 0, &result)
+	if len(result) > 0 {
+		t.Errorf("didn't expect an error but received %#v", result)
+	}
+
+	checkNodeGroups(c, Node{Groups: []string{"gpu", "storage"}}, 0, &result)
+	if !result.HasField("nodes[0].groups") {
+		t.Errorf("expected an error for nodes[0].groups but received %#v", result)
+	}
+}
+
+func TestCheckNodeMergeStrategy(t *testing.T) {
+	var result Errors
+	checkNodeMergeStrategy(Node{MergeStrategy: map[string]string{"nodeLabels": "replace", "nameservers": "append", "patches": "merge"}}, 0, &result)
+	if len(result) > 0 {
+		t.Errorf("didn't expect an error but received %#v", result)
+	}
+
+	checkNodeMergeStrategy(Node{MergeStrategy: map[string]string{"nodeLabel": "replace"}}, 0, &result)
+	checkNodeMergeStrategy(Node{MergeStrategy: map[string]string{"nodeLabels": "prepend"}}, 1, &result)
+	if !result.HasField("nodes[0].mergeStrategy") || !result.HasField("nodes[1].mergeStrategy") {
+		t.Errorf("expected errors for nodes[0].mergeStrategy and nodes[1].mergeStrategy but received %#v", result)
+	}
+}
+
+func TestCheckCrossNodes(t *testing.T) {
+	c, err := NewFromByte([]byte(`endpoint: https://192.168.200.10:6443
+clusterSvcNets:
+  - 192.168.100.0/24
+nodes:
+  - hostname: cp1
+    ipAddress: 192.168.200.11
+    controlPlane: true
+    networkInterfaces:
+      - interface: eth0
+        vip:
+          ip: 192.168.200.10
+  - hostname: cp2
+    ipAddress: 192.168.200.12
+    controlPlane: true
+    networkInterfaces:
+      - interface: bond0
+        vip:
+          ip: 192.168.200.10
+  - hostname: cp1
+    ipAddress: 192.168.200.11, 192.168.100.5
+    controlPlane: true
+    networkInterfaces:
+      - interface: eth0
+        vlans:
+          - vlanId: 10
+            vip:
+              ip: 192.168.200.20
+  - hostname: cp3
+    ipAddress: 10.244.0.5
+    controlPlane: true
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		nodeWarns Warnings
+		warns     Warnings
+	)
+	checkDuplicateNodeHostnames(*c, &nodeWarns)
+	checkDuplicateNodeIPAddresses(*c, &nodeWarns)
+	checkNodeIPAddressesInClusterNets(*c, &nodeWarns)
+	checkControlPlaneCount(*c, &warns)
+	checkVIPEndpoint(*c, &warns)
+	checkVIPInterfaces(*c, &warns)
+
+	expectedNodeWarnings := [][2]string{
+		{"nodes[2].hostname", "DuplicateNodeHostname"},
+		{"nodes[2].ipAddress", "DuplicateNodeIPAddress"},
+		{"nodes[2].ipAddress", "NodeIPAddressInClusterNets"},
+		{"nodes[3].ipAddress", "NodeIPAddressInClusterNets"},
+	}
+	var resultNodeWarnings [][2]string
+	for _, w := range nodeWarns {
+		resultNodeWarnings = append(resultNodeWarnings, [2]string{w.Field, w.Kind})
+	}
+	if !reflect.DeepEqual(resultNodeWarnings, expectedNodeWarnings) {
+		t.Errorf("expected warnings %v but received %v", expectedNodeWarnings, resultNodeWarnings)
+	}
+
+	expectedWarnings := map[string]string{
+		"nodes": "EvenControlPlaneNodes",
+		"nodes[2].networkInterfaces[0].vlans[0].vip": "VIPNotMatchingEndpoint",
+		"nodes[1].networkInterfaces[0].vip":          "ConflictingVIPInterfaces",
+	}
+	if len(warns) != len(expectedWarnings) {
+		t.Errorf("expected %d warnings but received %d", len(expectedWarnings), len(warns))
+	}
+	for _, w := range warns {
+		if expectedWarnings[w.Field] != w.Kind {
+			t.Errorf("unexpected warning %s for %s: %s", w.Kind, w.Field, w.Message)
+		}
+	}
+}
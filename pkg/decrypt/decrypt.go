@@ -51,6 +51,15 @@ func DecryptYamlWithSops(filePath string) ([]byte, error) {
 	return data, nil
 }
 
+// IsYamlEncrypted returns true if yaml `data` is encrypted with `sops`.
+func IsYamlEncrypted(data []byte) bool {
+	var m sopsFile
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return false
+	}
+	return m.isEncrypted()
+}
+
 // isEncrypted returns true if `sops` key exists.
 func (s *sopsFile) isEncrypted() bool {
 	return len(s.Sops) != 0
@@ -70,3 +70,15 @@ func TestIsSopsEncryptedCommentOnly(t *testing.T) {
 		t.Errorf("got true, want false")
 	}
 }
+
+func TestIsYamlEncrypted(t *testing.T) {
+	if IsYamlEncrypted([]byte("this:\n  is: plain\n")) {
+		t.Error("got true for plain yaml, want false")
+	}
+	if IsYamlEncrypted([]byte("not: [valid")) {
+		t.Error("got true for invalid yaml, want false")
+	}
+	if !IsYamlEncrypted([]byte("secret: ENC[AES256_GCM,data:abc]\nsops:\n  version: 3.7.3\n")) {
+		t.Error("got false for encrypted yaml, want true")
+	}
+}
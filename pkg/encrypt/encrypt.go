@@ -0,0 +1,83 @@
+package encrypt
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+
+	sops "github.com/getsops/sops/v3"
+	"github.com/getsops/sops/v3/aes"
+	"github.com/getsops/sops/v3/cmd/sops/common"
+	"github.com/getsops/sops/v3/cmd/sops/formats"
+	"github.com/getsops/sops/v3/config"
+	"github.com/getsops/sops/v3/keyservice"
+	"github.com/getsops/sops/v3/version"
+)
+
+// EncryptYamlWithSops encrypts yaml `data` that is going to be written to
+// `filePath` with `sops`. The keys are taken from the creation rule matching
+// `filePath` in the closest `.sops.yaml` file found from the directory of
+// `filePath` up to its parents. It returns the encrypted data and an error,
+// if any.
+func EncryptYamlWithSops(filePath string, data []byte) ([]byte, error) {
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	confPath, err := config.FindConfigFile(absPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find .sops.yaml for %s: %w", filePath, err)
+	}
+	slog.Debug(fmt.Sprintf("using SOPS config file %s to encrypt %s", confPath, filePath))
+
+	conf, err := config.LoadCreationRuleForFile(confPath, absPath, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load SOPS creation rule for %s: %w", filePath, err)
+	}
+	if conf == nil {
+		return nil, fmt.Errorf("no SOPS creation rule found for %s in %s", filePath, confPath)
+	}
+
+	store := common.StoreForFormat(formats.Yaml, config.NewStoresConfig())
+	branches, err := store.LoadPlainFile(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(branches) == 0 {
+		return nil, fmt.Errorf("%s has no yaml document to encrypt", filePath)
+	}
+
+	tree := sops.Tree{
+		Branches: branches,
+		Metadata: sops.Metadata{
+			KeyGroups:               conf.KeyGroups,
+			ShamirThreshold:         conf.ShamirThreshold,
+			UnencryptedSuffix:       conf.UnencryptedSuffix,
+			EncryptedSuffix:         conf.EncryptedSuffix,
+			UnencryptedRegex:        conf.UnencryptedRegex,
+			EncryptedRegex:          conf.EncryptedRegex,
+			UnencryptedCommentRegex: conf.UnencryptedCommentRegex,
+			EncryptedCommentRegex:   conf.EncryptedCommentRegex,
+			MACOnlyEncrypted:        conf.MACOnlyEncrypted,
+			Version:                 version.Version,
+		},
+		FilePath: absPath,
+	}
+
+	dataKey, errs := tree.GenerateDataKeyWithKeyServices([]keyservice.KeyServiceClient{keyservice.NewLocalClient()})
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("failed to generate SOPS data key for %s: %v", filePath, errs)
+	}
+
+	err = common.EncryptTree(common.EncryptTreeOpts{
+		Tree:    &tree,
+		Cipher:  aes.NewCipher(),
+		DataKey: dataKey,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("SOPS encryption failed for %s: %w", filePath, err)
+	}
+
+	return store.EmitEncryptedFile(tree)
+}
@@ -0,0 +1,54 @@
+package encrypt
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/budimanjojo/talhelper/v3/pkg/decrypt"
+)
+
+const (
+	testAgeKey       = "AGE-SECRET-KEY-172FENV3SDP8JSRRX2SWTA9JQMAW7MW3GSKJ2JZDNXS4GVFAS5STQUW8WN4"
+	testAgeRecipient = "age10k9mjx3wcfzd7dwx3uqs68v7dzlwvwpzp8jyjpysjhy9mdwzhghqy2vhvn"
+)
+
+func TestEncryptYamlWithSops(t *testing.T) {
+	t.Setenv("SOPS_AGE_KEY", testAgeKey)
+
+	dir := t.TempDir()
+	sopsCfg := "creation_rules:\n  - path_regex: clusterconfig/.*\n    age: " + testAgeRecipient + "\n"
+	if err := os.WriteFile(filepath.Join(dir, ".sops.yaml"), []byte(sopsCfg), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "clusterconfig", "node.yaml")
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	plain := "machine:\n  token: mysecretvalue\n---\nkind: NetworkRuleConfig\nname: rule\n"
+	encrypted, err := EncryptYamlWithSops(path, []byte(plain))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(encrypted), "mysecretvalue") {
+		t.Fatalf("expected secret to be encrypted, got:\n%s", encrypted)
+	}
+
+	if err := os.WriteFile(path, encrypted, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	decrypted, err := decrypt.DecryptFileWithSops(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(decrypted), "token: mysecretvalue") || !strings.Contains(string(decrypted), "name: rule") {
+		t.Errorf("got unexpected decrypted content:\n%s", decrypted)
+	}
+
+	if _, err := EncryptYamlWithSops(filepath.Join(dir, "other", "node.yaml"), []byte(plain)); err == nil {
+		t.Error("expected error for file without matching creation rule, got nil")
+	}
+}
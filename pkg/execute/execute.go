@@ -0,0 +1,416 @@
+package execute
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/hashicorp/go-multierror"
+	"github.com/siderolabs/talos/pkg/machinery/api/machine"
+	"github.com/siderolabs/talos/pkg/machinery/client"
+	clientconfig "github.com/siderolabs/talos/pkg/machinery/client/config"
+	"github.com/spf13/pflag"
+
+	"github.com/budimanjojo/talhelper/v3/pkg/generate"
+)
+
+// ClientFunc returns a Talos API client to run `cmd` with. `insecure` is true
+// when the node should be reached in maintenance mode without the talosconfig.
+type ClientFunc func(ctx context.Context, cmd generate.Command, insecure bool) (*client.Client, error)
+
+// Executor runs generated `talosctl` commands directly through the Talos
+// machinery client instead of shelling out to `talosctl`.
+type Executor struct {
+	// NewClient is used to create Talos API client for every command.
+	// Defaults to `NewClient` if nil.
+	NewClient ClientFunc
+	// Out is where the progress of every node is written to.
+	// Defaults to `os.Stdout` if nil.
+	Out io.Writer
+	// Wait makes `upgrade` and `reset` wait for the node to come back healthy
+	// (or to go down for `reset` without `--reboot`) before running the next
+	// command, like `talosctl` does. It can be overridden by `--wait` flag of
+	// the command.
+	Wait bool
+	// Timeout is how long to wait for a node, defaults to `DefaultTimeout`.
+	// It can be overridden by `--timeout` flag of the command.
+	Timeout time.Duration
+	// PollInterval is how often the node is checked while waiting, defaults
+	// to `DefaultPollInterval`.
+	PollInterval time.Duration
+}
+
+const (
+	// DefaultTimeout is the default time to wait for a node, the same as
+	// `talosctl upgrade`.
+	DefaultTimeout = 30 * time.Minute
+	// DefaultPollInterval is the default interval of checking a node while
+	// waiting for it.
+	DefaultPollInterval = 5 * time.Second
+
+	// checkTimeout is how long a single check of a node can take, so a node
+	// that doesn't respond while rebooting is seen as down
+	checkTimeout = 30 * time.Second
+)
+
+// Run executes `cmds` using the default `Executor`, which waits for every
+// node after `upgrade` and `reset`. It returns an error, if any.
+func Run(ctx context.Context, cmds generate.Commands) error {
+	return (&Executor{Wait: true}).Run(ctx, cmds)
+}
+
+// Run executes `cmds` one by one in order. A failing command doesn't stop the
+// remaining commands from running. It returns the errors of every failed
+// command, if any.
+func (e *Executor) Run(ctx context.Context, cmds generate.Commands) error {
+	out := e.Out
+	if out == nil {
+		out = os.Stdout
+	}
+
+	var result *multierror.Error
+	for i, cmd := range cmds {
+		fmt.Fprintf(out, "[%d/%d] %s on %s (%s)... ", i+1, len(cmds), subcommand(cmd), cmd.Hostname, cmd.IPAddress)
+
+		if err := e.run(ctx, cmd); err != nil {
+			fmt.Fprintln(out, "failed")
+			result = multierror.Append(result, fmt.Errorf("%s on %s (%s): %w", subcommand(cmd), cmd.Hostname, cmd.IPAddress, err))
+			continue
+		}
+
+		fmt.Fprintln(out, "done")
+	}
+
+	if err := result.ErrorOrNil(); err != nil {
+		return fmt.Errorf("%d of %d commands failed: %w", len(result.Errors), len(cmds), err)
+	}
+
+	return nil
+}
+
+func (e *Executor) run(ctx context.Context, cmd generate.Command) error {
+	flags, err := parseFlags(cmd)
+	if err != nil {
+		return err
+	}
+
+	newClient := e.NewClient
+	if newClient == nil {
+		newClient = NewClient
+	}
+
+	insecure, _ := flags.GetBool("insecure")
+	c, err := newClient(ctx, cmd, insecure)
+	if err != nil {
+		return err
+	}
+	defer c.Close() //nolint:errcheck
+
+	nodeCtx := ctx
+	if !insecure {
+		nodeCtx = client.WithNode(ctx, cmd.IPAddress)
+	}
+
+	slog.Debug(fmt.Sprintf("running %s", cmd))
+	switch subcommand(cmd) {
+	case "apply-config":
+		return applyConfig(nodeCtx, c, flags)
+	case "upgrade":
+		// the node is only known to be back if it reports the new version or
+		// it's been seen down when the version doesn't change
+		tag := imageTag(flags)
+		before, _ := nodeVersion(nodeCtx, c)
+		if err := upgrade(nodeCtx, c, flags); err != nil {
+			return err
+		}
+		return e.wait(ctx, cmd, flags, waitCondition{tag: tag, down: tag == "" || before == tag, healthy: true})
+	case "reset":
+		if err := reset(nodeCtx, c, flags); err != nil {
+			return err
+		}
+		// the node boots into maintenance mode after reset, or stays down
+		// without `--reboot`
+		if reboot, _ := flags.GetBool("reboot"); reboot {
+			return e.wait(ctx, cmd, flags, waitCondition{down: true, insecure: true})
+		}
+		return e.wait(ctx, cmd, flags, waitCondition{down: true, stayDown: true})
+	case "bootstrap":
+		return c.Bootstrap(nodeCtx, &machine.BootstrapRequest{})
+	default:
+		return fmt.Errorf("%q is not supported in execute mode", subcommand(cmd))
+	}
+}
+
+// waitCondition is what `Executor.wait` waits for.
+type waitCondition struct {
+	// tag is the version the node must report, any version if empty
+	tag string
+	// down makes the node to be seen unreachable first
+	down bool
+	// stayDown makes waiting done once the node is seen unreachable
+	stayDown bool
+	// healthy makes every service of the node to be healthy
+	healthy bool
+	// insecure checks the node in maintenance mode
+	insecure bool
+}
+
+// wait polls the node of `cmd` until `cond` is met, unless waiting is
+// disabled. It returns an error if the node isn't ready before the timeout.
+func (e *Executor) wait(ctx context.Context, cmd generate.Command, flags *pflag.FlagSet, cond waitCondition) error {
+	wait := e.Wait
+	if flags.Changed("wait") {
+		wait, _ = flags.GetBool("wait")
+	}
+	if !wait {
+		return nil
+	}
+
+	timeout := e.Timeout
+	if flags.Changed("timeout") || timeout == 0 {
+		timeout, _ = flags.GetDuration("timeout")
+	}
+	interval := e.PollInterval
+	if interval == 0 {
+		interval = DefaultPollInterval
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var lastErr error
+	seenDown := !cond.down
+	for {
+		lastErr = e.checkReady(ctx, cmd, cond)
+		switch {
+		case lastErr != nil && isUnreachable(ctx, lastErr):
+			seenDown = true
+			if cond.stayDown {
+				return nil
+			}
+		case lastErr == nil && seenDown && !cond.stayDown:
+			return nil
+		case lastErr == nil:
+			lastErr = fmt.Errorf("node is still up")
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out waiting for the node after %s: %w", timeout, lastErr)
+		case <-time.After(interval):
+		}
+	}
+}
+
+// checkReady returns an error if the node of `cmd` doesn't meet `cond`.
+func (e *Executor) checkReady(ctx context.Context, cmd generate.Command, cond waitCondition) error {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	newClient := e.NewClient
+	if newClient == nil {
+		newClient = NewClient
+	}
+
+	c, err := newClient(ctx, cmd, cond.insecure)
+	if err != nil {
+		return &unreachableError{err}
+	}
+	defer c.Close() //nolint:errcheck
+
+	if !cond.insecure {
+		ctx = client.WithNode(ctx, cmd.IPAddress)
+	}
+
+	tag, err := nodeVersion(ctx, c)
+	if err != nil {
+		return &unreachableError{err}
+	}
+	if cond.tag != "" && tag != cond.tag {
+		return fmt.Errorf("node is running %s instead of %s", tag, cond.tag)
+	}
+
+	if !cond.healthy {
+		return nil
+	}
+
+	resp, err := c.ServiceList(ctx)
+	if err != nil {
+		return err
+	}
+
+	var unhealthy []string
+	for _, msg := range resp.GetMessages() {
+		for _, svc := range msg.GetServices() {
+			if h := svc.GetHealth(); h != nil && !h.GetUnknown() && !h.GetHealthy() {
+				unhealthy = append(unhealthy, svc.GetId())
+			}
+		}
+	}
+	if len(unhealthy) > 0 {
+		return fmt.Errorf("services are not healthy: %s", strings.Join(unhealthy, ", "))
+	}
+
+	return nil
+}
+
+// unreachableError is returned by `checkReady` when the node can't be reached.
+type unreachableError struct {
+	err error
+}
+
+func (e *unreachableError) Error() string { return e.err.Error() }
+
+func (e *unreachableError) Unwrap() error { return e.err }
+
+// isUnreachable returns true if `err` means the node is down, and not that
+// the waiting is cancelled.
+func isUnreachable(ctx context.Context, err error) bool {
+	var u *unreachableError
+	return ctx.Err() == nil && errors.As(err, &u)
+}
+
+// nodeVersion returns the Talos version tag the node is running.
+func nodeVersion(ctx context.Context, c *client.Client) (string, error) {
+	resp, err := c.Version(ctx)
+	if err != nil {
+		return "", err
+	}
+	for _, msg := range resp.GetMessages() {
+		return msg.GetVersion().GetTag(), nil
+	}
+	return "", fmt.Errorf("node didn't report its version")
+}
+
+// imageTag returns the tag of `--image` flag, e.g: `v1.9.0` of
+// `factory.talos.dev/installer/<id>:v1.9.0`.
+func imageTag(flags *pflag.FlagSet) string {
+	image, _ := flags.GetString("image")
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		return image[i+1:]
+	}
+	return ""
+}
+
+// NewClient returns Talos API client configured from `cmd.Talosconfig`. If
+// `insecure` is true, the client connects to `cmd.IPAddress` in maintenance
+// mode instead. It returns an error, if any.
+func NewClient(ctx context.Context, cmd generate.Command, insecure bool) (*client.Client, error) {
+	if insecure {
+		return client.New(ctx, client.WithMaintenanceMode(cmd.IPAddress, nil))
+	}
+
+	cfg, err := clientconfig.Open(cmd.Talosconfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open talosconfig %s: %w", cmd.Talosconfig, err)
+	}
+
+	return client.New(ctx, client.WithConfig(cfg))
+}
+
+func applyConfig(ctx context.Context, c *client.Client, flags *pflag.FlagSet) error {
+	file, _ := flags.GetString("file")
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	m, _ := flags.GetString("mode")
+	mode, ok := machine.ApplyConfigurationRequest_Mode_value[strings.ToUpper(strings.ReplaceAll(m, "-", "_"))]
+	if !ok || mode == int32(machine.ApplyConfigurationRequest_REBOOT) {
+		return fmt.Errorf("unknown apply mode %q, should be one of auto, no-reboot, staged, try", m)
+	}
+
+	resp, err := c.ApplyConfiguration(ctx, &machine.ApplyConfigurationRequest{
+		Data: data,
+		Mode: machine.ApplyConfigurationRequest_Mode(mode),
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, msg := range resp.GetMessages() {
+		for _, w := range msg.GetWarnings() {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", color.YellowString("WARNING"), w)
+		}
+	}
+
+	return nil
+}
+
+func upgrade(ctx context.Context, c *client.Client, flags *pflag.FlagSet) error {
+	image, _ := flags.GetString("image")
+	stage, _ := flags.GetBool("stage")
+	force, _ := flags.GetBool("force")
+
+	//nolint:staticcheck
+	_, err := c.UpgradeWithOptions(ctx,
+		client.WithUpgradeImage(image),
+		client.WithUpgradeRebootMode(machine.UpgradeRequest_DEFAULT),
+		client.WithUpgradeStage(stage),
+		client.WithUpgradeForce(force),
+	)
+	return err
+}
+
+func reset(ctx context.Context, c *client.Client, flags *pflag.FlagSet) error {
+	graceful, _ := flags.GetBool("graceful")
+	reboot, _ := flags.GetBool("reboot")
+
+	return c.ResetGeneric(ctx, &machine.ResetRequest{
+		Graceful: graceful,
+		Reboot:   reboot,
+	})
+}
+
+// parseFlags parses the `talosctl` flags in `cmd.Args`. Only flags that can be
+// translated into the Talos API request of the subcommand are accepted.
+// It returns an error, if any.
+func parseFlags(cmd generate.Command) (*pflag.FlagSet, error) {
+	if len(cmd.Args) < 2 {
+		return nil, fmt.Errorf("invalid command %q", cmd)
+	}
+
+	flags := pflag.NewFlagSet(subcommand(cmd), pflag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	flags.String("talosconfig", "", "")
+	flags.StringSliceP("nodes", "n", nil, "")
+
+	// the same flags and shorthands as `talosctl`
+	switch subcommand(cmd) {
+	case "apply-config":
+		flags.StringP("file", "f", "", "")
+		flags.StringP("mode", "m", "auto", "")
+		flags.BoolP("insecure", "i", false, "")
+	case "upgrade":
+		flags.StringP("image", "i", "", "")
+		flags.BoolP("stage", "s", false, "")
+		flags.BoolP("force", "f", false, "")
+		flags.Bool("wait", true, "")
+		flags.Duration("timeout", DefaultTimeout, "")
+	case "reset":
+		flags.Bool("graceful", true, "")
+		flags.Bool("reboot", false, "")
+		flags.Bool("wait", true, "")
+		flags.Duration("timeout", DefaultTimeout, "")
+	}
+
+	if err := flags.Parse(cmd.Args[2:]); err != nil {
+		return nil, fmt.Errorf("%w in execute mode", err)
+	}
+
+	return flags, nil
+}
+
+func subcommand(cmd generate.Command) string {
+	if len(cmd.Args) < 2 {
+		return ""
+	}
+	return cmd.Args[1]
+}
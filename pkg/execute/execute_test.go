@@ -0,0 +1,318 @@
+package execute
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/siderolabs/talos/pkg/machinery/api/machine"
+	"github.com/siderolabs/talos/pkg/machinery/client"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/budimanjojo/talhelper/v3/pkg/generate"
+)
+
+type fakeMachineService struct {
+	machine.UnimplementedMachineServiceServer
+
+	mu       sync.Mutex
+	calls    []string
+	failNode string
+
+	// rebootDelay is how long a node is unreachable after upgrade or reset
+	rebootDelay time.Duration
+	// unhealthyChecks is how many service checks report etcd unhealthy
+	// after a node comes back
+	unhealthyChecks int
+	nodes           map[string]*fakeNode
+}
+
+type fakeNode struct {
+	tag       string
+	downUntil time.Time
+	unhealthy int
+	// upgradedAt is when the node got the upgrade request and readyAt is
+	// when it's first seen healthy after that
+	upgradedAt, readyAt time.Time
+}
+
+// node returns the state of the node of `ctx`, the caller must hold the lock.
+func (s *fakeMachineService) node(ctx context.Context) *fakeNode {
+	var name string
+	if md, ok := metadata.FromIncomingContext(ctx); ok && len(md.Get("node")) > 0 {
+		name = md.Get("node")[0]
+	}
+	if s.nodes == nil {
+		s.nodes = make(map[string]*fakeNode)
+	}
+	if s.nodes[name] == nil {
+		s.nodes[name] = &fakeNode{tag: "v1.0.0"}
+	}
+	return s.nodes[name]
+}
+
+// reboot makes the node of `ctx` unreachable for `rebootDelay` and come back
+// with `tag`.
+func (s *fakeMachineService) reboot(ctx context.Context, tag string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := s.node(ctx)
+	n.downUntil = time.Now().Add(s.rebootDelay)
+	n.unhealthy = s.unhealthyChecks
+	n.upgradedAt = time.Now()
+	if tag != "" {
+		n.tag = tag
+	}
+}
+
+func (s *fakeMachineService) Version(ctx context.Context, _ *emptypb.Empty) (*machine.VersionResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := s.node(ctx)
+	if time.Now().Before(n.downUntil) {
+		return nil, status.Error(codes.Unavailable, "rebooting")
+	}
+	return &machine.VersionResponse{Messages: []*machine.Version{{Version: &machine.VersionInfo{Tag: n.tag}}}}, nil
+}
+
+func (s *fakeMachineService) ServiceList(ctx context.Context, _ *emptypb.Empty) (*machine.ServiceListResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := s.node(ctx)
+	if time.Now().Before(n.downUntil) {
+		return nil, status.Error(codes.Unavailable, "rebooting")
+	}
+
+	healthy := n.unhealthy == 0
+	if healthy && n.readyAt.IsZero() {
+		n.readyAt = time.Now()
+	}
+	n.unhealthy = max(n.unhealthy-1, 0)
+
+	return &machine.ServiceListResponse{Messages: []*machine.ServiceList{{Services: []*machine.ServiceInfo{
+		{Id: "apid", Health: &machine.ServiceHealth{Healthy: true}},
+		{Id: "etcd", Health: &machine.ServiceHealth{Healthy: healthy}},
+	}}}}, nil
+}
+
+func (s *fakeMachineService) record(ctx context.Context, call string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var node string
+	if md, ok := metadata.FromIncomingContext(ctx); ok && len(md.Get("node")) > 0 {
+		node = md.Get("node")[0]
+	}
+	s.calls = append(s.calls, call+" "+node)
+
+	if node != "" && node == s.failNode {
+		return errors.New("node is on fire")
+	}
+	return nil
+}
+
+func (s *fakeMachineService) ApplyConfiguration(ctx context.Context, req *machine.ApplyConfigurationRequest) (*machine.ApplyConfigurationResponse, error) {
+	return &machine.ApplyConfigurationResponse{}, s.record(ctx, "apply "+req.GetMode().String()+" "+string(req.GetData()))
+}
+
+func (s *fakeMachineService) Upgrade(ctx context.Context, req *machine.UpgradeRequest) (*machine.UpgradeResponse, error) {
+	if err := s.record(ctx, "upgrade "+req.GetImage()); err != nil {
+		return nil, err
+	}
+
+	var tag string
+	if i := strings.LastIndex(req.GetImage(), ":"); i >= 0 {
+		tag = req.GetImage()[i+1:]
+	}
+	s.reboot(ctx, tag)
+
+	return &machine.UpgradeResponse{}, nil
+}
+
+func (s *fakeMachineService) Reset(ctx context.Context, req *machine.ResetRequest) (*machine.ResetResponse, error) {
+	call := "reset"
+	if req.GetGraceful() {
+		call += " graceful"
+	}
+	if err := s.record(ctx, call); err != nil {
+		return nil, err
+	}
+
+	s.reboot(ctx, "")
+	return &machine.ResetResponse{}, nil
+}
+
+func (s *fakeMachineService) Bootstrap(ctx context.Context, req *machine.BootstrapRequest) (*machine.BootstrapResponse, error) {
+	return &machine.BootstrapResponse{}, s.record(ctx, "bootstrap")
+}
+
+func newFakeExecutor(t *testing.T, srv *fakeMachineService) (*Executor, *bytes.Buffer) {
+	t.Helper()
+
+	socket := filepath.Join(t.TempDir(), "machine.sock")
+	lis, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := grpc.NewServer()
+	machine.RegisterMachineServiceServer(s, srv)
+	go s.Serve(lis) //nolint:errcheck
+	t.Cleanup(s.Stop)
+
+	out := new(bytes.Buffer)
+	return &Executor{
+		Out:          out,
+		PollInterval: 10 * time.Millisecond,
+		NewClient: func(ctx context.Context, _ generate.Command, _ bool) (*client.Client, error) {
+			return client.New(ctx,
+				client.WithUnixSocket(socket),
+				client.WithGRPCDialOptions(grpc.WithTransportCredentials(insecure.NewCredentials())),
+			)
+		},
+	}, out
+}
+
+func TestExecutorRun(t *testing.T) {
+	cfgFile := filepath.Join(t.TempDir(), "node.yaml")
+	if err := os.WriteFile(cfgFile, []byte("machine: {}"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := &fakeMachineService{}
+	e, out := newFakeExecutor(t, srv)
+
+	cmds := generate.Commands{
+		{Hostname: "cp1", IPAddress: "10.0.0.1", Args: []string{"talosctl", "apply-config", "--talosconfig=talosconfig", "--nodes=10.0.0.1", "--file=" + cfgFile, "--mode=staged"}},
+		{Hostname: "cp1", IPAddress: "10.0.0.1", Args: []string{"talosctl", "upgrade", "--talosconfig=talosconfig", "--nodes=10.0.0.1", "--image=installer:v1.0.0"}},
+		{Hostname: "cp1", IPAddress: "10.0.0.1", Args: []string{"talosctl", "bootstrap", "--talosconfig=talosconfig", "--nodes=10.0.0.1"}},
+		{Hostname: "cp1", IPAddress: "10.0.0.1", Args: []string{"talosctl", "reset", "--talosconfig=talosconfig", "--nodes=10.0.0.1"}},
+	}
+
+	if err := e.Run(context.Background(), cmds); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"apply STAGED machine: {} 10.0.0.1",
+		"upgrade installer:v1.0.0 10.0.0.1",
+		"bootstrap 10.0.0.1",
+		"reset graceful 10.0.0.1",
+	}
+	if strings.Join(srv.calls, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("got calls:\n%s\nwant:\n%s", strings.Join(srv.calls, "\n"), strings.Join(expected, "\n"))
+	}
+
+	if strings.Count(out.String(), "done") != 4 {
+		t.Errorf("expected progress for every command, got:\n%s", out.String())
+	}
+}
+
+func TestExecutorRunPartialFailure(t *testing.T) {
+	srv := &fakeMachineService{failNode: "10.0.0.2"}
+	e, out := newFakeExecutor(t, srv)
+
+	cmds := generate.Commands{
+		{Hostname: "node1", IPAddress: "10.0.0.1", Args: []string{"talosctl", "reset", "--nodes=10.0.0.1", "--graceful=false"}},
+		{Hostname: "node2", IPAddress: "10.0.0.2", Args: []string{"talosctl", "reset", "--nodes=10.0.0.2"}},
+		{Hostname: "node3", IPAddress: "10.0.0.3", Args: []string{"talosctl", "reset", "--nodes=10.0.0.3", "--unknown-flag"}},
+		{Hostname: "node4", IPAddress: "10.0.0.4", Args: []string{"talosctl", "reset", "--nodes=10.0.0.4"}},
+	}
+
+	err := e.Run(context.Background(), cmds)
+	if err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+	if !strings.Contains(err.Error(), "2 of 4 commands failed") {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if !strings.Contains(err.Error(), "node2") || !strings.Contains(err.Error(), "node3") {
+		t.Errorf("expected node2 and node3 in error, got: %s", err)
+	}
+
+	expected := []string{"reset 10.0.0.1", "reset graceful 10.0.0.2", "reset graceful 10.0.0.4"}
+	if strings.Join(srv.calls, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("got calls:\n%s\nwant:\n%s", strings.Join(srv.calls, "\n"), strings.Join(expected, "\n"))
+	}
+
+	if strings.Count(out.String(), "failed") != 2 {
+		t.Errorf("expected 2 failed nodes in progress, got:\n%s", out.String())
+	}
+}
+
+func TestExecutorRunWait(t *testing.T) {
+	srv := &fakeMachineService{rebootDelay: 200 * time.Millisecond, unhealthyChecks: 2}
+	e, out := newFakeExecutor(t, srv)
+	e.Wait = true
+
+	cmds := generate.Commands{
+		{Hostname: "cp1", IPAddress: "10.0.0.1", Args: []string{"talosctl", "upgrade", "--nodes=10.0.0.1", "--image=installer:v1.1.0"}},
+		{Hostname: "cp2", IPAddress: "10.0.0.2", Args: []string{"talosctl", "upgrade", "-n", "10.0.0.2", "-i", "installer:v1.1.0"}},
+		{Hostname: "cp3", IPAddress: "10.0.0.3", Args: []string{"talosctl", "upgrade", "--nodes=10.0.0.3", "--image=installer:v1.0.0"}},
+	}
+	if err := e.Run(context.Background(), cmds); err != nil {
+		t.Fatal(err)
+	}
+
+	// every node must be back with the new version and healthy before the
+	// next node is upgraded
+	ips := []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}
+	for i, ip := range ips {
+		n := srv.nodes[ip]
+		if n.readyAt.Sub(n.upgradedAt) < srv.rebootDelay {
+			t.Errorf("%s: didn't wait for the reboot", ip)
+		}
+		if i+1 < len(ips) && srv.nodes[ips[i+1]].upgradedAt.Before(n.readyAt) {
+			t.Errorf("%s: next node is upgraded before it's ready", ip)
+		}
+	}
+	if strings.Count(out.String(), "done") != 3 {
+		t.Errorf("expected progress for every command, got:\n%s", out.String())
+	}
+}
+
+func TestExecutorRunWaitTimeout(t *testing.T) {
+	srv := &fakeMachineService{rebootDelay: time.Hour}
+	e, _ := newFakeExecutor(t, srv)
+	e.Wait = true
+
+	cmds := generate.Commands{
+		{Hostname: "cp1", IPAddress: "10.0.0.1", Args: []string{"talosctl", "upgrade", "--nodes=10.0.0.1", "--image=installer:v1.1.0", "--timeout=100ms"}},
+		{Hostname: "cp2", IPAddress: "10.0.0.2", Args: []string{"talosctl", "upgrade", "--nodes=10.0.0.2", "--image=installer:v1.1.0", "--wait=false"}},
+		{Hostname: "cp3", IPAddress: "10.0.0.3", Args: []string{"talosctl", "reset", "--nodes=10.0.0.3"}},
+	}
+	err := e.Run(context.Background(), cmds)
+	if err == nil || !strings.Contains(err.Error(), "1 of 3 commands failed") || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("expected cp1 to time out, got: %v", err)
+	}
+}
+
+func TestParseFlagsShorthand(t *testing.T) {
+	flags, err := parseFlags(generate.Command{Args: []string{"talosctl", "apply-config", "-n", "10.0.0.1", "-f", "node.yaml", "-m", "staged", "-i"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file, _ := flags.GetString("file")
+	mode, _ := flags.GetString("mode")
+	insecure, _ := flags.GetBool("insecure")
+	if file != "node.yaml" || mode != "staged" || !insecure {
+		t.Errorf("got file %q, mode %q, insecure %t", file, mode, insecure)
+	}
+}
@@ -2,19 +2,19 @@ package generate
 
 import (
 	"fmt"
-	"strings"
+	"slices"
 
 	"github.com/budimanjojo/talhelper/v3/pkg/config"
 	"github.com/budimanjojo/talhelper/v3/pkg/talos"
 	"github.com/siderolabs/image-factory/pkg/schematic"
 )
 
-// GenerateApplyCommand prints out `talosctl apply-config` command for selected node.
+// ApplyCommands returns `talosctl apply-config` commands for selected node.
 // `outDir` is directory where generated talosconfig and node manifest files are located.
-// If `node` is empty string, it prints commands for all nodes in `cfg.Nodes`.
+// If `node` is empty string, it returns commands for all nodes in `cfg.Nodes`.
 // It returns error, if any.
-func GenerateApplyCommand(cfg *config.TalhelperConfig, outDir string, node string, extraFlags []string) error {
-	var result []string
+func ApplyCommands(cfg *config.TalhelperConfig, outDir string, node string, extraFlags []string) (Commands, error) {
+	var result Commands
 	for _, n := range cfg.Nodes {
 		isSelectedByIP := ((node != "") && (n.ContainsIP(node)))
 		isSelectedByHostname := ((node != "") && (node == n.Hostname))
@@ -23,301 +23,281 @@ func GenerateApplyCommand(cfg *config.TalhelperConfig, outDir string, node strin
 		if isSelectedByIP {
 			filename, err := n.GetOutputFileName(cfg)
 			if err != nil {
-				return err
+				return nil, err
 			}
+			cmd := newCommand(&n, outDir, node, "apply-config")
+			cmd.ConfigFile = outDir + "/" + filename
 			applyFlags := []string{
-				"--talosconfig=" + outDir + "/talosconfig",
+				"--talosconfig=" + cmd.Talosconfig,
 				"--nodes=" + node,
-				"--file=" + outDir + "/" + filename,
+				"--file=" + cmd.ConfigFile,
 			}
 			applyFlags = append(applyFlags, extraFlags...)
-			result = append(result, fmt.Sprintf("talosctl apply-config %s;", strings.Join(applyFlags, " ")))
+			result = append(result, cmd.withFlags(applyFlags))
 		} else if allNodesSelected || isSelectedByHostname {
 			for _, ip := range n.GetIPAddresses() {
 				filename, err := n.GetOutputFileName(cfg)
 				if err != nil {
-					return err
+					return nil, err
 				}
+				cmd := newCommand(&n, outDir, ip, "apply-config")
+				cmd.ConfigFile = outDir + "/" + filename
 				applyFlags := []string{
-					"--talosconfig=" + outDir + "/talosconfig",
+					"--talosconfig=" + cmd.Talosconfig,
 					"--nodes=" + ip,
-					"--file=" + outDir + "/" + filename,
+					"--file=" + cmd.ConfigFile,
 				}
 				applyFlags = append(applyFlags, extraFlags...)
-				result = append(result, fmt.Sprintf("talosctl apply-config %s;", strings.Join(applyFlags, " ")))
+				result = append(result, cmd.withFlags(applyFlags))
 			}
 		}
 	}
 
 	if len(result) > 0 {
-		for _, r := range result {
-			fmt.Printf("%s\n", r)
-		}
-		return nil
+		return result, nil
 	} else {
-		return fmt.Errorf("node with IP or hostname %s not found", node)
+		return nil, fmt.Errorf("node with IP or hostname %s not found", node)
 	}
 }
 
-// GenerateUpgradeCommand prints out `talosctl upgrade` command for selected node.
+// UpgradeCommands returns `talosctl upgrade` commands for selected node.
 // `outDir` is directory where talosconfig is located.
-// If `node` is empty string, it prints commands for all nodes in `cfg.Nodes`.
+// If `node` is empty string, it returns commands for all nodes in `cfg.Nodes`.
 // It returns error, if any.
-func GenerateUpgradeCommand(cfg *config.TalhelperConfig, outDir string, node string, extraFlags []string, offlineMode bool) error {
-	var result []string
+func UpgradeCommands(cfg *config.TalhelperConfig, outDir string, node string, extraFlags []string, offlineMode bool) (Commands, error) {
+	var result Commands
 	for _, n := range cfg.Nodes {
 		isSelectedByIP := ((node != "") && (n.ContainsIP(node)))
 		isSelectedByHostname := ((node != "") && (node == n.Hostname))
 		allNodesSelected := (node == "")
 
-		var url string
-		if n.TalosImageURL != "" {
-			url = n.TalosImageURL + ":" + cfg.GetTalosVersion()
-		} else if n.Schematic != nil {
-			var err error
-			url, err = talos.GetInstallerURL(n.Schematic, cfg.GetImageFactory(), n.GetMachineSpec(), cfg.GetTalosVersion(), offlineMode)
-			if err != nil {
-				return fmt.Errorf("failed to generate installer url for %s, %v", n.Hostname, err)
-			}
-		} else {
-			url, _ = talos.GetInstallerURL(&schematic.Schematic{}, cfg.GetImageFactory(), n.GetMachineSpec(), cfg.GetTalosVersion(), offlineMode)
+		url, err := installerURL(cfg, &n, offlineMode)
+		if err != nil {
+			return nil, err
 		}
 
 		if isSelectedByIP {
-			upgradeFlags := []string{
-				"--talosconfig=" + outDir + "/talosconfig",
-				"--nodes=" + node,
-				"--image=" + url,
-			}
-			upgradeFlags = append(upgradeFlags, extraFlags...)
-			result = append(result, fmt.Sprintf("talosctl upgrade %s;", strings.Join(upgradeFlags, " ")))
+			result = append(result, upgradeCommand(&n, outDir, node, url, extraFlags))
 		} else if allNodesSelected || isSelectedByHostname {
 			for _, ip := range n.GetIPAddresses() {
-				upgradeFlags := []string{
-					"--talosconfig=" + outDir + "/talosconfig",
-					"--nodes=" + ip,
-					"--image=" + url,
-				}
-				upgradeFlags = append(upgradeFlags, extraFlags...)
-				result = append(result, fmt.Sprintf("talosctl upgrade %s;", strings.Join(upgradeFlags, " ")))
+				result = append(result, upgradeCommand(&n, outDir, ip, url, extraFlags))
 			}
 		}
 	}
 
 	if len(result) > 0 {
-		for _, r := range result {
-			fmt.Printf("%s\n", r)
-		}
-		return nil
+		return result, nil
 	} else {
-		return fmt.Errorf("node with IP or hostname %s not found", node)
+		return nil, fmt.Errorf("node with IP or hostname %s not found", node)
 	}
 }
 
-// GenerateUpgradeK8sCommand prints out `talosctl upgrade-k8s` command for selected node.
-// `outDir` is directory where talosconfig is located.
-// If `node` is empty string, it prints command for the first controlplane node found
-// in `cfg.Nodes`. It returns error if `node` is not found or is not controlplane.
-func GenerateUpgradeK8sCommand(cfg *config.TalhelperConfig, outDir string, node string, extraFlags []string) error {
-	var result string
-
-	if cfg.KubernetesVersion == "" {
-		return fmt.Errorf("`kubernetesVersion` is not defined in the configuration")
+// installerURL returns the installer image url used to upgrade node `n`.
+// It returns error, if any.
+func installerURL(cfg *config.TalhelperConfig, n *config.Node, offlineMode bool) (string, error) {
+	if n.TalosImageURL != "" {
+		return n.TalosImageURL + ":" + cfg.GetTalosVersion(), nil
 	}
 
-	for _, n := range cfg.Nodes {
-		isSelectedByIP := ((node != "") && (n.ContainsIP(node)))
-		isSelectedByHostname := ((node != "") && (node == n.Hostname))
-		noNodeSelected := (node == "")
-		upgradeFlags := []string{
-			"--talosconfig=" + outDir + "/talosconfig",
-			"--to=v" + cfg.GetK8sVersion(),
+	if n.Schematic != nil {
+		url, err := talos.GetInstallerURL(n.Schematic, cfg.GetImageFactory(), n.GetMachineSpec(), cfg.GetTalosVersion(), offlineMode)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate installer url for %s, %v", n.Hostname, err)
 		}
+		return url, nil
+	}
 
-		if noNodeSelected && n.ControlPlane {
-			upgradeFlags = append(upgradeFlags, extraFlags...)
-			// Use the first IP address of the node
-			upgradeFlags = append(upgradeFlags, "--nodes="+n.GetIPAddresses()[0])
-			result = fmt.Sprintf("talosctl upgrade-k8s %s;", strings.Join(upgradeFlags, " "))
-			break
-		}
+	url, _ := talos.GetInstallerURL(&schematic.Schematic{}, cfg.GetImageFactory(), n.GetMachineSpec(), cfg.GetTalosVersion(), offlineMode)
+	return url, nil
+}
 
-		if isSelectedByIP {
-			if !n.ControlPlane {
-				return fmt.Errorf("node with IP %s is not a controlplane node", node)
-			}
-			upgradeFlags = append(upgradeFlags, extraFlags...)
-			upgradeFlags = append(upgradeFlags, "--nodes="+node)
-			result = fmt.Sprintf("talosctl upgrade-k8s %s;", strings.Join(upgradeFlags, " "))
-			break
-		} else if isSelectedByHostname {
-			if !n.ControlPlane {
-				return fmt.Errorf("node with hostname %s is not a controlplane node", node)
-			}
-			upgradeFlags = append(upgradeFlags, extraFlags...)
-			// Use the first IP address of the hostname
-			upgradeFlags = append(upgradeFlags, "--nodes="+n.GetIPAddresses()[0])
-			result = fmt.Sprintf("talosctl upgrade-k8s %s;", strings.Join(upgradeFlags, " "))
-			break
-		}
+func upgradeCommand(n *config.Node, outDir, ip, url string, extraFlags []string) Command {
+	cmd := newCommand(n, outDir, ip, "upgrade")
+	upgradeFlags := []string{
+		"--talosconfig=" + cmd.Talosconfig,
+		"--nodes=" + ip,
+		"--image=" + url,
 	}
+	upgradeFlags = append(upgradeFlags, extraFlags...)
+	return cmd.withFlags(upgradeFlags)
+}
 
-	if result != "" {
-		fmt.Printf("%s\n", result)
-		return nil
-	} else {
-		return fmt.Errorf("node with IP or hostname %s not found", node)
+// GenerateUpgradeK8sCommand prints out `talosctl upgrade-k8s` command for selected node.
+// `outDir` is directory where talosconfig is located.
+// If `node` is empty string, it prints command for the first controlplane node found
+// in `cfg.Nodes`. `output` is the format of the printed command (see `PrintCommands`).
+// It returns error if `node` is not found or is not controlplane.
+func GenerateUpgradeK8sCommand(cfg *config.TalhelperConfig, outDir string, node string, extraFlags []string, output string) error {
+	if err := CheckCommandOutputFormat(output); err != nil {
+		return err
+	}
+	result, err := UpgradeK8sCommands(cfg, outDir, node, extraFlags)
+	if err != nil {
+		return err
 	}
+	return PrintCommands(result, output)
 }
 
-// GenerateBootstrapCommand prints out `talosctl bootstrap` command for selected node.
+// UpgradeK8sCommands returns `talosctl upgrade-k8s` command for selected node.
 // `outDir` is directory where talosconfig is located.
-// If `node` is empty string, it prints command for the first controlplane node found
+// If `node` is empty string, it returns command for the first controlplane node found
 // in `cfg.Nodes`. It returns error if `node` is not found or is not controlplane.
-func GenerateBootstrapCommand(cfg *config.TalhelperConfig, outDir string, node string, extraFlags []string) error {
-	var result string
-	for _, n := range cfg.Nodes {
-		isSelectedByIP := ((node != "") && (n.ContainsIP(node)))
-		isSelectedByHostname := ((node != "") && (node == n.Hostname))
-		noNodeSelected := (node == "")
-		bootstrapFlags := []string{
-			"--talosconfig=" + outDir + "/talosconfig",
-		}
-		if noNodeSelected && n.ControlPlane {
-			bootstrapFlags = append(bootstrapFlags, extraFlags...)
-			// Use the first IP address of the node
-			bootstrapFlags = append(bootstrapFlags, "--nodes="+n.GetIPAddresses()[0])
-			result = fmt.Sprintf("talosctl bootstrap %s;", strings.Join(bootstrapFlags, " "))
-			break
-		}
-		if isSelectedByIP {
-			if !n.ControlPlane {
-				return fmt.Errorf("node with IP %s is not a controlplane node", node)
-			}
-			bootstrapFlags = append(bootstrapFlags, extraFlags...)
-			bootstrapFlags = append(bootstrapFlags, "--nodes="+node)
-			result = fmt.Sprintf("talosctl bootstrap %s;", strings.Join(bootstrapFlags, " "))
-			break
-		} else if isSelectedByHostname {
-			if !n.ControlPlane {
-				return fmt.Errorf("node with hostname %s is not a controlplane node", node)
-			}
-			bootstrapFlags = append(bootstrapFlags, extraFlags...)
-			// Use the first IP address of the hostname
-			bootstrapFlags = append(bootstrapFlags, "--nodes="+n.GetIPAddresses()[0])
-			result = fmt.Sprintf("talosctl bootstrap %s;", strings.Join(bootstrapFlags, " "))
-			break
-		}
+func UpgradeK8sCommands(cfg *config.TalhelperConfig, outDir string, node string, extraFlags []string) (Commands, error) {
+	if cfg.KubernetesVersion == "" {
+		return nil, fmt.Errorf("`kubernetesVersion` is not defined in the configuration")
 	}
 
-	if result != "" {
-		fmt.Printf("%s\n", result)
-		return nil
-	} else {
-		return fmt.Errorf("node with IP or hostname %s not found", node)
-	}
+	return controlPlaneCommand(cfg, outDir, node, "upgrade-k8s", extraFlags, "--to=v"+cfg.GetK8sVersion())
+}
+
+// BootstrapCommands returns `talosctl bootstrap` command for selected node.
+// `outDir` is directory where talosconfig is located.
+// If `node` is empty string, it returns command for the first controlplane node found
+// in `cfg.Nodes`. It returns error if `node` is not found or is not controlplane.
+func BootstrapCommands(cfg *config.TalhelperConfig, outDir string, node string, extraFlags []string) (Commands, error) {
+	return controlPlaneCommand(cfg, outDir, node, "bootstrap", extraFlags)
 }
 
 // GenerateKubeconfigCommand prints out `talosctl kubeconfig` command for selected node.
 // `outDir` is directory where talosconfig is located.
 // If `node` is empty string, it prints command for the first controlplane node found
+// in `cfg.Nodes`. `output` is the format of the printed command (see `PrintCommands`).
+// It returns error if `node` is not found or is not controlplane.
+func GenerateKubeconfigCommand(cfg *config.TalhelperConfig, outDir string, node string, extraFlags []string, output string) error {
+	if err := CheckCommandOutputFormat(output); err != nil {
+		return err
+	}
+	result, err := KubeconfigCommands(cfg, outDir, node, extraFlags)
+	if err != nil {
+		return err
+	}
+	return PrintCommands(result, output)
+}
+
+// KubeconfigCommands returns `talosctl kubeconfig` command for selected node.
+// `outDir` is directory where talosconfig is located.
+// If `node` is empty string, it returns command for the first controlplane node found
 // in `cfg.Nodes`. It returns error if `node` is not found or is not controlplane.
-func GenerateKubeconfigCommand(cfg *config.TalhelperConfig, outDir string, node string, extraFlags []string) error {
-	var result string
+func KubeconfigCommands(cfg *config.TalhelperConfig, outDir string, node string, extraFlags []string) (Commands, error) {
+	return controlPlaneCommand(cfg, outDir, node, "kubeconfig", extraFlags)
+}
+
+// controlPlaneCommand returns `talosctl <subcommand>` command that should only
+// run against a single controlplane node. `flags` are put right after the
+// `--talosconfig` flag. If `node` is empty string, it returns command for the
+// first controlplane node found in `cfg.Nodes`. It returns error if `node` is
+// not found or is not controlplane.
+func controlPlaneCommand(cfg *config.TalhelperConfig, outDir string, node string, subcommand string, extraFlags []string, flags ...string) (Commands, error) {
 	for _, n := range cfg.Nodes {
 		isSelectedByIP := ((node != "") && (n.ContainsIP(node)))
 		isSelectedByHostname := ((node != "") && (node == n.Hostname))
 		noNodeSelected := (node == "")
-		kubeconfigFlags := []string{
-			"--talosconfig=" + outDir + "/talosconfig",
-		}
+
 		if noNodeSelected && n.ControlPlane {
-			kubeconfigFlags = append(kubeconfigFlags, extraFlags...)
 			// Use the first IP address of the node
-			kubeconfigFlags = append(kubeconfigFlags, "--nodes="+n.GetIPAddresses()[0])
-			result = fmt.Sprintf("talosctl kubeconfig %s;", strings.Join(kubeconfigFlags, " "))
-			break
+			return Commands{controlPlaneCommandFor(&n, outDir, n.GetIPAddresses()[0], subcommand, extraFlags, flags)}, nil
 		}
+
 		if isSelectedByIP {
 			if !n.ControlPlane {
-				return fmt.Errorf("node with IP %s is not a controlplane node", node)
+				return nil, fmt.Errorf("node with IP %s is not a controlplane node", node)
 			}
-			kubeconfigFlags = append(kubeconfigFlags, extraFlags...)
-			kubeconfigFlags = append(kubeconfigFlags, "--nodes="+node)
-			result = fmt.Sprintf("talosctl kubeconfig %s;", strings.Join(kubeconfigFlags, " "))
-			break
+			return Commands{controlPlaneCommandFor(&n, outDir, node, subcommand, extraFlags, flags)}, nil
 		} else if isSelectedByHostname {
 			if !n.ControlPlane {
-				return fmt.Errorf("node with hostname %s is not a controlplane node", node)
+				return nil, fmt.Errorf("node with hostname %s is not a controlplane node", node)
 			}
-			kubeconfigFlags = append(kubeconfigFlags, extraFlags...)
 			// Use the first IP address of the hostname
-			kubeconfigFlags = append(kubeconfigFlags, "--nodes="+n.GetIPAddresses()[0])
-			result = fmt.Sprintf("talosctl kubeconfig %s;", strings.Join(kubeconfigFlags, " "))
-			break
+			return Commands{controlPlaneCommandFor(&n, outDir, n.GetIPAddresses()[0], subcommand, extraFlags, flags)}, nil
 		}
 	}
 
-	if result != "" {
-		fmt.Printf("%s\n", result)
-		return nil
-	} else {
-		return fmt.Errorf("node with IP or hostname %s not found", node)
+	return nil, fmt.Errorf("node with IP or hostname %s not found", node)
+}
+
+func controlPlaneCommandFor(n *config.Node, outDir, ip, subcommand string, extraFlags, flags []string) Command {
+	cmd := newCommand(n, outDir, ip, subcommand)
+	cmdFlags := []string{
+		"--talosconfig=" + cmd.Talosconfig,
 	}
+	cmdFlags = append(cmdFlags, flags...)
+	cmdFlags = append(cmdFlags, extraFlags...)
+	cmdFlags = append(cmdFlags, "--nodes="+ip)
+	return cmd.withFlags(cmdFlags)
 }
 
-// GenarateResetCommand prints out `talosctl reset` command for selected node.
+// ResetCommands returns `talosctl reset` commands for selected node.
 // `outDir` is directory where generated talosconfig and node manifest files are located.
-// If `node` is empty string, it prints commands for all nodes in `cfg.Nodes`.
+// If `node` is empty string, it returns commands for all nodes in `cfg.Nodes`.
 // It returns error, if any.
-func GenerateResetCommand(cfg *config.TalhelperConfig, outDir string, node string, extraFlags []string) error {
-	var result []string
+func ResetCommands(cfg *config.TalhelperConfig, outDir string, node string, extraFlags []string) (Commands, error) {
+	var result Commands
 	for _, n := range cfg.Nodes {
 		isSelectedByIP := ((node != "") && (n.ContainsIP(node)))
 		isSelectedByHostname := ((node != "") && (node == n.Hostname))
 		allNodesSelected := (node == "")
 
 		if isSelectedByIP {
+			cmd := newCommand(&n, outDir, node, "reset")
 			resetFlags := []string{
-				"--talosconfig=" + outDir + "/talosconfig",
+				"--talosconfig=" + cmd.Talosconfig,
 				"--nodes=" + node,
 			}
 			resetFlags = append(resetFlags, extraFlags...)
-			result = append(result, fmt.Sprintf("talosctl reset %s;", strings.Join(resetFlags, " ")))
+			result = append(result, cmd.withFlags(resetFlags))
 		} else if allNodesSelected || isSelectedByHostname {
 			for _, ip := range n.GetIPAddresses() {
+				cmd := newCommand(&n, outDir, ip, "reset")
 				resetFlags := []string{
-					"--talosconfig=" + outDir + "/talosconfig",
+					"--talosconfig=" + cmd.Talosconfig,
 					"--nodes=" + ip,
 				}
 				resetFlags = append(resetFlags, extraFlags...)
-				result = append(result, fmt.Sprintf("talosctl reset %s;", strings.Join(resetFlags, " ")))
+				result = append(result, cmd.withFlags(resetFlags))
 			}
 		}
 	}
 
 	if len(result) > 0 {
-		for _, r := range result {
-			fmt.Printf("%s\n", r)
-		}
-		return nil
+		return result, nil
 	} else {
-		return fmt.Errorf("node with IP or hostname %s not found", node)
+		return nil, fmt.Errorf("node with IP or hostname %s not found", node)
+	}
+}
+
+// GenerateHealthCommand prints out `talosctl health` command for selected node.
+// `outDir` is directory where talosconfig is located.
+// If `node` is empty string, it prints command for the first controlplane node found
+// in `cfg.Nodes`. `output` is the format of the printed command (see `PrintCommands`).
+// It returns error, if any.
+func GenerateHealthCommand(cfg *config.TalhelperConfig, outDir string, node string, extraFlags []string, output string) error {
+	if err := CheckCommandOutputFormat(output); err != nil {
+		return err
+	}
+	result, err := HealthCommands(cfg, outDir, node, extraFlags)
+	if err != nil {
+		return err
 	}
+	return PrintCommands(result, output)
 }
 
-func GenerateHealthCommand(cfg *config.TalhelperConfig, outDir string, node string, extraFlags []string) error {
-	var result []string
+// HealthCommands returns `talosctl health` command for selected node.
+// `outDir` is directory where talosconfig is located.
+// If `node` is empty string, it returns command for the first controlplane node found
+// in `cfg.Nodes`. It returns error, if any.
+func HealthCommands(cfg *config.TalhelperConfig, outDir string, node string, extraFlags []string) (Commands, error) {
+	var result Commands
 
 	if node == "" {
 		for _, n := range cfg.Nodes {
 			if n.ControlPlane {
+				cmd := newCommand(&n, outDir, n.GetIPAddresses()[0], "health")
 				healthFlags := []string{
-					"--talosconfig=" + outDir + "/talosconfig",
+					"--talosconfig=" + cmd.Talosconfig,
 					"--nodes=" + n.GetIPAddresses()[0],
 				}
 				healthFlags = append(healthFlags, extraFlags...)
-				result = append(result, fmt.Sprintf("talosctl health %s;", strings.Join(healthFlags, " ")))
+				result = append(result, cmd.withFlags(healthFlags))
 				break
 			}
 		}
@@ -327,22 +307,42 @@ func GenerateHealthCommand(cfg *config.TalhelperConfig, outDir string, node stri
 			isSelectedByHostname := (node == n.Hostname)
 
 			if isSelectedByIP || isSelectedByHostname {
+				ip := node
+				if isSelectedByHostname {
+					ip = n.GetIPAddresses()[0]
+				}
+				cmd := newCommand(&n, outDir, ip, "health")
 				healthFlags := []string{
-					"--talosconfig=" + outDir + "/talosconfig",
+					"--talosconfig=" + cmd.Talosconfig,
 					"--nodes=" + node,
 				}
 				healthFlags = append(healthFlags, extraFlags...)
-				result = append(result, fmt.Sprintf("talosctl health %s;", strings.Join(healthFlags, " ")))
+				result = append(result, cmd.withFlags(healthFlags))
 				break
 			}
 		}
 	}
 	if len(result) > 0 {
-		for _, r := range result {
-			fmt.Printf("%s\n", r)
-		}
-		return nil
+		return result, nil
 	} else {
-		return fmt.Errorf("node with IP or hostname %s not found", node)
+		return nil, fmt.Errorf("node with IP or hostname %s not found", node)
 	}
 }
+
+// newCommand returns `Command` for `talosctl <subcommand>` against `ip` of `n`
+// without any flags.
+func newCommand(n *config.Node, outDir, ip, subcommand string) Command {
+	return Command{
+		Hostname:    n.Hostname,
+		IPAddress:   ip,
+		Role:        n.GetRole(),
+		Talosconfig: outDir + "/talosconfig",
+		Args:        []string{"talosctl", subcommand},
+	}
+}
+
+// withFlags returns a copy of `cmd` with `flags` appended to its arguments.
+func (cmd Command) withFlags(flags []string) Command {
+	cmd.Args = append(slices.Clone(cmd.Args), flags...)
+	return cmd
+}
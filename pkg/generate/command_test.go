@@ -0,0 +1,126 @@
+package generate
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/budimanjojo/talhelper/v3/pkg/config"
+)
+
+func commandTestConfig() *config.TalhelperConfig {
+	return &config.TalhelperConfig{
+		ClusterName:       "test",
+		KubernetesVersion: "v1.30.0",
+		Nodes: []config.Node{
+			{Hostname: "cp1", IPAddress: "10.0.0.1", ControlPlane: true},
+			{Hostname: "worker1", IPAddress: "10.0.0.2, 10.0.0.3"},
+		},
+	}
+}
+
+func TestApplyCommands(t *testing.T) {
+	cmds, err := ApplyCommands(commandTestConfig(), "out", "worker1", []string{"--insecure"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := Commands{
+		{
+			Hostname:    "worker1",
+			IPAddress:   "10.0.0.2",
+			Role:        "worker",
+			Talosconfig: "out/talosconfig",
+			ConfigFile:  "out/test-worker1.yaml",
+			Args:        []string{"talosctl", "apply-config", "--talosconfig=out/talosconfig", "--nodes=10.0.0.2", "--file=out/test-worker1.yaml", "--insecure"},
+		},
+		{
+			Hostname:    "worker1",
+			IPAddress:   "10.0.0.3",
+			Role:        "worker",
+			Talosconfig: "out/talosconfig",
+			ConfigFile:  "out/test-worker1.yaml",
+			Args:        []string{"talosctl", "apply-config", "--talosconfig=out/talosconfig", "--nodes=10.0.0.3", "--file=out/test-worker1.yaml", "--insecure"},
+		},
+	}
+
+	if !reflect.DeepEqual(cmds, expected) {
+		t.Errorf("got:\n%v\nwant:\n%v", cmds, expected)
+	}
+}
+
+func TestUpgradeK8sCommands(t *testing.T) {
+	cmds, err := UpgradeK8sCommands(commandTestConfig(), "out", "", []string{"--dry-run"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "talosctl upgrade-k8s --talosconfig=out/talosconfig --to=v1.30.0 --dry-run --nodes=10.0.0.1;"
+	if len(cmds) != 1 || cmds[0].String() != expected {
+		t.Errorf("got %v, want %s", cmds, expected)
+	}
+
+	if _, err := UpgradeK8sCommands(commandTestConfig(), "out", "worker1", nil); err == nil {
+		t.Error("expected error for worker node, got nil")
+	}
+}
+
+func TestHealthCommands(t *testing.T) {
+	for node, expected := range map[string][2]string{
+		"":         {"10.0.0.1", "10.0.0.1"},
+		"worker1":  {"10.0.0.2", "worker1"},
+		"10.0.0.3": {"10.0.0.3", "10.0.0.3"},
+	} {
+		cmds, err := HealthCommands(commandTestConfig(), "out", node, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		args := []string{"talosctl", "health", "--talosconfig=out/talosconfig", "--nodes=" + expected[1]}
+		if len(cmds) != 1 || cmds[0].IPAddress != expected[0] || !reflect.DeepEqual(cmds[0].Args, args) {
+			t.Errorf("%q: got %+v, want IP address %s and --nodes=%s", node, cmds, expected[0], expected[1])
+		}
+	}
+}
+
+func TestCheckCommandOutputFormat(t *testing.T) {
+	if err := GenerateHealthCommand(commandTestConfig(), "out", "", nil, "xml"); err == nil {
+		t.Error("expected error for unknown format, got nil")
+	}
+	for _, format := range append([]string{""}, CommandOutputFormats...) {
+		if err := CheckCommandOutputFormat(format); err != nil {
+			t.Errorf("%q: %s", format, err)
+		}
+	}
+}
+
+func TestWriteCommands(t *testing.T) {
+	cmds, err := ResetCommands(commandTestConfig(), "out", "cp1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var shell bytes.Buffer
+	if err := writeCommands(&shell, cmds, "shell"); err != nil {
+		t.Fatal(err)
+	}
+	if shell.String() != "talosctl reset --talosconfig=out/talosconfig --nodes=10.0.0.1;\n" {
+		t.Errorf("got unexpected shell output %q", shell.String())
+	}
+
+	var out bytes.Buffer
+	if err := writeCommands(&out, cmds, "json"); err != nil {
+		t.Fatal(err)
+	}
+	var decoded Commands
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, cmds) {
+		t.Errorf("got:\n%v\nwant:\n%v", decoded, cmds)
+	}
+
+	if err := writeCommands(&out, cmds, "xml"); err == nil {
+		t.Error("expected error for unknown format, got nil")
+	}
+}
@@ -0,0 +1,86 @@
+package generate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Command is a `talosctl` command generated for a node. `IPAddress` is the
+// IP address of the node, `Args` target the node the same way it's selected
+// (e.g: `talosctl health` uses the hostname if the node is selected by it).
+type Command struct {
+	Hostname    string   `json:"hostname" yaml:"hostname"`
+	IPAddress   string   `json:"ipAddress" yaml:"ipAddress"`
+	Role        string   `json:"role" yaml:"role"`
+	Talosconfig string   `json:"talosconfig" yaml:"talosconfig"`
+	ConfigFile  string   `json:"configFile,omitempty" yaml:"configFile,omitempty"`
+	Args        []string `json:"args" yaml:"args"`
+}
+
+type Commands []Command
+
+// String returns the command as a shell command ending with `;`.
+func (cmd Command) String() string {
+	return strings.Join(cmd.Args, " ") + ";"
+}
+
+// CommandOutputFormats is the list of supported formats for `PrintCommands`.
+var CommandOutputFormats = []string{"shell", "json", "yaml"}
+
+// CheckCommandOutputFormat returns an error if `format` is not one of
+// `CommandOutputFormats` or empty string, so it can be checked before the
+// commands are generated.
+func CheckCommandOutputFormat(format string) error {
+	if format == "" || slices.Contains(CommandOutputFormats, format) {
+		return nil
+	}
+	return fmt.Errorf("unknown output format %q, should be one of %s", format, strings.Join(CommandOutputFormats, ", "))
+}
+
+// PrintCommands prints `cmds` to stdout in the given `format`.
+// It returns an error, if any.
+func PrintCommands(cmds Commands, format string) error {
+	return writeCommands(os.Stdout, cmds, format)
+}
+
+// writeCommands writes `cmds` into `w` in the given `format`. The `shell`
+// format (or empty string) writes one shell command per line, while `json`
+// and `yaml` write the structured form of `cmds`. It returns an error, if any.
+func writeCommands(w io.Writer, cmds Commands, format string) error {
+	if err := CheckCommandOutputFormat(format); err != nil {
+		return err
+	}
+
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(cmds)
+	case "yaml":
+		buf := new(bytes.Buffer)
+		enc := yaml.NewEncoder(buf)
+		enc.SetIndent(2)
+		if err := enc.Encode(cmds); err != nil {
+			return err
+		}
+		if err := enc.Close(); err != nil {
+			return err
+		}
+		_, err := w.Write(buf.Bytes())
+		return err
+	default:
+		for _, cmd := range cmds {
+			if _, err := fmt.Fprintf(w, "%s\n", cmd); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
 	"path/filepath"
@@ -11,9 +12,6 @@ import (
 	"strings"
 	"time"
 
-	"github.com/hexops/gotextdiff"
-	"github.com/hexops/gotextdiff/myers"
-	"github.com/hexops/gotextdiff/span"
 	"gopkg.in/yaml.v3"
 
 	"github.com/budimanjojo/talhelper/v3/pkg/config"
@@ -24,175 +22,305 @@ import (
 	tconfig "github.com/siderolabs/talos/pkg/machinery/config/config"
 	"github.com/siderolabs/talos/pkg/machinery/config/container"
 	"github.com/siderolabs/talos/pkg/machinery/config/encoder"
+	"github.com/siderolabs/talos/pkg/machinery/config/generate"
 	"github.com/siderolabs/talos/pkg/machinery/config/types/k8s"
 )
 
-// GenerateConfig takes `TalhelperConfig` and path to encrypted `secretFile` and generates
-// Talos `machineconfig` files and a `talosconfig` file in `outDir`.
+// ConfigOptions are the options of `GenerateConfig`.
+type ConfigOptions struct {
+	// OutDir is the directory where the generated files are written to, it is
+	// also where the existing files are read from in `DryRun` mode.
+	OutDir string
+	// Sink is where the generated files are written to, defaults to `OutDir`.
+	Sink Sink
+	// Messages is where the progress messages and the diffs of `DryRun` are
+	// written to, defaults to `os.Stdout`.
+	Messages io.Writer
+	// SecretFile is the path to the (encrypted) secret file, can be empty.
+	SecretFile string
+	// Mode is the Talos runtime mode used to validate the generated config.
+	Mode                string
+	OfflineMode         bool
+	DisableNodesSection bool
+	CrtTTL              time.Duration
+	// Selector selects the nodes to generate config for, defaults to every node.
+	// The `talosconfig` is always generated from every node.
+	Selector *config.NodeSelector
+	// Parallelism is the maximum number of node configs generated at the same time.
+	Parallelism int
+	// DryRun shows the diff against the existing files instead of writing them.
+	DryRun bool
+	// DiffMode is one of `DiffModes`, defaults to `text`.
+	DiffMode string
+	// ShowSecrets shows secret values in the diff instead of their hashes.
+	ShowSecrets bool
+	// DiffExitCode makes `GenerateConfig` return `ErrConfigChanged` when
+	// `DryRun` found changes.
+	DiffExitCode bool
+	// Policy rules with `config.PolicyTargetMachineConfig` target are
+	// evaluated against the generated node configs, the issues are reported
+	// with `Reporter` before anything is written.
+	Policy   *config.Policy
+	Reporter *config.Reporter
+}
+
+// GenerateConfig takes `TalhelperConfig` and `opts` and generates Talos
+// `machineconfig` files and a `talosconfig` file into `opts.Sink`. The sink is
+// not closed, so the caller must close it after `GenerateConfig` returns.
+// Only nodes selected by `opts.Selector` are generated, using at most
+// `opts.Parallelism` workers, but they are always written (or diffed) in the
+// order they're defined in `c.Nodes`.
 // It returns an error, if any.
-func GenerateConfig(c *config.TalhelperConfig, dryRun bool, outDir, secretFile, mode string, offlineMode bool, disableNodesSection bool, crtTTL time.Duration) error {
-	input, err := talos.NewClusterInput(c, secretFile, mode)
+func GenerateConfig(c *config.TalhelperConfig, opts ConfigOptions) error {
+	if opts.DiffMode != "" && !slices.Contains(DiffModes, opts.DiffMode) {
+		return fmt.Errorf("unknown diff mode %q, should be one of %s", opts.DiffMode, strings.Join(DiffModes, ", "))
+	}
+
+	sink := opts.Sink
+	if sink == nil {
+		sink = &dirSink{dir: opts.OutDir}
+	}
+	msgs := opts.Messages
+	if msgs == nil {
+		msgs = os.Stdout
+	}
+
+	selected, err := c.SelectNodes(opts.Selector)
 	if err != nil {
 		return err
 	}
 
-	vc := input.Options.VersionContract
+	input, err := talos.NewClusterInput(c, opts.SecretFile, opts.Mode)
+	if err != nil {
+		return err
+	}
+
+	cfgFiles := make([]string, len(selected))
+	cfgs := make([][]byte, len(selected))
+
+	err = forEachParallel(len(selected), opts.Parallelism, func(i int) error {
+		node := c.Nodes[selected[i]]
 
-	for _, node := range c.Nodes {
 		fileName, err := node.GetOutputFileName(c)
 		if err != nil {
-			return err
+			return fmt.Errorf("node %s: %w", node.Hostname, err)
 		}
-		cfgFile := outDir + "/" + fileName
-		slog.Debug(fmt.Sprintf("generating %s for node %s", cfgFile, node.Hostname))
+		cfgFiles[i] = fileName
+		slog.Debug(fmt.Sprintf("generating %s for node %s", fileName, node.Hostname))
 
-		rawcfg, err := talos.GenerateNodeConfig(&node, input, c.GetImageFactory(), offlineMode)
+		cfgs[i], err = generateNodeConfig(c, &node, input, opts.Mode, opts.OfflineMode)
 		if err != nil {
-			return err
-		}
-
-		if c.CNIConfig != nil {
-			switch vc.MultidocKubernetesConfigSupported() {
-			case true:
-				// we remove the autogenerated KubeFlannelConfig first
-				docs := slices.DeleteFunc(rawcfg.Documents(), func(doc tconfig.Document) bool {
-					if _, ok := doc.(*k8s.KubeFlannelCNIConfigV1Alpha1); ok {
-						return true
-					}
-					return false
-				})
-
-				if c.CNIConfig.CNIName == "flannel" {
-					// we create our own here
-					flannelCfg := k8s.NewKubeFlannelCNIConfigV1Alpha1()
-					flannelCfg.FlannelBackendType = "vxlan"
-					flannelCfg.FlannelBackendPort = 4789
-					if c.CNIConfig.CNIFlannel != nil {
-						flannelCfg.FlannelExtraArgs = c.CNIConfig.CNIFlannel.FlanneldExtraArgs
-						flannelCfg.FlannelKubeNetworkPoliciesEnabled = c.CNIConfig.CNIFlannel.FlannelKubeNetworkPoliciesEnabled
-					}
-					docs = append(docs, flannelCfg)
-				}
-
-				if c.CNIConfig.CNIName == "custom" {
-					for _, url := range c.CNIConfig.CNIUrls {
-						rawcfg.RawV1Alpha1().ClusterConfig.ExtraManifests = append(rawcfg.RawV1Alpha1().ClusterConfig.ExtraManifests, url)
-					}
-				}
-
-				// repack the rawCfg back to next process
-				rawcfg, _ = container.New(docs...)
-
-			case false:
-				//nolint:staticcheck
-				rawcfg.RawV1Alpha1().ClusterConfig.ClusterNetwork.CNI = c.CNIConfig
-			}
+			return fmt.Errorf("node %s: %w", node.Hostname, err)
 		}
 
-		// this is needed because the upstream cluster input doesn't handle inline manifests and some others so we need to do it ourselves
-		if len(c.ClusterInlineManifests) > 0 {
-			rawcfg.RawV1Alpha1().ClusterConfig.ClusterInlineManifests = *c.ClusterInlineManifests.GetIMs()
-		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
 
-		cfg, err := rawcfg.EncodeBytes(encoder.WithComments(encoder.CommentsDisabled))
-		if err != nil {
+	if errs, warns := opts.Policy.ValidateMachineConfigs(*c, selected, cfgs); len(errs) > 0 || len(warns) > 0 {
+		if err := opts.Reporter.Report(errs, warns); err != nil {
 			return err
 		}
+	}
 
-		cfg, err = talos.AddMultiDocs(&node, mode, cfg, vc)
-		if err != nil {
-			return err
-		}
+	changed := false
+	for i, idx := range selected {
+		node, cfgFile, cfg := c.Nodes[idx], cfgFiles[i], cfgs[i]
 
-		if len(node.Patches) != 0 {
-			slog.Debug(fmt.Sprintf("applying node specific patches to %s", node.Hostname))
-			cfg, err = patcher.PatchesPatcher(node.Patches, cfg)
+		if !opts.DryRun {
+			slog.Debug(fmt.Sprintf("writing machineconfig file for %s to %s", node.Hostname, sink.Location(cfgFile)))
+			err = sink.Write(cfgFile, cfg)
 			if err != nil {
 				return err
 			}
-		}
 
-		if len(c.Patches) > 0 {
-			slog.Debug(fmt.Sprintf("applying global patches to %s", node.Hostname))
-			cfg, err = patcher.PatchesPatcher(c.Patches, cfg)
+			fmt.Fprintf(msgs, "generated config for %s in %s\n", node.Hostname, sink.Location(cfgFile))
+		} else {
+			slog.Debug("showing diff from previous run")
+			cfgFile = opts.OutDir + "/" + cfgFile
+			absCfgFile, err := filepath.Abs(cfgFile)
 			if err != nil {
 				return err
 			}
-		}
 
-		if len(node.ExtraManifests) > 0 {
-			slog.Debug(fmt.Sprintf("generating extra manifests for %s", node.Hostname))
-			content, err := combineExtraManifests(node.ExtraManifests, cfg)
+			before, err := getFileContentByte(absCfgFile)
 			if err != nil {
 				return err
 			}
-			cfg = append(cfg, content...)
-		}
-
-		err = talos.ValidateConfigFromBytes(cfg, mode)
-		if err != nil {
-			return err
-		}
-
-		cfg, err = reencodeYaml(cfg)
-		if err != nil {
-			return err
-		}
 
-		if !dryRun {
-			slog.Debug(fmt.Sprintf("dumping machineconfig file for %s to %s", node.Hostname, cfgFile))
-			err = dumpFile(cfgFile, cfg)
-			if err != nil {
-				return err
+			after := cfg
+			// SOPS doesn't keep the formatting of the original file, so both
+			// sides are normalized to not show formatting changes as diff
+			if isEncryptedFile(absCfgFile) {
+				if before, err = normalizeYaml(before); err != nil {
+					return fmt.Errorf("failed to parse %s: %w", cfgFile, err)
+				}
+				if after, err = normalizeYaml(after); err != nil {
+					return fmt.Errorf("failed to parse generated config for %s: %w", node.Hostname, err)
+				}
 			}
 
-			fmt.Printf("generated config for %s in %s\n", node.Hostname, cfgFile)
-		} else {
-			slog.Debug("showing diff from previous run")
-			absCfgFile, err := filepath.Abs(cfgFile)
-			if err != nil {
-				return err
+			if !opts.ShowSecrets {
+				if before, err = redactSecrets(before); err != nil {
+					return fmt.Errorf("failed to redact secrets in %s: %w", cfgFile, err)
+				}
+				if after, err = redactSecrets(after); err != nil {
+					return fmt.Errorf("failed to redact secrets in generated config for %s: %w", node.Hostname, err)
+				}
 			}
 
-			before, err := getFileContent(absCfgFile)
-			if err != nil {
-				return err
+			var diff string
+			if opts.DiffMode == "semantic" {
+				diff, err = computeSemanticDiff(absCfgFile, before, after)
+				if err != nil {
+					return fmt.Errorf("failed to compute diff for %s: %w", cfgFile, err)
+				}
+			} else {
+				diff = computeDiff(absCfgFile, string(before), string(after))
 			}
 
-			diff := computeDiff(absCfgFile, before, string(cfg))
 			if diff != "" {
-				fmt.Println(diff)
+				changed = true
+				fmt.Fprintln(msgs, diff)
 			} else {
-				fmt.Printf("no changes found on %s\n", cfgFile)
+				fmt.Fprintf(msgs, "no changes found on %s\n", cfgFile)
 			}
 		}
 	}
 
-	if !dryRun {
-		clientCfg, err := talos.GenerateClientConfigBytes(c, input, disableNodesSection, crtTTL)
+	if !opts.DryRun {
+		clientCfg, err := talos.GenerateClientConfigBytes(c, input, opts.DisableNodesSection, opts.CrtTTL)
 		if err != nil {
 			return err
 		}
 
 		fileName := "talosconfig"
 
-		slog.Debug(fmt.Sprintf("dumping talosconfig file to %s", outDir+"/"+fileName))
-		err = dumpFile(outDir+"/"+fileName, clientCfg)
+		slog.Debug(fmt.Sprintf("writing talosconfig file to %s", sink.Location(fileName)))
+		err = sink.Write(fileName, clientCfg)
 		if err != nil {
 			return err
 		}
 
-		fmt.Printf("generated client config in %s\n", outDir+"/"+fileName)
+		fmt.Fprintf(msgs, "generated client config in %s\n", sink.Location(fileName))
+	}
+
+	if changed && opts.DiffExitCode {
+		return ErrConfigChanged
 	}
 
 	return nil
 }
 
-// getFileContent returns content of file as string.
-// It also returns an error, if any
-func getFileContent(path string) (string, error) {
-	content, err := getFileContentByte(path)
-	return string(content), err
+// generateNodeConfig generates the final Talos `machineconfig` bytes for `node`,
+// with CNI, inline manifests, multi documents, patches and extra manifests applied.
+// The result is validated against `mode` and re-encoded. It returns an error, if any.
+func generateNodeConfig(c *config.TalhelperConfig, node *config.Node, input *generate.Input, mode string, offlineMode bool) ([]byte, error) {
+	cfg, err := generateBaseNodeConfig(c, node, input, mode, offlineMode)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(node.Patches) != 0 {
+		slog.Debug(fmt.Sprintf("applying node specific patches to %s", node.Hostname))
+		cfg, err = patcher.PatchesPatcher(node.Patches, cfg)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(c.Patches) > 0 {
+		slog.Debug(fmt.Sprintf("applying global patches to %s", node.Hostname))
+		cfg, err = patcher.PatchesPatcher(c.Patches, cfg)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(node.ExtraManifests) > 0 {
+		slog.Debug(fmt.Sprintf("generating extra manifests for %s", node.Hostname))
+		content, err := combineExtraManifests(node.ExtraManifests, cfg)
+		if err != nil {
+			return nil, err
+		}
+		cfg = append(cfg, content...)
+	}
+
+	err = talos.ValidateConfigFromBytes(cfg, mode)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err = reencodeYaml(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// generateBaseNodeConfig generates the Talos `machineconfig` bytes for `node`
+// with CNI, inline manifests and multi documents applied, but without patches
+// and extra manifests. It returns an error, if any.
+func generateBaseNodeConfig(c *config.TalhelperConfig, node *config.Node, input *generate.Input, mode string, offlineMode bool) ([]byte, error) {
+	vc := input.Options.VersionContract
+
+	rawcfg, err := talos.GenerateNodeConfig(node, input, c.GetImageFactory(), offlineMode)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.CNIConfig != nil {
+		switch vc.MultidocKubernetesConfigSupported() {
+		case true:
+			// we remove the autogenerated KubeFlannelConfig first
+			docs := slices.DeleteFunc(rawcfg.Documents(), func(doc tconfig.Document) bool {
+				if _, ok := doc.(*k8s.KubeFlannelCNIConfigV1Alpha1); ok {
+					return true
+				}
+				return false
+			})
+
+			if c.CNIConfig.CNIName == "flannel" {
+				// we create our own here
+				flannelCfg := k8s.NewKubeFlannelCNIConfigV1Alpha1()
+				flannelCfg.FlannelBackendType = "vxlan"
+				flannelCfg.FlannelBackendPort = 4789
+				if c.CNIConfig.CNIFlannel != nil {
+					flannelCfg.FlannelExtraArgs = c.CNIConfig.CNIFlannel.FlanneldExtraArgs
+					flannelCfg.FlannelKubeNetworkPoliciesEnabled = c.CNIConfig.CNIFlannel.FlannelKubeNetworkPoliciesEnabled
+				}
+				docs = append(docs, flannelCfg)
+			}
+
+			if c.CNIConfig.CNIName == "custom" {
+				for _, url := range c.CNIConfig.CNIUrls {
+					rawcfg.RawV1Alpha1().ClusterConfig.ExtraManifests = append(rawcfg.RawV1Alpha1().ClusterConfig.ExtraManifests, url)
+				}
+			}
+
+			// repack the rawCfg back to next process
+			rawcfg, _ = container.New(docs...)
+
+		case false:
+			//nolint:staticcheck
+			rawcfg.RawV1Alpha1().ClusterConfig.ClusterNetwork.CNI = c.CNIConfig
+		}
+	}
+
+	// this is needed because the upstream cluster input doesn't handle inline manifests and some others so we need to do it ourselves
+	if len(c.ClusterInlineManifests) > 0 {
+		rawcfg.RawV1Alpha1().ClusterConfig.ClusterInlineManifests = *c.ClusterInlineManifests.GetIMs()
+	}
+
+	cfg, err := rawcfg.EncodeBytes(encoder.WithComments(encoder.CommentsDisabled))
+	if err != nil {
+		return nil, err
+	}
+
+	return talos.AddMultiDocs(node, mode, cfg, vc)
 }
 
 // getFileContentByte returns content of file. It also returns an error,
@@ -207,6 +335,15 @@ func getFileContentByte(path string) ([]byte, error) {
 	}
 }
 
+// isEncryptedFile returns true if file in `path` is a `sops` encrypted yaml.
+func isEncryptedFile(path string) bool {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	return decrypt.IsYamlEncrypted(content)
+}
+
 // combineExtraManifests takes list of filepaths, parse go template using data from
 // main config manifest, combines them into a single file in bytes with `---\n` prepended.
 // It also returns an error, if any
@@ -232,14 +369,6 @@ func combineExtraManifests(extraFiles []string, templateData []byte) ([]byte, er
 	return talos.CombineYamlBytes(result), nil
 }
 
-// computeDiff returns diff between before and after string
-// using Myers diff algorithm
-func computeDiff(path, before, after string) string {
-	edits := myers.ComputeEdits(span.URIFromPath(path), before, after)
-	diff := gotextdiff.ToUnified("a"+path, "b"+path, before, edits)
-	return fmt.Sprint(diff)
-}
-
 // dumpFile creates file in `path` and dumps the content of bytes into
 // the path. It returns an error, if any.
 func dumpFile(path string, file []byte) error {
@@ -261,6 +390,36 @@ func dumpFile(path string, file []byte) error {
 	return nil
 }
 
+// normalizeYaml re encode yaml bytes without keeping comments, styles and
+// order of keys. It returns an error, if any.
+func normalizeYaml(input []byte) ([]byte, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(input))
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+
+	for {
+		var doc any
+		if err := dec.Decode(&doc); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+
+		if err := enc.Encode(doc); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
 // reencodeYaml re encode yaml bytes but the indentation is set to 2.
 // It returns and error, if any.
 func reencodeYaml(input []byte) ([]byte, error) {
@@ -0,0 +1,264 @@
+package generate
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/hexops/gotextdiff"
+	"github.com/hexops/gotextdiff/myers"
+	"github.com/hexops/gotextdiff/span"
+	"gopkg.in/yaml.v3"
+)
+
+// DiffModes is the list of supported diff modes for `genconfig --dry-run`.
+var DiffModes = []string{"text", "semantic"}
+
+// ErrConfigChanged is returned by `GenerateConfig` in dry-run mode when
+// `DiffExitCode` is set and at least one of the generated files changed.
+var ErrConfigChanged = errors.New("generated config files changed")
+
+// Change types of a `DiffChange`.
+const (
+	ChangeAdded    = "added"
+	ChangeRemoved  = "removed"
+	ChangeModified = "modified"
+)
+
+// DiffChange is a single change found by `semanticDiff`.
+type DiffChange struct {
+	// Document is the identifier of the Talos config document, which is
+	// `kind/name` for named documents, `kind` for unnamed documents and
+	// `v1alpha1` for the main machine config document.
+	Document string
+	// Path is the YAML path of the change inside the document, it is empty
+	// if the whole document is added or removed.
+	Path   string
+	Type   string
+	Before any
+	After  any
+}
+
+type diffDocument struct {
+	id      string
+	content any
+}
+
+// computeDiff returns diff between before and after string
+// using Myers diff algorithm
+func computeDiff(path, before, after string) string {
+	edits := myers.ComputeEdits(span.URIFromPath(path), before, after)
+	diff := gotextdiff.ToUnified("a"+path, "b"+path, before, edits)
+	return fmt.Sprint(diff)
+}
+
+// computeSemanticDiff returns the changes between `before` and `after` Talos
+// config as a human readable string, or an empty string if there's no change.
+// It returns an error, if any.
+func computeSemanticDiff(path string, before, after []byte) (string, error) {
+	changes, err := semanticDiff(before, after)
+	if err != nil {
+		return "", err
+	}
+	if len(changes) == 0 {
+		return "", nil
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n", path)
+	for _, c := range changes {
+		switch {
+		case c.Path == "" && c.Type == ChangeAdded:
+			fmt.Fprintf(&b, "+ %s: document added\n", c.Document)
+		case c.Path == "" && c.Type == ChangeRemoved:
+			fmt.Fprintf(&b, "- %s: document removed\n", c.Document)
+		case c.Type == ChangeAdded:
+			fmt.Fprintf(&b, "+ %s: %s: %s\n", c.Document, c.Path, diffValue(c.After))
+		case c.Type == ChangeRemoved:
+			fmt.Fprintf(&b, "- %s: %s: %s\n", c.Document, c.Path, diffValue(c.Before))
+		default:
+			fmt.Fprintf(&b, "~ %s: %s: %s -> %s\n", c.Document, c.Path, diffValue(c.Before), diffValue(c.After))
+		}
+	}
+
+	return b.String(), nil
+}
+
+// semanticDiff parses `before` and `after` as multi document Talos config and
+// returns the changes between them. Documents are matched by their kind and
+// name, so the order of documents and keys doesn't matter.
+// It returns an error, if any.
+func semanticDiff(before, after []byte) ([]DiffChange, error) {
+	beforeDocs, err := parseDiffDocuments(before)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse previous config: %w", err)
+	}
+	afterDocs, err := parseDiffDocuments(after)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse generated config: %w", err)
+	}
+
+	beforeByID := map[string]any{}
+	for _, doc := range beforeDocs {
+		beforeByID[doc.id] = doc.content
+	}
+
+	var changes []DiffChange
+	seen := map[string]bool{}
+	for _, doc := range afterDocs {
+		seen[doc.id] = true
+		old, ok := beforeByID[doc.id]
+		if !ok {
+			changes = append(changes, DiffChange{Document: doc.id, Type: ChangeAdded, After: doc.content})
+			continue
+		}
+		changes = diffValues(changes, doc.id, "", old, doc.content)
+	}
+
+	for _, doc := range beforeDocs {
+		if !seen[doc.id] {
+			changes = append(changes, DiffChange{Document: doc.id, Type: ChangeRemoved, Before: doc.content})
+		}
+	}
+
+	return changes, nil
+}
+
+// parseDiffDocuments splits multi document YAML `data` into documents
+// identified by their kind and name. It returns an error, if any.
+func parseDiffDocuments(data []byte) ([]diffDocument, error) {
+	var result []diffDocument
+	ids := map[string]int{}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var content any
+		if err := dec.Decode(&content); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+		if content == nil {
+			continue
+		}
+
+		id := documentID(content)
+		// documents with the same identifier are matched in the order they appear
+		if n := ids[id]; n > 0 {
+			ids[id]++
+			id = fmt.Sprintf("%s#%d", id, n)
+		} else {
+			ids[id] = 1
+		}
+
+		result = append(result, diffDocument{id: id, content: content})
+	}
+
+	return result, nil
+}
+
+func documentID(content any) string {
+	m, ok := content.(map[string]any)
+	if !ok {
+		return "unknown"
+	}
+
+	kind, _ := m["kind"].(string)
+	if kind == "" {
+		if version, ok := m["version"].(string); ok {
+			return version
+		}
+		return "unknown"
+	}
+
+	if name, ok := m["name"].(string); ok && name != "" {
+		return kind + "/" + name
+	}
+
+	return kind
+}
+
+// diffValues appends the changes between `before` and `after` found in `path`
+// of `doc` into `changes` and returns the result.
+func diffValues(changes []DiffChange, doc, path string, before, after any) []DiffChange {
+	beforeMap, beforeIsMap := before.(map[string]any)
+	afterMap, afterIsMap := after.(map[string]any)
+	if beforeIsMap && afterIsMap {
+		keys := slices.Sorted(maps.Keys(afterMap))
+		for _, k := range slices.Sorted(maps.Keys(beforeMap)) {
+			if _, ok := afterMap[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+
+		for _, k := range keys {
+			b, inBefore := beforeMap[k]
+			a, inAfter := afterMap[k]
+			p := joinMapPath(path, k)
+			switch {
+			case !inBefore:
+				changes = append(changes, DiffChange{Document: doc, Path: p, Type: ChangeAdded, After: a})
+			case !inAfter:
+				changes = append(changes, DiffChange{Document: doc, Path: p, Type: ChangeRemoved, Before: b})
+			default:
+				changes = diffValues(changes, doc, p, b, a)
+			}
+		}
+		return changes
+	}
+
+	beforeList, beforeIsList := before.([]any)
+	afterList, afterIsList := after.([]any)
+	if beforeIsList && afterIsList {
+		for i := range max(len(beforeList), len(afterList)) {
+			p := fmt.Sprintf("%s[%d]", path, i)
+			switch {
+			case i >= len(beforeList):
+				changes = append(changes, DiffChange{Document: doc, Path: p, Type: ChangeAdded, After: afterList[i]})
+			case i >= len(afterList):
+				changes = append(changes, DiffChange{Document: doc, Path: p, Type: ChangeRemoved, Before: beforeList[i]})
+			default:
+				changes = diffValues(changes, doc, p, beforeList[i], afterList[i])
+			}
+		}
+		return changes
+	}
+
+	if !reflect.DeepEqual(before, after) {
+		changes = append(changes, DiffChange{Document: doc, Path: path, Type: ChangeModified, Before: before, After: after})
+	}
+
+	return changes
+}
+
+var plainPathKey = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// joinMapPath appends `key` to YAML `path`, keys that can't be written
+// in dotted form (e.g: `node.kubernetes.io/role`) are quoted.
+func joinMapPath(path, key string) string {
+	if !plainPathKey.MatchString(key) {
+		return fmt.Sprintf("%s[%q]", path, key)
+	}
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func diffValue(v any) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return fmt.Sprint(v)
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
@@ -0,0 +1,102 @@
+package generate
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSemanticDiff(t *testing.T) {
+	before := []byte(`version: v1alpha1
+machine:
+  network:
+    hostname: node1
+    interfaces:
+      - interface: eth0
+        addresses:
+          - 10.0.0.1/24
+  nodeLabels:
+    rack: a
+---
+apiVersion: v1alpha1
+kind: NetworkRuleConfig
+name: rule1
+portSelector:
+  ports:
+    - 50000
+---
+apiVersion: v1alpha1
+kind: NetworkRuleConfig
+name: rule2
+`)
+
+	// same config, but key and document order is shuffled
+	after := []byte(`apiVersion: v1alpha1
+kind: NetworkRuleConfig
+name: rule3
+---
+machine:
+  nodeLabels:
+    rack: b
+    topology.kubernetes.io/zone: z1
+  network:
+    interfaces:
+      - addresses:
+          - 10.0.0.2/24
+        interface: eth0
+    hostname: node1
+version: v1alpha1
+---
+name: rule1
+kind: NetworkRuleConfig
+apiVersion: v1alpha1
+portSelector:
+  ports:
+    - 50000
+`)
+
+	changes, err := semanticDiff(before, after)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []DiffChange{
+		{Document: "NetworkRuleConfig/rule3", Type: ChangeAdded, After: map[string]any{"apiVersion": "v1alpha1", "kind": "NetworkRuleConfig", "name": "rule3"}},
+		{Document: "v1alpha1", Path: "machine.network.interfaces[0].addresses[0]", Type: ChangeModified, Before: "10.0.0.1/24", After: "10.0.0.2/24"},
+		{Document: "v1alpha1", Path: "machine.nodeLabels.rack", Type: ChangeModified, Before: "a", After: "b"},
+		{Document: "v1alpha1", Path: `machine.nodeLabels["topology.kubernetes.io/zone"]`, Type: ChangeAdded, After: "z1"},
+		{Document: "NetworkRuleConfig/rule2", Type: ChangeRemoved, Before: map[string]any{"apiVersion": "v1alpha1", "kind": "NetworkRuleConfig", "name": "rule2"}},
+	}
+
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("got:\n%#v\nwant:\n%#v", changes, expected)
+	}
+}
+
+func TestComputeSemanticDiff(t *testing.T) {
+	cfg := []byte("version: v1alpha1\nmachine:\n  token: abc\n")
+
+	diff, err := computeSemanticDiff("node.yaml", cfg, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff != "" {
+		t.Errorf("expected no diff, got %q", diff)
+	}
+
+	diff, err = computeSemanticDiff("node.yaml", nil, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff != "--- node.yaml\n+ v1alpha1: document added\n" {
+		t.Errorf("got unexpected diff %q", diff)
+	}
+
+	diff, err = computeSemanticDiff("node.yaml", []byte("version: v1alpha1\nmachine:\n  token: def\n  type: worker\n"), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "--- node.yaml\n~ v1alpha1: machine.token: \"def\" -> \"abc\"\n- v1alpha1: machine.type: \"worker\"\n"
+	if diff != expected {
+		t.Errorf("got:\n%s\nwant:\n%s", diff, expected)
+	}
+}
@@ -0,0 +1,424 @@
+package generate
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/budimanjojo/talhelper/v3/pkg/config"
+	"github.com/budimanjojo/talhelper/v3/pkg/patcher"
+	"github.com/budimanjojo/talhelper/v3/pkg/talos"
+)
+
+// ExplainFormats is the list of supported output formats for `PrintExplanation`.
+var ExplainFormats = []string{"text", "json"}
+
+// Provenance is where the value in `Path` of `Document` comes from.
+type Provenance struct {
+	Document string `json:"document,omitempty"`
+	Path     string `json:"path"`
+	Value    any    `json:"value"`
+	Source   string `json:"source"`
+}
+
+// Explanation is the effective configuration of a node returned by `ExplainNode`.
+type Explanation struct {
+	Hostname string `json:"hostname"`
+	// Node is the effective `Node` after it's merged with its node groups.
+	Node []Provenance `json:"node"`
+	// Config is the generated Talos `machineconfig` of the node.
+	Config []Provenance `json:"config"`
+}
+
+// ExplainNode returns the effective configuration of the node with hostname or
+// IP address `node` and its generated Talos `machineconfig`, with the source of
+// every value. `raw` is the config as returned by `config.LoadClusterFromFile`
+// and `c` is the same config as returned by `config.LoadAndValidateClusterFromFile`.
+// Only `SecretFile`, `Mode`, `OfflineMode` and `ShowSecrets` of `opts` are used.
+// It returns an error, if any.
+func ExplainNode(raw, c *config.TalhelperConfig, node string, opts ConfigOptions) (*Explanation, error) {
+	s, err := config.NewNodeSelector([]string{node}, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	selected, err := c.SelectNodes(s)
+	if err != nil {
+		return nil, err
+	}
+	idx := selected[0]
+	rawNode, n := &raw.Nodes[idx], &c.Nodes[idx]
+
+	layers := append([]config.NodeConfigsLayer{{Source: "node", NodeConfigs: rawNode.NodeConfigs}}, reversed(raw.GetNodeGroupsLayers(rawNode))...)
+
+	nodeProv, err := explainNodeValues(rawNode, n, layers)
+	if err != nil {
+		return nil, err
+	}
+
+	cfgProv, err := explainNodeConfig(c, n, layers, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Explanation{Hostname: n.Hostname, Node: nodeProv, Config: cfgProv}, nil
+}
+
+// Filter returns the values of `e` found in `path` (e.g: `machine.install`).
+// It returns an error if nothing is found.
+func (e *Explanation) Filter(path string) (*Explanation, error) {
+	if path == "" {
+		return e, nil
+	}
+
+	match := func(p Provenance) bool { return !isUnderPath(p.Path, path) }
+	result := &Explanation{
+		Hostname: e.Hostname,
+		Node:     slices.DeleteFunc(slices.Clone(e.Node), match),
+		Config:   slices.DeleteFunc(slices.Clone(e.Config), match),
+	}
+	if len(result.Node) == 0 && len(result.Config) == 0 {
+		return nil, fmt.Errorf("no value found in %q for node %s", path, e.Hostname)
+	}
+
+	return result, nil
+}
+
+// PrintExplanation prints `e` to stdout in the given `format`.
+// It returns an error, if any.
+func PrintExplanation(e *Explanation, format string) error {
+	return writeExplanation(os.Stdout, e, format)
+}
+
+// writeExplanation writes `e` into `w` in the given `format`. The `text` format
+// (or empty string) writes one value per line with its source as a comment.
+// It returns an error, if any.
+func writeExplanation(w io.Writer, e *Explanation, format string) error {
+	switch format {
+	case "", "text":
+		if len(e.Node) > 0 {
+			fmt.Fprintf(w, "# node %s\n", e.Hostname)
+			writeProvenances(w, e.Node)
+		}
+		if len(e.Config) > 0 {
+			if len(e.Node) > 0 {
+				fmt.Fprintln(w)
+			}
+			fmt.Fprintf(w, "# machineconfig of %s\n", e.Hostname)
+			writeProvenances(w, e.Config)
+		}
+		return nil
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		return enc.Encode(e)
+	default:
+		return fmt.Errorf("unknown output format %q, should be one of %s", format, strings.Join(ExplainFormats, ", "))
+	}
+}
+
+// maxExplainAlignWidth is the maximum width of lines aligned by `writeProvenances`.
+const maxExplainAlignWidth = 80
+
+func writeProvenances(w io.Writer, provs []Provenance) {
+	lines := make([]string, len(provs))
+	width := 0
+	for i, p := range provs {
+		lines[i] = p.Path + ": " + diffValue(p.Value)
+		if p.Document != "" {
+			lines[i] = p.Document + ": " + lines[i]
+		}
+		// long values like certificates are not used to align the sources
+		if len(lines[i]) <= maxExplainAlignWidth {
+			width = max(width, len(lines[i]))
+		}
+	}
+
+	for i, p := range provs {
+		fmt.Fprintf(w, "%-*s  # %s\n", width, lines[i], p.Source)
+	}
+}
+
+// explainNodeValues returns the provenance of every value of `n`, which is
+// `rawNode` merged with its node groups. `layers` are the `NodeConfigs` of the
+// node and its node groups, from the highest precedence. Values that are not
+// set but have a default in `config` are returned with `default` source.
+func explainNodeValues(rawNode, n *config.Node, layers []config.NodeConfigsLayer) ([]Provenance, error) {
+	merged, err := toYamlValue(n)
+	if err != nil {
+		return nil, err
+	}
+
+	defaults := config.Node{NodeConfigs: config.NodeConfigs{
+		MachineSpec:  *n.GetMachineSpec(),
+		FilenameTmpl: n.GetFilenameTmpl(),
+	}}
+	defaultValues, err := toYamlValue(&defaults)
+	if err != nil {
+		return nil, err
+	}
+	defaultPaths := map[string]bool{}
+	fillDefaults(merged.(map[string]any), defaultValues.(map[string]any), "", defaultPaths)
+
+	// the node itself also defines the fields outside of `NodeConfigs`
+	layerValues := make([][]Provenance, len(layers))
+	for i, layer := range layers {
+		var v any
+		if i == 0 {
+			v, err = toYamlValue(rawNode)
+		} else {
+			v, err = toYamlValue(&config.Node{NodeConfigs: layer.NodeConfigs})
+		}
+		if err != nil {
+			return nil, err
+		}
+		layerValues[i] = flattenValue(nil, "", "", v)
+	}
+
+	result := flattenValue(nil, "", "", merged)
+	for i := range result {
+		switch {
+		case defaultPaths[result[i].Path]:
+			result[i].Source = "default"
+		default:
+			result[i].Source = findValueSource(result[i], layers, layerValues)
+		}
+	}
+
+	return result, nil
+}
+
+// findValueSource returns the source of the first layer that has `v`. Values in
+// lists are matched regardless of their index because lists are appended when
+// merged. If no layer has the same value, the first layer that has the path is
+// returned instead (e.g: `machineFiles` contents read from a file).
+func findValueSource(v Provenance, layers []config.NodeConfigsLayer, layerValues [][]Provenance) string {
+	matchers := []func(p Provenance) bool{
+		func(p Provenance) bool { return p.Path == v.Path && diffValue(p.Value) == diffValue(v.Value) },
+		func(p Provenance) bool {
+			return stripListIndex(p.Path) == stripListIndex(v.Path) && diffValue(p.Value) == diffValue(v.Value)
+		},
+		func(p Provenance) bool { return stripListIndex(p.Path) == stripListIndex(v.Path) },
+	}
+
+	for _, match := range matchers {
+		for i, values := range layerValues {
+			if slices.ContainsFunc(values, match) {
+				return layers[i].Source
+			}
+		}
+	}
+
+	return layers[0].Source
+}
+
+// explainNodeConfig generates the Talos `machineconfig` of `n` and returns the
+// provenance of every value. The config is generated in steps: the config
+// generated by talhelper, then every node patch, global patch and extra manifest
+// one by one, so every value is attributed to the last step that changed it.
+func explainNodeConfig(c *config.TalhelperConfig, n *config.Node, layers []config.NodeConfigsLayer, opts ConfigOptions) ([]Provenance, error) {
+	input, err := talos.NewClusterInput(c, opts.SecretFile, opts.Mode)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := generateBaseNodeConfig(c, n, input, opts.Mode, opts.OfflineMode)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []DiffChange
+	var sources []string
+	apply := func(source string, next []byte) error {
+		diff, err := semanticDiff(cfg, next)
+		if err != nil {
+			return fmt.Errorf("failed to apply %s: %w", source, err)
+		}
+		for _, change := range diff {
+			if change.Type != ChangeRemoved {
+				changes = append(changes, change)
+				sources = append(sources, source)
+			}
+		}
+		cfg = next
+		return nil
+	}
+
+	for _, patch := range n.Patches {
+		source := patchSource(patch, layers)
+		next, err := patcher.PatchesPatcher([]string{patch}, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to apply %s: %w", source, err)
+		}
+		if err := apply(source, next); err != nil {
+			return nil, err
+		}
+	}
+
+	for i, patch := range c.Patches {
+		source := "global patch " + patchLabel(patch, i)
+		next, err := patcher.PatchesPatcher([]string{patch}, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to apply %s: %w", source, err)
+		}
+		if err := apply(source, next); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, manifest := range n.ExtraManifests {
+		source := "extraManifests " + relativePath(strings.TrimPrefix(manifest, "@"))
+		content, err := combineExtraManifests([]string{manifest}, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to add %s: %w", source, err)
+		}
+		if err := apply(source, append(slices.Clone(cfg), content...)); err != nil {
+			return nil, err
+		}
+	}
+
+	if !opts.ShowSecrets {
+		if cfg, err = redactSecrets(cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	docs, err := parseDiffDocuments(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []Provenance
+	for _, doc := range docs {
+		for _, p := range flattenValue(nil, doc.id, "", doc.content) {
+			p.Source = "generated"
+			for i, change := range changes {
+				if change.Document == p.Document && isUnderPath(p.Path, change.Path) {
+					p.Source = sources[i]
+				}
+			}
+			result = append(result, p)
+		}
+	}
+
+	return result, nil
+}
+
+// patchSource returns the source of node `patch`, which is the first layer
+// that has it.
+func patchSource(patch string, layers []config.NodeConfigsLayer) string {
+	for _, layer := range layers {
+		if i := slices.Index(layer.NodeConfigs.Patches, patch); i >= 0 {
+			return layer.Source + " patch " + patchLabel(patch, i)
+		}
+	}
+	return "node patch " + patchLabel(patch, 0)
+}
+
+// patchLabel returns the file path of `patch` or `inline #i` if it is an inline patch.
+func patchLabel(patch string, i int) string {
+	if file, ok := strings.CutPrefix(patch, "@"); ok {
+		return relativePath(strings.TrimSpace(file))
+	}
+	return fmt.Sprintf("inline #%d", i)
+}
+
+// relativePath returns `path` relative to the current directory if it is inside it.
+func relativePath(path string) string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return path
+	}
+	rel, err := filepath.Rel(wd, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return path
+	}
+	return rel
+}
+
+// flattenValue appends every leaf value of `v` found in `path` of `doc` into
+// `result` and returns it. Empty values are skipped.
+func flattenValue(result []Provenance, doc, path string, v any) []Provenance {
+	switch v := v.(type) {
+	case map[string]any:
+		for _, k := range slices.Sorted(maps.Keys(v)) {
+			result = flattenValue(result, doc, joinMapPath(path, k), v[k])
+		}
+	case []any:
+		for i, item := range v {
+			result = flattenValue(result, doc, fmt.Sprintf("%s[%d]", path, i), item)
+		}
+	case nil:
+	case string:
+		if v != "" {
+			result = append(result, Provenance{Document: doc, Path: path, Value: v})
+		}
+	default:
+		result = append(result, Provenance{Document: doc, Path: path, Value: v})
+	}
+	return result
+}
+
+// fillDefaults sets every value of `defaults` that is not set in `dst`. The
+// path of every value set is added into `paths`.
+func fillDefaults(dst, defaults map[string]any, path string, paths map[string]bool) {
+	for k, v := range defaults {
+		p := joinMapPath(path, k)
+		existing, ok := dst[k]
+		if dstMap, isMap := existing.(map[string]any); isMap {
+			if defaultMap, isMap := v.(map[string]any); isMap {
+				fillDefaults(dstMap, defaultMap, p, paths)
+				continue
+			}
+		}
+		if ok && existing != nil && existing != "" {
+			continue
+		}
+		dst[k] = v
+		for _, leaf := range flattenValue(nil, "", p, v) {
+			paths[leaf.Path] = true
+		}
+	}
+}
+
+// toYamlValue returns `v` as decoded from its YAML form.
+func toYamlValue(v any) (any, error) {
+	data, err := yaml.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var result any
+	if err := yaml.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+var listIndex = regexp.MustCompile(`\[\d+\]`)
+
+func stripListIndex(path string) string {
+	return listIndex.ReplaceAllString(path, "[]")
+}
+
+// isUnderPath returns true if `path` is `parent` or one of its children.
+func isUnderPath(path, parent string) bool {
+	if parent == "" || path == parent {
+		return true
+	}
+	rest, ok := strings.CutPrefix(path, parent)
+	return ok && (strings.HasPrefix(rest, ".") || strings.HasPrefix(rest, "["))
+}
+
+func reversed[T any](s []T) []T {
+	result := slices.Clone(s)
+	slices.Reverse(result)
+	return result
+}
@@ -0,0 +1,103 @@
+package generate
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/budimanjojo/talhelper/v3/pkg/config"
+)
+
+func explainTestConfig() *config.TalhelperConfig {
+	return &config.TalhelperConfig{
+		ClusterName:       "test",
+		TalosVersion:      "v1.12.0",
+		KubernetesVersion: "v1.35.0",
+		Endpoint:          "https://10.0.0.1:6443",
+		Patches:           []string{"machine:\n  env:\n    GLOBAL: \"true\""},
+		Worker: config.NodeConfigs{
+			NodeLabels: map[string]string{"zone": "a"},
+			Patches:    []string{"machine:\n  env:\n    GROUP: \"true\""},
+		},
+		Nodes: []config.Node{
+			{
+				Hostname:    "worker1",
+				IPAddress:   "10.0.0.11",
+				InstallDisk: "/dev/sda",
+				NodeConfigs: config.NodeConfigs{
+					NodeLabels:    map[string]string{"disk": "ssd"},
+					TalosImageURL: "factory.talos.dev/installer/abc",
+					Patches:       []string{"machine:\n  env:\n    NODE: \"true\""},
+				},
+			},
+		},
+	}
+}
+
+func TestExplainNode(t *testing.T) {
+	raw := explainTestConfig()
+	c := explainTestConfig()
+	c.Nodes[0].OverrideGlobalCfg(c.GetNodeGroupsCfg(&c.Nodes[0]))
+
+	e, err := ExplainNode(raw, c, "10.0.0.11", ConfigOptions{Mode: "metal", OfflineMode: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sources := map[string]string{}
+	for _, p := range e.Node {
+		sources[p.Path] = p.Source
+	}
+	for _, p := range e.Config {
+		sources[p.Document+": "+p.Path] = p.Source
+	}
+
+	expected := map[string]string{
+		"hostname":                          "node",
+		"nodeLabels.disk":                   "node",
+		"nodeLabels.zone":                   "worker",
+		"machineSpec.arch":                  "default",
+		"patches[0]":                        "worker",
+		"patches[1]":                        "node",
+		"v1alpha1: machine.env.GROUP":       "worker patch inline #0",
+		"v1alpha1: machine.env.NODE":        "node patch inline #0",
+		"v1alpha1: machine.env.GLOBAL":      "global patch inline #0",
+		"v1alpha1: machine.install.disk":    "generated",
+		"v1alpha1: machine.nodeLabels.disk": "generated",
+	}
+	for path, source := range expected {
+		if sources[path] != source {
+			t.Errorf("%s: got source %q, want %q", path, sources[path], source)
+		}
+	}
+
+	for _, p := range e.Config {
+		if p.Path == "machine.token" && !strings.HasPrefix(p.Value.(string), "<redacted") {
+			t.Errorf("expected machine.token to be redacted, got %q", p.Value)
+		}
+	}
+
+	filtered, err := e.Filter("machine.env")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(filtered.Node) != 0 || len(filtered.Config) != 3 {
+		t.Errorf("expected 3 values in machine.env, got %v and %v", filtered.Node, filtered.Config)
+	}
+
+	if _, err := e.Filter("machine.foo"); err == nil {
+		t.Error("expected error for path without value, got nil")
+	}
+
+	var buf bytes.Buffer
+	if err := writeExplanation(&buf, filtered, "text"); err != nil {
+		t.Fatal(err)
+	}
+	want := "# machineconfig of worker1\n" +
+		"v1alpha1: machine.env.GLOBAL: \"true\"  # global patch inline #0\n" +
+		"v1alpha1: machine.env.GROUP: \"true\"   # worker patch inline #0\n" +
+		"v1alpha1: machine.env.NODE: \"true\"    # node patch inline #0\n"
+	if buf.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
@@ -0,0 +1,772 @@
+package generate
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/siderolabs/image-factory/pkg/schematic"
+	clientconfig "github.com/siderolabs/talos/pkg/machinery/client/config"
+	taloscfg "github.com/siderolabs/talos/pkg/machinery/config"
+	"github.com/siderolabs/talos/pkg/machinery/config/generate/secrets"
+	"gopkg.in/yaml.v3"
+
+	"github.com/budimanjojo/talhelper/v3/pkg/config"
+	"github.com/budimanjojo/talhelper/v3/pkg/talos"
+	"github.com/budimanjojo/talhelper/v3/pkg/yamledit"
+)
+
+// ImportOptions holds the options for `ImportConfig`.
+type ImportOptions struct {
+	// OutDir is the directory where `talconfig.yaml`, `talsecret.yaml` and
+	// the residual patches are written.
+	OutDir string
+	// Mode is the Talos runtime mode used to validate the generated configs.
+	Mode string
+	// Force overwrites existing files in `OutDir`.
+	Force bool
+	// Talosconfig is the talosconfig of the cluster, used to find the IP
+	// address of nodes without static IP address. Defaults to `talosconfig`
+	// next to the first machine config if it exists.
+	Talosconfig string
+}
+
+type importedNode struct {
+	file     string
+	original []byte
+	cfg      taloscfg.Provider
+	node     config.Node
+	residual importResidual
+}
+
+// importResidual is a pair of strategic merge patches that turns the config
+// generated by talhelper into the original machine config. `remove` has to be
+// applied before `add`, because strategic merge patches can't replace lists.
+type importResidual struct {
+	remove []byte
+	add    []byte
+}
+
+const (
+	importConfigFile = "talconfig.yaml"
+	importSecretFile = "talsecret.yaml"
+	importPatchesDir = "patches"
+)
+
+// ImportConfig reads existing Talos machine config `files` and writes
+// `talconfig.yaml` and `talsecret.yaml` that generate the same machine configs
+// into `opts.OutDir`. Values that can't be mapped into talhelper config are
+// written as residual patches into `patches` directory. Nothing is written
+// if the imported config is not valid. It returns an error, if any.
+func ImportConfig(files []string, opts ImportOptions) error {
+	nodes, err := loadImportedNodes(files)
+	if err != nil {
+		return err
+	}
+
+	var cp *importedNode
+	for i := range nodes {
+		if talos.IsControlPlane(nodes[i].cfg) {
+			cp = &nodes[i]
+			break
+		}
+	}
+	if cp == nil {
+		return errors.New("at least one controlplane machine config is required to import the cluster secrets")
+	}
+
+	for _, n := range nodes {
+		if n.cfg.Cluster().Name() != cp.cfg.Cluster().Name() {
+			return fmt.Errorf("%s belongs to cluster %q, but %s belongs to cluster %q", n.file, n.cfg.Cluster().Name(), cp.file, cp.cfg.Cluster().Name())
+		}
+	}
+
+	sb, err := talos.NewSecretBundleFromCfg(secrets.NewClock(), cp.cfg)
+	if err != nil {
+		return fmt.Errorf("failed to get secrets from %s: %s", cp.file, err)
+	}
+
+	cfg := importClusterConfig(cp.cfg)
+	vc, err := taloscfg.ParseContractFromVersion(cfg.GetTalosVersion())
+	if err != nil {
+		return err
+	}
+	for i := range nodes {
+		nodes[i].node = importNode(cfg, nodes[i], vc)
+	}
+	if err := importTalosconfigIPAddresses(nodes, opts.Talosconfig); err != nil {
+		return err
+	}
+	for i := range nodes {
+		if nodes[i].node.IPAddress == "" {
+			fmt.Fprintf(os.Stderr, "%s: can't find IP address of %s in %s, pass the talosconfig of the cluster with --talosconfig\n", color.YellowString("WARNING"), nodes[i].node.Hostname, nodes[i].file)
+		}
+		cfg.Nodes = append(cfg.Nodes, nodes[i].node)
+	}
+
+	if err := checkImportOutput(opts, nodes); err != nil {
+		return err
+	}
+
+	// the getters of `TalhelperConfig` fill the defaults, so a copy is used for
+	// generating to keep them out of the written config file
+	genCfg := *cfg
+	input, err := talos.NewClusterInputFromBundle(&genCfg, sb, opts.Mode)
+	if err != nil {
+		return err
+	}
+
+	for i := range nodes {
+		generated, err := generateNodeConfig(&genCfg, &nodes[i].node, input, opts.Mode, true)
+		if err != nil {
+			return fmt.Errorf("failed to generate config for %s: %s", nodes[i].file, err)
+		}
+		nodes[i].residual, err = residualPatches(generated, nodes[i].original)
+		if err != nil {
+			return fmt.Errorf("failed to find residual of %s: %s", nodes[i].file, err)
+		}
+	}
+
+	patches := residualPatchFiles(cfg, nodes)
+
+	cfgPath := filepath.Join(opts.OutDir, importConfigFile)
+	content, err := encodeTalhelperConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	// nothing is written, especially the plain secrets, until the imported
+	// config is known to be valid
+	errs, warns, err := config.ValidateFromSource(cfgPath, content, "", false, nil)
+	if err != nil {
+		return err
+	}
+	if err := (&config.Reporter{Output: os.Stderr, ShowWarns: true}).Report(errs, warns); err != nil {
+		return fmt.Errorf("the imported config is not valid, nothing is written: %s", err)
+	}
+
+	if err := os.MkdirAll(filepath.Join(opts.OutDir, importPatchesDir), 0o700); err != nil {
+		return err
+	}
+	for _, file := range slices.Sorted(maps.Keys(patches)) {
+		if err := dumpFile(filepath.Join(opts.OutDir, file), patches[file]); err != nil {
+			return err
+		}
+	}
+	if err := dumpFile(cfgPath, content); err != nil {
+		return err
+	}
+	secretPath := filepath.Join(opts.OutDir, importSecretFile)
+	if err := dumpYaml(secretPath, sb); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "imported %d nodes into %s\n", len(nodes), cfgPath)
+
+	diffs, err := verifyImport(cfgPath, sb, opts.Mode, nodes)
+	if err != nil {
+		return fmt.Errorf("failed to verify imported config: %s", err)
+	}
+	for _, d := range diffs {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", color.YellowString("WARNING"), d)
+	}
+
+	fmt.Fprintf(os.Stderr, "%s is not encrypted, encrypt it with `sops -e -i %s` before committing it\n", secretPath, secretPath)
+
+	return nil
+}
+
+// loadImportedNodes reads and parses every machine config in `files`.
+// It returns an error, if any.
+func loadImportedNodes(files []string) ([]importedNode, error) {
+	var result []importedNode
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		cfg, err := talos.LoadTalosConfig(content)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %s", file, err)
+		}
+		if cfg.RawV1Alpha1() == nil {
+			return nil, fmt.Errorf("%s doesn't have v1alpha1 machine config", file)
+		}
+
+		result = append(result, importedNode{file: file, original: content, cfg: cfg})
+	}
+
+	return result, nil
+}
+
+// importClusterConfig returns `TalhelperConfig` with the cluster wide values
+// of machine config `cfg`.
+func importClusterConfig(cfg taloscfg.Provider) *config.TalhelperConfig {
+	result := &config.TalhelperConfig{
+		ClusterName:                    cfg.Cluster().Name(),
+		Endpoint:                       cfg.Cluster().Endpoint().String(),
+		TalosVersion:                   imageTag(cfg.Machine().Install().Image()),
+		KubernetesVersion:              imageTag(cfg.Machine().Kubelet().Image()),
+		AllowSchedulingOnControlPlanes: cfg.Cluster().ScheduleOnControlPlanes(),
+	}
+
+	if !strings.HasPrefix(result.TalosVersion, "v") {
+		slog.Debug(fmt.Sprintf("can't find Talos version from %s", cfg.Machine().Install().Image()))
+		result.TalosVersion = ""
+	}
+
+	if network := cfg.RawV1Alpha1().ClusterConfig.ClusterNetwork; network != nil {
+		if network.DNSDomain != "" && network.DNSDomain != "cluster.local" {
+			result.Domain = network.DNSDomain
+		}
+
+		defaults := &config.TalhelperConfig{Endpoint: result.Endpoint}
+		if len(network.PodSubnet) > 0 && !slices.Equal(network.PodSubnet, defaults.GetClusterPodNets()) {
+			result.ClusterPodNets = network.PodSubnet
+		}
+		if len(network.ServiceSubnet) > 0 && !slices.Equal(network.ServiceSubnet, defaults.GetClusterSvcNets()) {
+			result.ClusterSvcNets = network.ServiceSubnet
+		}
+
+		if network.CNI != nil && network.CNI.CNIName != "flannel" {
+			result.CNIConfig = network.CNI
+		}
+	}
+
+	return result
+}
+
+// importNode returns `Node` with the node specific values of `n`.
+func importNode(c *config.TalhelperConfig, n importedNode, vc *taloscfg.VersionContract) config.Node {
+	raw := n.cfg.RawV1Alpha1().MachineConfig
+	result := config.Node{
+		ControlPlane:        talos.IsControlPlane(n.cfg),
+		InstallDisk:         raw.MachineInstall.InstallDisk,
+		InstallDiskSelector: raw.MachineInstall.InstallDiskSelector,
+		NodeConfigs: config.NodeConfigs{
+			NodeLabels:      raw.MachineNodeLabels,
+			NodeAnnotations: raw.MachineNodeAnnotations,
+			NodeTaints:      raw.MachineNodeTaints,
+		},
+	}
+
+	if h := n.cfg.NetworkHostnameConfig(); h != nil && h.Hostname() != "" {
+		result.Hostname = h.Hostname()
+	} else {
+		result.Hostname = strings.TrimSuffix(filepath.Base(n.file), filepath.Ext(n.file))
+		result.IgnoreHostname = true
+	}
+
+	result.IPAddress = importIPAddress(n.cfg)
+
+	if r := n.cfg.NetworkResolverConfig(); r != nil {
+		for _, resolver := range r.Resolvers() {
+			result.Nameservers = append(result.Nameservers, resolver.Addr.String())
+		}
+		result.DisableSearchDomain = r.DisableSearchDomain()
+	}
+
+	if raw.MachineKernel != nil {
+		result.KernelModules = raw.MachineKernel.KernelModules
+	}
+
+	//nolint:staticcheck
+	if !vc.MultidocNetworkConfigSupported() && raw.MachineNetwork != nil {
+		result.NetworkInterfaces = raw.MachineNetwork.NetworkInterfaces
+	}
+
+	if image := n.cfg.Machine().Install().Image(); image != "" {
+		version := imageTag(image)
+		// the default installer image doesn't need to be specified
+		defaultImage, err := talos.GetInstallerURL(&schematic.Schematic{}, c.GetImageFactory(), result.GetMachineSpec(), version, true)
+		if err != nil || image != defaultImage {
+			result.TalosImageURL = strings.TrimSuffix(image, ":"+version)
+		}
+	}
+
+	return result
+}
+
+// importIPAddress returns the first static IP address found in `cfg` or the
+// first IP address in `machine.certSANs` that is not the cluster endpoint.
+func importIPAddress(cfg taloscfg.Provider) string {
+	//nolint:staticcheck
+	if network := cfg.RawV1Alpha1().MachineConfig.MachineNetwork; network != nil {
+		//nolint:staticcheck
+		for _, device := range network.NetworkInterfaces {
+			for _, addr := range device.Addresses() {
+				if prefix, err := netip.ParsePrefix(addr); err == nil {
+					return prefix.Addr().String()
+				}
+				if ip, err := netip.ParseAddr(addr); err == nil {
+					return ip.String()
+				}
+			}
+		}
+	}
+
+	for _, link := range cfg.NetworkCommonLinkConfigs() {
+		for _, addr := range link.Addresses() {
+			return addr.Address().Addr().String()
+		}
+	}
+
+	endpoint := cfg.Cluster().Endpoint().Hostname()
+	for _, san := range cfg.Machine().Security().CertSANs() {
+		if ip, err := netip.ParseAddr(san); err == nil && san != endpoint {
+			return ip.String()
+		}
+	}
+
+	return ""
+}
+
+// importTalosconfigIPAddresses sets the IP address of `nodes` without one from
+// talosconfig in `path`, or `talosconfig` next to the first machine config if
+// `path` is empty and it exists. Controlplane nodes take the endpoints and
+// worker nodes take the other nodes of the context, in the order they're
+// passed. Nothing is set for a role if the number of nodes without IP address
+// doesn't match the number of IP addresses left in the talosconfig.
+// It returns an error, if any.
+func importTalosconfigIPAddresses(nodes []importedNode, path string) error {
+	if !slices.ContainsFunc(nodes, func(n importedNode) bool { return n.node.IPAddress == "" }) {
+		return nil
+	}
+
+	if path == "" {
+		path = filepath.Join(filepath.Dir(nodes[0].file), "talosconfig")
+		if _, err := os.Stat(path); err != nil {
+			return nil
+		}
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	tc, err := clientconfig.FromBytes(content)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %s", path, err)
+	}
+	ctx, ok := tc.Contexts[nodes[0].cfg.Cluster().Name()]
+	if !ok {
+		ctx, ok = tc.Contexts[tc.Context]
+	}
+	if !ok {
+		return fmt.Errorf("%s doesn't have context of cluster %q", path, nodes[0].cfg.Cluster().Name())
+	}
+
+	var used []string
+	for _, n := range nodes {
+		used = append(used, n.node.GetIPAddresses()...)
+	}
+	unused := func(ips []string, exclude []string) []string {
+		var result []string
+		for _, ip := range ips {
+			if !slices.Contains(used, ip) && !slices.Contains(exclude, ip) && !slices.Contains(result, ip) {
+				result = append(result, ip)
+			}
+		}
+		return result
+	}
+
+	for _, controlPlane := range []bool{true, false} {
+		ips := unused(ctx.Endpoints, nil)
+		if !controlPlane {
+			ips = unused(ctx.Nodes, ctx.Endpoints)
+		}
+
+		var missing []int
+		for i := range nodes {
+			if nodes[i].node.IPAddress == "" && nodes[i].node.ControlPlane == controlPlane {
+				missing = append(missing, i)
+			}
+		}
+		if len(missing) == 0 || len(missing) != len(ips) {
+			continue
+		}
+
+		for k, i := range missing {
+			nodes[i].node.IPAddress = ips[k]
+			slog.Debug(fmt.Sprintf("ipAddress of %s is set to %s from %s", nodes[i].node.Hostname, ips[k], path))
+		}
+		if len(missing) > 1 {
+			fmt.Fprintf(os.Stderr, "%s: ipAddress of %s nodes are taken from %s in the order of the machine configs, please check them\n", color.YellowString("WARNING"), nodes[missing[0]].node.GetRole(), path)
+		}
+	}
+
+	return nil
+}
+
+// imageTag returns the tag of container `image`.
+func imageTag(image string) string {
+	idx := strings.LastIndex(image, ":")
+	if idx < 0 || strings.Contains(image[idx:], "/") {
+		return ""
+	}
+	return image[idx+1:]
+}
+
+// checkImportOutput returns an error if any file `ImportConfig` writes already
+// exists, unless `opts.Force` is set.
+func checkImportOutput(opts ImportOptions, nodes []importedNode) error {
+	if opts.Force {
+		return nil
+	}
+
+	for _, file := range []string{importConfigFile, importSecretFile, importPatchesDir} {
+		path := filepath.Join(opts.OutDir, file)
+		if _, err := os.Stat(path); err == nil {
+			return fmt.Errorf("%s already exists, use --force to overwrite it", path)
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	hostnames := map[string]string{}
+	for _, n := range nodes {
+		if file, ok := hostnames[n.node.Hostname]; ok {
+			return fmt.Errorf("%s and %s have the same hostname %q", file, n.file, n.node.Hostname)
+		}
+		hostnames[n.node.Hostname] = n.file
+	}
+
+	return nil
+}
+
+// residualPatches returns the patches that turn `generated` machine config
+// into `original`. It returns an error, if any.
+func residualPatches(generated, original []byte) (importResidual, error) {
+	var result importResidual
+
+	genDocs, err := parseDiffDocuments(generated)
+	if err != nil {
+		return result, err
+	}
+	origDocs, err := parseDiffDocuments(original)
+	if err != nil {
+		return result, err
+	}
+
+	genByID := map[string]any{}
+	for _, doc := range genDocs {
+		genByID[doc.id] = doc.content
+	}
+	origByID := map[string]any{}
+	for _, doc := range origDocs {
+		origByID[doc.id] = doc.content
+	}
+
+	var remove, add []any
+	for _, doc := range genDocs {
+		orig, ok := origByID[doc.id]
+		switch {
+		case ok && reflect.DeepEqual(orig, doc.content):
+		case ok && doc.id == "v1alpha1":
+			r, a := residualValues(doc.content.(map[string]any), orig.(map[string]any))
+			if len(r) > 0 {
+				r["version"] = "v1alpha1"
+				remove = append(remove, r)
+			}
+			if len(a) > 0 {
+				a["version"] = "v1alpha1"
+				add = append(add, a)
+			}
+		default:
+			// other documents can only be replaced as a whole
+			remove = append(remove, deleteDocument(doc.content))
+			if ok {
+				add = append(add, orig)
+			}
+		}
+	}
+	for _, doc := range origDocs {
+		if _, ok := genByID[doc.id]; !ok {
+			add = append(add, doc.content)
+		}
+	}
+
+	if result.remove, err = encodeDocuments(remove); err != nil {
+		return result, err
+	}
+	if result.add, err = encodeDocuments(add); err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+// residualValues returns the values of `generated` that have to be removed
+// and the values of `original` that have to be added to turn `generated`
+// into `original`.
+func residualValues(generated, original map[string]any) (remove, add map[string]any) {
+	remove = map[string]any{}
+	add = map[string]any{}
+
+	for k := range generated {
+		if _, ok := original[k]; !ok {
+			remove[k] = map[string]any{"$patch": "delete"}
+		}
+	}
+
+	for k, orig := range original {
+		gen, ok := generated[k]
+		if !ok {
+			add[k] = orig
+			continue
+		}
+		if reflect.DeepEqual(gen, orig) {
+			continue
+		}
+
+		genMap, genIsMap := gen.(map[string]any)
+		origMap, origIsMap := orig.(map[string]any)
+		if genIsMap && origIsMap {
+			r, a := residualValues(genMap, origMap)
+			if len(r) > 0 {
+				remove[k] = r
+			}
+			if len(a) > 0 {
+				add[k] = a
+			}
+			continue
+		}
+
+		// lists are merged instead of replaced and zero values are ignored by
+		// strategic merge patches, so they're removed first
+		if _, isList := gen.([]any); isList || isZeroValue(orig) {
+			remove[k] = map[string]any{"$patch": "delete"}
+		}
+		add[k] = orig
+	}
+
+	return remove, add
+}
+
+func isZeroValue(v any) bool {
+	return v == nil || reflect.ValueOf(v).IsZero()
+}
+
+// deleteDocument returns a strategic merge patch that deletes `doc`.
+func deleteDocument(doc any) map[string]any {
+	result := map[string]any{"$patch": "delete"}
+	if m, ok := doc.(map[string]any); ok {
+		for _, k := range []string{"apiVersion", "kind", "name"} {
+			if v, ok := m[k]; ok {
+				result[k] = v
+			}
+		}
+	}
+	return result
+}
+
+// encodeDocuments encodes `docs` into multi document YAML. It returns nil if
+// `docs` is empty and an error, if any.
+func encodeDocuments(docs []any) ([]byte, error) {
+	if len(docs) == 0 {
+		return nil, nil
+	}
+
+	buf := new(bytes.Buffer)
+	enc := yaml.NewEncoder(buf)
+	enc.SetIndent(2)
+	for _, doc := range docs {
+		if err := enc.Encode(doc); err != nil {
+			return nil, err
+		}
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// residualPatchFiles adds the residual patches of `nodes` to `c` and returns
+// the content of every patch file by its path relative to the config file.
+// Residuals shared by every node are added to the global `patches` and
+// residuals shared by every node with the same role are added to
+// `controlPlane` or `worker`.
+func residualPatchFiles(c *config.TalhelperConfig, nodes []importedNode) map[string][]byte {
+	result := map[string][]byte{}
+
+	if sameResidual(nodes, func(*importedNode) bool { return true }) {
+		c.Patches = addResidual(result, "all", nodes[0].residual)
+		return result
+	}
+
+	handled := map[int]bool{}
+	for _, role := range []string{"controlplane", "worker"} {
+		inRole := func(n *importedNode) bool { return n.node.GetRole() == role }
+		if !sameResidual(nodes, inRole) {
+			continue
+		}
+
+		var residual importResidual
+		for i := range nodes {
+			if inRole(&nodes[i]) {
+				handled[i] = true
+				residual = nodes[i].residual
+			}
+		}
+
+		if role == "controlplane" {
+			c.ControlPlane.Patches = addResidual(result, role, residual)
+		} else {
+			c.Worker.Patches = addResidual(result, role, residual)
+		}
+	}
+
+	for i := range nodes {
+		if !handled[i] {
+			c.Nodes[i].Patches = addResidual(result, c.Nodes[i].Hostname, nodes[i].residual)
+		}
+	}
+
+	return result
+}
+
+// sameResidual returns true if every node in `nodes` matching `filter` has
+// the same residual patches and there's more than one of them.
+func sameResidual(nodes []importedNode, filter func(*importedNode) bool) bool {
+	var (
+		first *importResidual
+		count int
+	)
+	for i := range nodes {
+		if !filter(&nodes[i]) {
+			continue
+		}
+		count++
+		if first == nil {
+			first = &nodes[i].residual
+			continue
+		}
+		if !bytes.Equal(first.remove, nodes[i].residual.remove) || !bytes.Equal(first.add, nodes[i].residual.add) {
+			return false
+		}
+	}
+	return count > 1
+}
+
+// addResidual adds the files of `residual` named after `name` into `files`
+// and returns the list of patches to apply them.
+func addResidual(files map[string][]byte, name string, residual importResidual) []string {
+	var result []string
+	for _, p := range []struct {
+		suffix  string
+		content []byte
+	}{
+		{"-remove.yaml", residual.remove},
+		{".yaml", residual.add},
+	} {
+		if len(p.content) == 0 {
+			continue
+		}
+		file := filepath.Join(importPatchesDir, name+p.suffix)
+		files[file] = escapePatch(p.content)
+		result = append(result, "@./"+filepath.ToSlash(file))
+	}
+
+	return result
+}
+
+// escapePatch escapes `patch` so it's not changed when talhelper renders it
+// as Go template and substitutes the env variables in it.
+func escapePatch(patch []byte) []byte {
+	patch = bytes.ReplaceAll(patch, []byte("{{"), []byte(`{{ "{{" }}`))
+	return bytes.ReplaceAll(patch, []byte("$"), []byte("$$"))
+}
+
+// encodeTalhelperConfig encodes `c` into YAML without the fields that are not
+// set. It returns an error, if any.
+func encodeTalhelperConfig(c *config.TalhelperConfig) ([]byte, error) {
+	var node yaml.Node
+	if err := node.Encode(c); err != nil {
+		return nil, err
+	}
+	yamledit.PruneEmpty(&node)
+
+	doc := &yamledit.Document{
+		Nodes:         []*yaml.Node{{Kind: yaml.DocumentNode, Content: []*yaml.Node{&node}}},
+		ExplicitStart: true,
+	}
+
+	return doc.Encode()
+}
+
+// dumpYaml encodes `v` into YAML file in `path`. It returns an error, if any.
+func dumpYaml(path string, v any) error {
+	content, err := encodeYaml(v)
+	if err != nil {
+		return err
+	}
+
+	return dumpFile(path, content)
+}
+
+// encodeYaml encodes `v` into YAML with 2 spaces indentation.
+// It returns an error, if any.
+func encodeYaml(v any) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	enc := yaml.NewEncoder(buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// verifyImport generates the machine configs from the imported config in
+// `cfgPath` with secrets `sb` and returns the differences from the original
+// machine configs. It returns an error, if any.
+func verifyImport(cfgPath string, sb *secrets.Bundle, mode string, nodes []importedNode) ([]string, error) {
+	c, err := config.LoadClusterFromFile(cfgPath, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	for i := range c.Nodes {
+		c.Nodes[i].OverrideGlobalCfg(c.GetNodeGroupsCfg(&c.Nodes[i]))
+	}
+
+	input, err := talos.NewClusterInputFromBundle(c, sb, mode)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []string
+	for i := range c.Nodes {
+		generated, err := generateNodeConfig(c, &c.Nodes[i], input, mode, true)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate config for %s: %s", c.Nodes[i].Hostname, err)
+		}
+
+		changes, err := semanticDiff(nodes[i].original, generated)
+		if err != nil {
+			return nil, err
+		}
+		for _, change := range changes {
+			path := change.Document
+			if change.Path != "" {
+				path += ": " + change.Path
+			}
+			result = append(result, fmt.Sprintf("%s: %s is %s in the config generated by the imported config", nodes[i].file, path, change.Type))
+		}
+	}
+
+	slices.Sort(result)
+	return slices.Compact(result), nil
+}
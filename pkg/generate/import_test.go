@@ -0,0 +1,169 @@
+package generate
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/budimanjojo/talhelper/v3/pkg/config"
+	"github.com/budimanjojo/talhelper/v3/pkg/talos"
+)
+
+func TestImportConfig(t *testing.T) {
+	dir := t.TempDir()
+
+	src := &config.TalhelperConfig{
+		ClusterName:       "test",
+		TalosVersion:      "v1.12.0",
+		KubernetesVersion: "v1.35.0",
+		Endpoint:          "https://10.0.0.1:6443",
+		ClusterPodNets:    []string{"10.200.0.0/16"},
+		Patches:           []string{"machine:\n  env:\n    FOO: $bar\n  sysctls:\n    vm.nr_hugepages: \"128\""},
+		Nodes: []config.Node{
+			{
+				Hostname:     "cp1",
+				IPAddress:    "10.0.0.11",
+				ControlPlane: true,
+				InstallDisk:  "/dev/sda",
+			},
+			{
+				Hostname:    "worker1",
+				IPAddress:   "10.0.0.21",
+				InstallDisk: "/dev/sdb",
+				NodeConfigs: config.NodeConfigs{
+					NodeLabels: map[string]string{"zone": "a"},
+				},
+			},
+		},
+	}
+
+	input, err := talos.NewClusterInput(src, "", "metal")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var files []string
+	for i := range src.Nodes {
+		content, err := generateNodeConfig(src, &src.Nodes[i], input, "metal", true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file := filepath.Join(dir, src.Nodes[i].Hostname+".yaml")
+		if err := os.WriteFile(file, content, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, file)
+	}
+
+	// nodes don't have static IP address, so they can't be imported without talosconfig
+	outDir := filepath.Join(dir, "out")
+	if err := ImportConfig(files, ImportOptions{OutDir: outDir, Mode: "metal"}); err == nil {
+		t.Fatal("expected error for nodes without IP address, got nil")
+	}
+	if _, err := os.Stat(outDir); !os.IsNotExist(err) {
+		t.Fatalf("expected nothing to be written for invalid config, got %v", err)
+	}
+
+	talosconfig, err := talos.GenerateClientConfigBytes(src, input, false, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "talosconfig"), talosconfig, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ImportConfig(files, ImportOptions{OutDir: outDir, Mode: "metal"}); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := config.LoadClusterFromFile(filepath.Join(outDir, "talconfig.yaml"), "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.ClusterName != "test" || c.Endpoint != "https://10.0.0.1:6443" || c.TalosVersion != "v1.12.0" || c.KubernetesVersion != "v1.35.0" {
+		t.Errorf("got cluster %q, endpoint %q, talosVersion %q and kubernetesVersion %q", c.ClusterName, c.Endpoint, c.TalosVersion, c.KubernetesVersion)
+	}
+	if !reflect.DeepEqual(c.ClusterPodNets, []string{"10.200.0.0/16"}) {
+		t.Errorf("got clusterPodNets %v, want [10.200.0.0/16]", c.ClusterPodNets)
+	}
+
+	if len(c.Nodes) != 2 {
+		t.Fatalf("got %d nodes, want 2", len(c.Nodes))
+	}
+	cp, worker := c.Nodes[0], c.Nodes[1]
+	if cp.Hostname != "cp1" || cp.IPAddress != "10.0.0.11" || !cp.ControlPlane || cp.InstallDisk != "/dev/sda" {
+		t.Errorf("unexpected controlplane node %+v", cp)
+	}
+	if worker.Hostname != "worker1" || worker.IPAddress != "10.0.0.21" || worker.ControlPlane || worker.InstallDisk != "/dev/sdb" || worker.NodeLabels["zone"] != "a" {
+		t.Errorf("unexpected worker node %+v", worker)
+	}
+
+	if len(c.Patches) == 0 {
+		t.Fatal("expected patches shared by every node to be global patches")
+	}
+	shared, err := os.ReadFile(filepath.Join(outDir, "patches", "all.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(shared), "vm.nr_hugepages") || !strings.Contains(string(shared), "FOO: $$bar") {
+		t.Errorf("expected shared patch to contain escaped env and sysctls, got:\n%s", shared)
+	}
+
+	nodes, err := loadImportedNodes(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	diffs, err := verifyImport(filepath.Join(outDir, "talconfig.yaml"), input.Options.SecretsBundle, "metal", nodes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 0 {
+		t.Errorf("expected imported config to generate the same machine configs, got:\n%s", strings.Join(diffs, "\n"))
+	}
+
+	if err := ImportConfig(files, ImportOptions{OutDir: outDir, Mode: "metal"}); err == nil {
+		t.Error("expected error when output files exist, got nil")
+	}
+	if err := ImportConfig(files[1:], ImportOptions{OutDir: t.TempDir(), Mode: "metal"}); err == nil {
+		t.Error("expected error without controlplane machine config, got nil")
+	}
+}
+
+func TestResidualValues(t *testing.T) {
+	generated := map[string]any{
+		"a": "same",
+		"b": []any{"x"},
+		"c": map[string]any{"d": true, "e": "gen"},
+		"f": "removed",
+	}
+	original := map[string]any{
+		"a": "same",
+		"b": []any{"y"},
+		"c": map[string]any{"d": false, "e": "orig"},
+		"g": "added",
+	}
+
+	remove, add := residualValues(generated, original)
+
+	deleted := map[string]any{"$patch": "delete"}
+	expectedRemove := map[string]any{
+		"b": deleted,
+		"c": map[string]any{"d": deleted},
+		"f": deleted,
+	}
+	expectedAdd := map[string]any{
+		"b": []any{"y"},
+		"c": map[string]any{"d": false, "e": "orig"},
+		"g": "added",
+	}
+	if !reflect.DeepEqual(remove, expectedRemove) {
+		t.Errorf("got remove %v, want %v", remove, expectedRemove)
+	}
+	if !reflect.DeepEqual(add, expectedAdd) {
+		t.Errorf("got add %v, want %v", add, expectedAdd)
+	}
+}
@@ -0,0 +1,497 @@
+package generate
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/budimanjojo/talhelper/v3/pkg/config"
+	"github.com/budimanjojo/talhelper/v3/pkg/encrypt"
+	"github.com/budimanjojo/talhelper/v3/pkg/talos"
+	"github.com/fatih/color"
+	sopsconfig "github.com/getsops/sops/v3/config"
+	"github.com/siderolabs/image-factory/pkg/schematic"
+	"github.com/siderolabs/talos/pkg/machinery/api/machine"
+	"github.com/siderolabs/talos/pkg/machinery/compatibility"
+	taloscfg "github.com/siderolabs/talos/pkg/machinery/config"
+	"github.com/siderolabs/talos/pkg/machinery/config/generate/secrets"
+	"github.com/siderolabs/talos/pkg/machinery/config/types/v1alpha1"
+	"github.com/siderolabs/talos/pkg/machinery/constants"
+	"golang.org/x/mod/semver"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	initConfigFile     = "talconfig.yaml"
+	initSecretFile     = "talsecret.sops.yaml"
+	initPlainSecret    = "talsecret.yaml"
+	initSopsConfigFile = ".sops.yaml"
+)
+
+// InitCNIs are the CNI choices of `talhelper init`.
+var InitCNIs = []string{"flannel", "none", "custom"}
+
+// InitAnswers are the answers to the questions of `talhelper init`.
+type InitAnswers struct {
+	ClusterName       string     `yaml:"clusterName"`
+	Endpoint          string     `yaml:"endpoint"`
+	TalosVersion      string     `yaml:"talosVersion"`
+	KubernetesVersion string     `yaml:"kubernetesVersion"`
+	CNI               string     `yaml:"cni"`
+	CNIUrls           []string   `yaml:"cniUrls"`
+	Extensions        []string   `yaml:"extensions"`
+	Nodes             []InitNode `yaml:"nodes"`
+	// AgeRecipient is the age public key written into `.sops.yaml`, the file
+	// is not written if it's empty.
+	AgeRecipient string `yaml:"ageRecipient"`
+}
+
+// InitNode is a node in `InitAnswers`.
+type InitNode struct {
+	Hostname     string `yaml:"hostname"`
+	IPAddress    string `yaml:"ipAddress"`
+	ControlPlane bool   `yaml:"controlPlane"`
+	InstallDisk  string `yaml:"installDisk"`
+}
+
+// InitOptions are the options of `InitConfig`.
+type InitOptions struct {
+	// OutDir is the directory to write the files into.
+	OutDir string
+	// Force overwrites the files that already exist.
+	Force bool
+}
+
+// LoadInitAnswers reads `InitAnswers` from YAML file in `path`.
+// It returns an error, if any.
+func LoadInitAnswers(path string) (*InitAnswers, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var answers InitAnswers
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&answers); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %s", path, err)
+	}
+
+	return &answers, nil
+}
+
+// InitConfig creates `talconfig.yaml`, the secret file and optionally
+// `.sops.yaml` in `opts.OutDir` from `answers`. The secret file is
+// `talsecret.sops.yaml` encrypted with `sops` if there's a `.sops.yaml` for
+// it, otherwise it's `talsecret.yaml` added into `.gitignore`.
+// It returns an error, if any.
+func InitConfig(answers *InitAnswers, opts InitOptions) error {
+	cfg, err := initClusterConfig(answers)
+	if err != nil {
+		return err
+	}
+
+	if errs, _ := cfg.Validate(); len(errs) > 0 {
+		var messages []string
+		for _, e := range errs {
+			messages = append(messages, fmt.Sprintf("%s: %s", e.Field, e.Message))
+		}
+		return fmt.Errorf("the answers don't make a valid talhelper config:\n%s", strings.Join(messages, "\n"))
+	}
+
+	encrypted, err := initSecretEncrypted(answers, opts.OutDir)
+	if err != nil {
+		return err
+	}
+	secretFile := initPlainSecret
+	if encrypted {
+		secretFile = initSecretFile
+	}
+
+	files := []string{initConfigFile, secretFile}
+	if answers.AgeRecipient != "" {
+		files = append(files, initSopsConfigFile)
+	}
+	if !opts.Force {
+		for _, file := range files {
+			path := filepath.Join(opts.OutDir, file)
+			if _, err := os.Stat(path); err == nil {
+				return fmt.Errorf("%s already exists, use --force to overwrite it", path)
+			} else if !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+	}
+
+	content, err := encodeTalhelperConfig(cfg)
+	if err != nil {
+		return err
+	}
+	configPath := filepath.Join(opts.OutDir, initConfigFile)
+	if err := dumpFile(configPath, content); err != nil {
+		return err
+	}
+	fmt.Printf("created %s\n", configPath)
+
+	if answers.AgeRecipient != "" {
+		sopsPath := filepath.Join(opts.OutDir, initSopsConfigFile)
+		sopsConfig := fmt.Sprintf("---\ncreation_rules:\n  - age: >-\n      %s\n", answers.AgeRecipient)
+		if err := dumpFile(sopsPath, []byte(sopsConfig)); err != nil {
+			return err
+		}
+		fmt.Printf("created %s\n", sopsPath)
+	}
+
+	return writeInitSecret(cfg, filepath.Join(opts.OutDir, secretFile), encrypted)
+}
+
+// initSecretEncrypted returns true if the secret file in `outDir` will be
+// encrypted, which is when `answers` has an age recipient or there's already
+// a `.sops.yaml` for it. It returns an error, if any.
+func initSecretEncrypted(answers *InitAnswers, outDir string) (bool, error) {
+	if answers.AgeRecipient != "" {
+		return true, nil
+	}
+	absPath, err := filepath.Abs(filepath.Join(outDir, initSecretFile))
+	if err != nil {
+		return false, err
+	}
+	_, err = sopsconfig.FindConfigFile(absPath)
+	return err == nil, nil
+}
+
+// initClusterConfig returns talhelper config from `answers`.
+// It returns an error, if any.
+func initClusterConfig(answers *InitAnswers) (*config.TalhelperConfig, error) {
+	cfg := &config.TalhelperConfig{
+		ClusterName:       answers.ClusterName,
+		Endpoint:          answers.Endpoint,
+		TalosVersion:      answers.TalosVersion,
+		KubernetesVersion: answers.KubernetesVersion,
+	}
+
+	switch answers.CNI {
+	case "", "flannel":
+	case "none":
+		cfg.CNIConfig = &v1alpha1.CNIConfig{CNIName: "none"}
+	case "custom":
+		if len(answers.CNIUrls) == 0 {
+			return nil, fmt.Errorf("custom CNI needs at least one URL")
+		}
+		cfg.CNIConfig = &v1alpha1.CNIConfig{CNIName: "custom", CNIUrls: answers.CNIUrls}
+	default:
+		return nil, fmt.Errorf("unknown CNI %q, should be one of: %s", answers.CNI, strings.Join(InitCNIs, ", "))
+	}
+
+	if len(answers.Extensions) > 0 {
+		if err := checkInitExtensions(cfg.GetTalosVersion(), answers.Extensions); err != nil {
+			return nil, err
+		}
+		for _, nc := range []*config.NodeConfigs{&cfg.ControlPlane, &cfg.Worker} {
+			nc.Schematic = &schematic.Schematic{}
+			nc.Schematic.Customization.SystemExtensions.OfficialExtensions = answers.Extensions
+		}
+	}
+
+	hasControlPlane := false
+	for _, n := range answers.Nodes {
+		hasControlPlane = hasControlPlane || n.ControlPlane
+		cfg.Nodes = append(cfg.Nodes, config.Node{
+			Hostname:     n.Hostname,
+			IPAddress:    n.IPAddress,
+			ControlPlane: n.ControlPlane,
+			InstallDisk:  n.InstallDisk,
+		})
+	}
+	if !hasControlPlane {
+		return nil, fmt.Errorf("at least one controlplane node is required")
+	}
+
+	return cfg, nil
+}
+
+// writeInitSecret generates the secrets for `cfg` and writes them into
+// `path`, encrypted with `sops` if `encrypted` is true. Otherwise the file is
+// added into `.gitignore` so it's not committed in plaintext.
+// It returns an error, if any.
+func writeInitSecret(cfg *config.TalhelperConfig, path string, encrypted bool) error {
+	vc, err := taloscfg.ParseContractFromVersion(cfg.GetTalosVersion())
+	if err != nil {
+		return err
+	}
+	sb, err := talos.NewSecretBundle(secrets.NewClock(), *vc)
+	if err != nil {
+		return err
+	}
+	content, err := encodeYaml(sb)
+	if err != nil {
+		return err
+	}
+
+	if !encrypted {
+		if err := dumpFile(path, content); err != nil {
+			return err
+		}
+		if err := config.AddToGitignore(filepath.Dir(path), filepath.Base(path)); err != nil {
+			return err
+		}
+		fmt.Printf("created %s and added it into .gitignore, it's not encrypted because there's no .sops.yaml\n", path)
+		return nil
+	}
+
+	content, err = encrypt.EncryptYamlWithSops(path, content)
+	if err != nil {
+		return err
+	}
+	if err := dumpFile(path, content); err != nil {
+		return err
+	}
+	fmt.Printf("created %s encrypted with sops\n", path)
+
+	return nil
+}
+
+// checkInitExtensions returns an error if any of `extensions` is not an
+// official extension of `talosVersion`.
+func checkInitExtensions(talosVersion string, extensions []string) error {
+	available := InitExtensions(talosVersion)
+	if available == nil {
+		return fmt.Errorf("official extensions of Talos %s are not known", talosVersion)
+	}
+	for _, ext := range extensions {
+		if !slices.Contains(available, ext) {
+			return fmt.Errorf("%q is not an official extension of Talos %s", ext, talosVersion)
+		}
+	}
+	return nil
+}
+
+// InitTalosVersions returns the released Talos versions known by talhelper,
+// the newest first.
+func InitTalosVersions() []string {
+	var result []string
+	for _, v := range config.OfficialExtensions.Versions {
+		if !strings.Contains(v.Version, "-") {
+			result = append(result, v.Version)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return semver.Compare(result[i], result[j]) > 0
+	})
+	return result
+}
+
+// InitExtensions returns the official extensions of `talosVersion` or nil if
+// the version is not known.
+func InitExtensions(talosVersion string) []string {
+	idx := config.OfficialExtensions.SliceIndex(talosVersion)
+	if idx < 0 {
+		return nil
+	}
+	return config.OfficialExtensions.Versions[idx].SystemExtensions
+}
+
+// defaultKubernetesVersion returns the default Kubernetes version of Talos
+// if it's supported by `talosVersion`, otherwise it returns empty string.
+func defaultKubernetesVersion(talosVersion string) string {
+	tv, err := compatibility.ParseTalosVersion(&machine.VersionInfo{Tag: talosVersion})
+	if err != nil {
+		return ""
+	}
+	kv, err := compatibility.ParseKubernetesVersion(constants.DefaultKubernetesVersion)
+	if err != nil || kv.SupportedWith(tv) != nil {
+		return ""
+	}
+	return "v" + constants.DefaultKubernetesVersion
+}
+
+// PromptInitAnswers asks the questions of `talhelper init` by writing them
+// into `out` and reading the answers from `in`. It returns an error, if any.
+func PromptInitAnswers(in io.Reader, out io.Writer) (*InitAnswers, error) {
+	p := &initPrompter{in: bufio.NewReader(in), out: out}
+	answers := &InitAnswers{}
+
+	var err error
+	if answers.ClusterName, err = p.ask("Cluster name", "mycluster", required); err != nil {
+		return nil, err
+	}
+
+	endpoint, err := p.ask("Kubernetes API endpoint (IP address, hostname or URL)", "", required)
+	if err != nil {
+		return nil, err
+	}
+	answers.Endpoint = initEndpoint(endpoint)
+
+	versions := InitTalosVersions()
+	if len(versions) > 5 {
+		versions = versions[:5]
+	}
+	fmt.Fprintf(p.out, "Available Talos versions: %s\n", strings.Join(versions, ", "))
+	if answers.TalosVersion, err = p.ask("Talos version", config.LatestTalosVersion, func(s string) error {
+		if !config.OfficialExtensions.Contains(s) {
+			return fmt.Errorf("%q is not a known Talos version", s)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	if answers.KubernetesVersion, err = p.ask("Kubernetes version", defaultKubernetesVersion(answers.TalosVersion), required); err != nil {
+		return nil, err
+	}
+
+	if answers.CNI, err = p.ask("CNI ("+strings.Join(InitCNIs, ", ")+")", "flannel", func(s string) error {
+		if !slices.Contains(InitCNIs, s) {
+			return fmt.Errorf("should be one of: %s", strings.Join(InitCNIs, ", "))
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	if answers.CNI == "custom" {
+		urls, err := p.ask("CNI manifest URLs (comma separated)", "", required)
+		if err != nil {
+			return nil, err
+		}
+		answers.CNIUrls = splitList(urls)
+	}
+
+	extensions, err := p.ask("Official extensions (comma separated, \"?\" to list them)", "", func(s string) error {
+		if s == "?" {
+			fmt.Fprintln(p.out, strings.Join(InitExtensions(answers.TalosVersion), "\n"))
+			return fmt.Errorf("pick the extensions from the list above")
+		}
+		return checkInitExtensions(answers.TalosVersion, splitList(s))
+	})
+	if err != nil {
+		return nil, err
+	}
+	answers.Extensions = splitList(extensions)
+
+	for i := 1; ; i++ {
+		fmt.Fprintf(p.out, "Node %d (leave hostname empty to finish)\n", i)
+		hostname, err := p.ask("  Hostname", "", func(s string) error {
+			if s == "" && len(answers.Nodes) == 0 {
+				return fmt.Errorf("at least one node is required")
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if hostname == "" {
+			break
+		}
+
+		node := InitNode{Hostname: hostname}
+		if node.IPAddress, err = p.ask("  IP address", "", func(s string) error {
+			_, err := netip.ParseAddr(s)
+			return err
+		}); err != nil {
+			return nil, err
+		}
+
+		controlPlane, err := p.ask("  Controlplane (yes, no)", yesNo(len(answers.Nodes) == 0), func(s string) error {
+			if s != "yes" && s != "no" {
+				return fmt.Errorf("should be yes or no")
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		node.ControlPlane = controlPlane == "yes"
+
+		if node.InstallDisk, err = p.ask("  Install disk", "/dev/sda", required); err != nil {
+			return nil, err
+		}
+		answers.Nodes = append(answers.Nodes, node)
+	}
+
+	if answers.AgeRecipient, err = p.ask("Age public key for .sops.yaml (leave empty to skip)", "", nil); err != nil {
+		return nil, err
+	}
+
+	return answers, nil
+}
+
+type initPrompter struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+// ask writes `question` and returns the answer or `def` if the answer is
+// empty. The question is asked again if `validate` returns an error.
+func (p *initPrompter) ask(question, def string, validate func(string) error) (string, error) {
+	for {
+		if def != "" {
+			fmt.Fprintf(p.out, "%s [%s]: ", question, def)
+		} else {
+			fmt.Fprintf(p.out, "%s: ", question)
+		}
+
+		line, err := p.in.ReadString('\n')
+		if err != nil && (!errors.Is(err, io.EOF) || line == "") {
+			if errors.Is(err, io.EOF) {
+				return "", fmt.Errorf("no answer for %q", question)
+			}
+			return "", err
+		}
+
+		answer := strings.TrimSpace(line)
+		if answer == "" {
+			answer = def
+		}
+		if validate != nil {
+			if err := validate(answer); err != nil {
+				fmt.Fprintf(p.out, "%s: %s\n", color.YellowString("invalid answer"), err)
+				continue
+			}
+		}
+		return answer, nil
+	}
+}
+
+func required(s string) error {
+	if s == "" {
+		return fmt.Errorf("answer is required")
+	}
+	return nil
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+// initEndpoint returns `endpoint` as Kubernetes API URL if it's only an IP
+// address or hostname.
+func initEndpoint(endpoint string) string {
+	if strings.Contains(endpoint, "://") {
+		return endpoint
+	}
+	if addr, err := netip.ParseAddr(endpoint); err == nil && addr.Is6() {
+		endpoint = "[" + endpoint + "]"
+	}
+	return fmt.Sprintf("https://%s:%d", endpoint, constants.DefaultControlPlanePort)
+}
+
+func splitList(s string) []string {
+	var result []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
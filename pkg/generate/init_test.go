@@ -0,0 +1,167 @@
+package generate
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/budimanjojo/talhelper/v3/pkg/config"
+	"github.com/budimanjojo/talhelper/v3/pkg/decrypt"
+)
+
+func TestInitConfig(t *testing.T) {
+	t.Setenv("SOPS_AGE_KEY", "AGE-SECRET-KEY-172FENV3SDP8JSRRX2SWTA9JQMAW7MW3GSKJ2JZDNXS4GVFAS5STQUW8WN4")
+
+	dir := t.TempDir()
+	answersFile := filepath.Join(dir, "answers.yaml")
+	answers := `clusterName: demo
+endpoint: https://10.0.0.10:6443
+talosVersion: ` + config.LatestTalosVersion + `
+kubernetesVersion: ` + defaultKubernetesVersion(config.LatestTalosVersion) + `
+cni: none
+extensions:
+  - siderolabs/intel-ucode
+nodes:
+  - hostname: cp1
+    ipAddress: 10.0.0.11
+    controlPlane: true
+    installDisk: /dev/sda
+  - hostname: w1
+    ipAddress: 10.0.0.21
+    installDisk: /dev/sdb
+ageRecipient: age10k9mjx3wcfzd7dwx3uqs68v7dzlwvwpzp8jyjpysjhy9mdwzhghqy2vhvn
+`
+	if err := os.WriteFile(answersFile, []byte(answers), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := LoadInitAnswers(answersFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	outDir := filepath.Join(dir, "out")
+	if err := InitConfig(a, InitOptions{OutDir: outDir}); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := config.LoadAndValidateFromFile(filepath.Join(outDir, "talconfig.yaml"), nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.ClusterName != "demo" || c.CNIConfig == nil || c.CNIConfig.CNIName != "none" || len(c.Nodes) != 2 || !c.Nodes[0].ControlPlane {
+		t.Errorf("unexpected config %+v", c)
+	}
+	if !reflect.DeepEqual(c.Nodes[1].Schematic.Customization.SystemExtensions.OfficialExtensions, []string{"siderolabs/intel-ucode"}) {
+		t.Errorf("expected extensions in worker schematic, got %+v", c.Nodes[1].Schematic)
+	}
+
+	secret, err := os.ReadFile(filepath.Join(outDir, "talsecret.sops.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !decrypt.IsYamlEncrypted(secret) {
+		t.Errorf("expected secret file to be encrypted, got:\n%s", secret)
+	}
+	decrypted, err := decrypt.DecryptYamlWithSops(filepath.Join(outDir, "talsecret.sops.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(decrypted), "bootstraptoken:") {
+		t.Errorf("unexpected decrypted secret:\n%s", decrypted)
+	}
+
+	if err := InitConfig(a, InitOptions{OutDir: outDir}); err == nil {
+		t.Error("expected error when output files exist, got nil")
+	}
+
+	for name, modify := range map[string]func(a *InitAnswers){
+		"no controlplane":   func(a *InitAnswers) { a.Nodes[0].ControlPlane = false },
+		"unknown extension": func(a *InitAnswers) { a.Extensions = []string{"foo/bar"} },
+		"unknown CNI":       func(a *InitAnswers) { a.CNI = "calico" },
+		"invalid config":    func(a *InitAnswers) { a.Endpoint = "" },
+	} {
+		b := *a
+		b.Nodes = append([]InitNode(nil), a.Nodes...)
+		modify(&b)
+		if err := InitConfig(&b, InitOptions{OutDir: t.TempDir()}); err == nil {
+			t.Errorf("%s: expected error, got nil", name)
+		}
+	}
+
+	a.AgeRecipient = ""
+	plainDir := t.TempDir()
+	if err := InitConfig(a, InitOptions{OutDir: plainDir}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(plainDir, "talsecret.sops.yaml")); !os.IsNotExist(err) {
+		t.Errorf("expected no talsecret.sops.yaml without .sops.yaml, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(plainDir, "talsecret.yaml")); err != nil {
+		t.Error(err)
+	}
+	gitignore, err := os.ReadFile(filepath.Join(plainDir, ".gitignore"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(gitignore) != "talsecret.yaml\n" {
+		t.Errorf("expected talsecret.yaml in .gitignore, got:\n%s", gitignore)
+	}
+}
+
+func TestPromptInitAnswers(t *testing.T) {
+	input := strings.Join([]string{
+		"",                        // cluster name
+		"10.0.0.10",               // endpoint
+		"v0.0.1",                  // unknown Talos version
+		config.LatestTalosVersion, // Talos version
+		"v1.30.0",                 // Kubernetes version
+		"cilium",                  // unknown CNI
+		"custom",                  // CNI
+		"https://a, https://b",    // CNI URLs
+		"",                        // extensions
+		"",                        // no node yet
+		"cp1",                     // hostname
+		"10.0.0.11",               // IP address
+		"",                        // controlplane
+		"",                        // install disk
+		"w1",                      // hostname
+		"10.0.0.21",               // IP address
+		"maybe",                   // invalid controlplane
+		"",                        // controlplane
+		"/dev/sdb",                // install disk
+		"",                        // done
+		"",                        // age recipient
+	}, "\n") + "\n"
+
+	out := new(strings.Builder)
+	answers, err := PromptInitAnswers(strings.NewReader(input), out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := &InitAnswers{
+		ClusterName:       "mycluster",
+		Endpoint:          "https://10.0.0.10:6443",
+		TalosVersion:      config.LatestTalosVersion,
+		KubernetesVersion: "v1.30.0",
+		CNI:               "custom",
+		CNIUrls:           []string{"https://a", "https://b"},
+		Nodes: []InitNode{
+			{Hostname: "cp1", IPAddress: "10.0.0.11", ControlPlane: true, InstallDisk: "/dev/sda"},
+			{Hostname: "w1", IPAddress: "10.0.0.21", InstallDisk: "/dev/sdb"},
+		},
+	}
+	if !reflect.DeepEqual(answers, expected) {
+		t.Errorf("got %+v, want %+v", answers, expected)
+	}
+	if strings.Count(out.String(), "invalid answer") != 4 {
+		t.Errorf("expected 4 invalid answers, got:\n%s", out)
+	}
+
+	if _, err := PromptInitAnswers(strings.NewReader("demo\n"), new(strings.Builder)); err == nil {
+		t.Error("expected error for missing answers, got nil")
+	}
+}
@@ -0,0 +1,39 @@
+package generate
+
+import (
+	"sync"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// forEachParallel calls `fn` for every index in `[0, n)` using at most
+// `parallelism` goroutines at once. Every index is processed even if some of
+// them fail. The errors are collected in index order so the result is the same
+// from run to run. It returns an error, if any.
+func forEachParallel(n, parallelism int, fn func(i int) error) error {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+
+	errs := make([]error, n)
+	sem := make(chan struct{}, parallelism)
+
+	var wg sync.WaitGroup
+	for i := range n {
+		sem <- struct{}{}
+		wg.Go(func() {
+			defer func() { <-sem }()
+			errs[i] = fn(i)
+		})
+	}
+	wg.Wait()
+
+	var result *multierror.Error
+	for _, err := range errs {
+		if err != nil {
+			result = multierror.Append(result, err)
+		}
+	}
+
+	return result.ErrorOrNil()
+}
@@ -0,0 +1,71 @@
+package generate
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestForEachParallel(t *testing.T) {
+	var running, maxRunning atomic.Int32
+	result := make([]int, 20)
+
+	err := forEachParallel(len(result), 3, func(i int) error {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			m := maxRunning.Load()
+			if n <= m || maxRunning.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		result[i] = i * 2
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if maxRunning.Load() > 3 {
+		t.Errorf("got %d workers running at once, want at most 3", maxRunning.Load())
+	}
+
+	for i, v := range result {
+		if v != i*2 {
+			t.Errorf("result[%d]: got %d, want %d", i, v, i*2)
+		}
+	}
+}
+
+func TestForEachParallelCollectsErrors(t *testing.T) {
+	var called atomic.Int32
+
+	err := forEachParallel(10, 4, func(i int) error {
+		called.Add(1)
+		if i%3 == 0 {
+			return fmt.Errorf("node%d failed", i)
+		}
+		return nil
+	})
+	if err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+
+	if called.Load() != 10 {
+		t.Errorf("got %d calls, want 10", called.Load())
+	}
+
+	got := err.Error()
+	last := -1
+	for _, want := range []string{"node0 failed", "node3 failed", "node6 failed", "node9 failed"} {
+		idx := strings.Index(got, want)
+		if idx == -1 {
+			t.Fatalf("expected %q in error, got %q", want, got)
+		}
+		if idx < last {
+			t.Errorf("expected errors in node order, got %q", got)
+		}
+		last = idx
+	}
+}
@@ -0,0 +1,138 @@
+package generate
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+)
+
+// secretPaths are the paths of secret values in Talos config documents.
+// `*` matches any map key or list item.
+var secretPaths = [][]string{
+	{"machine", "token"},
+	{"machine", "ca", "key"},
+	{"machine", "registries", "config", "*", "tls", "clientIdentity", "key"},
+	{"cluster", "token"},
+	{"cluster", "secret"},
+	{"cluster", "ca", "key"},
+	{"cluster", "aggregatorCA", "key"},
+	{"cluster", "serviceAccount", "key"},
+	{"cluster", "etcd", "ca", "key"},
+	{"cluster", "aescbcEncryptionSecret"},
+	{"cluster", "secretboxEncryptionSecret"},
+	{"cluster", "discovery", "registries", "service", "token"},
+	// inline manifests are often Kubernetes secrets
+	{"cluster", "inlineManifests", "*", "contents"},
+}
+
+// secretKeys are keys that hold a secret value wherever they're found.
+var secretKeys = []string{"privateKey", "password", "auth", "identityToken"}
+
+// redactSecrets replaces every secret value found in multi document Talos
+// config `data` with a hash of the value, so changes are still visible in
+// diffs without leaking the secret. It returns an error, if any.
+func redactSecrets(data []byte) ([]byte, error) {
+	// the file doesn't exist yet, there's nothing to redact
+	if len(bytes.TrimSpace(data)) == 0 {
+		return data, nil
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+
+	for {
+		var node yaml.Node
+		if err := dec.Decode(&node); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+
+		redactNode(&node, nil)
+
+		if err := enc.Encode(&node); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func redactNode(node *yaml.Node, path []string) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, n := range node.Content {
+			redactNode(n, path)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i].Value, node.Content[i+1]
+			p := append(slices.Clone(path), key)
+			if value.Kind == yaml.ScalarNode && isSecretPath(p) {
+				value.Value = redactedValue(value.Value)
+				value.Tag = "!!str"
+				value.Style = 0
+				continue
+			}
+			redactNode(value, p)
+		}
+	case yaml.SequenceNode:
+		for _, n := range node.Content {
+			redactNode(n, append(slices.Clone(path), "*"))
+		}
+	}
+}
+
+func isSecretPath(path []string) bool {
+	if slices.Contains(secretKeys, path[len(path)-1]) {
+		return true
+	}
+
+	for _, secret := range secretPaths {
+		if len(secret) != len(path) {
+			continue
+		}
+		matched := true
+		for i := range secret {
+			if secret[i] != "*" && secret[i] != path[i] {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// redactKey is the HMAC key of redacted values. It's random and only lives
+// for the current run, so the same secret is redacted the same way on both
+// sides of a diff but the redacted value can't be brute-forced offline.
+var redactKey = rand.Text()
+
+// redactedValue returns the replacement of secret `value`.
+func redactedValue(value string) string {
+	if value == "" {
+		return value
+	}
+	mac := hmac.New(sha256.New, []byte(redactKey))
+	mac.Write([]byte(value))
+	return "<redacted hmac:" + hex.EncodeToString(mac.Sum(nil)[:6]) + ">"
+}
@@ -0,0 +1,70 @@
+package generate
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRedactSecrets(t *testing.T) {
+	data := []byte(`version: v1alpha1
+machine:
+  token: abcdef.0123456789abcdef
+  ca:
+    crt: Y2VydA==
+    key: a2V5
+  network:
+    interfaces:
+      - interface: wg0
+        wireguard:
+          privateKey: c2VjcmV0
+  registries:
+    config:
+      ghcr.io:
+        auth:
+          username: me
+          password: hunter2
+cluster:
+  secretboxEncryptionSecret: c2VjcmV0Ym94
+  serviceAccount:
+    key: c2E=
+  inlineManifests:
+    - name: cilium-secret
+      contents: |
+        apiVersion: v1
+        kind: Secret
+        metadata:
+          name: cilium-ca
+        data:
+          ca.key: Y2lsaXVtLWtleQ==
+---
+apiVersion: v1alpha1
+kind: NetworkRuleConfig
+name: token
+`)
+
+	result, err := redactSecrets(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(result)
+
+	for _, secret := range []string{"abcdef.0123456789abcdef", "a2V5", "c2VjcmV0", "hunter2", "c2VjcmV0Ym94", "c2E=", "Y2lsaXVtLWtleQ=="} {
+		if strings.Contains(out, secret) {
+			t.Errorf("expected %q to be redacted, got:\n%s", secret, out)
+		}
+	}
+
+	for _, kept := range []string{"crt: Y2VydA==", "username: me", "name: token", "name: cilium-secret", "token: " + redactedValue("abcdef.0123456789abcdef")} {
+		if !strings.Contains(out, kept) {
+			t.Errorf("expected output to contain %q, got:\n%s", kept, out)
+		}
+	}
+
+	if result, err := redactSecrets(nil); err != nil || len(result) != 0 {
+		t.Errorf("expected empty input to be returned as is, got %q and %v", result, err)
+	}
+
+	if redactedValue("a") == redactedValue("b") {
+		t.Error("expected different secrets to have different hashes")
+	}
+}
@@ -0,0 +1,218 @@
+package generate
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/budimanjojo/talhelper/v3/pkg/encrypt"
+)
+
+// Sinks is the list of supported sinks for `NewSink`.
+var Sinks = []string{"dir", "stdout", "tar", "tar.gz", "sops"}
+
+// Sink is where the files generated by `GenerateConfig` are written to.
+type Sink interface {
+	// Write writes file `name` with `content` into the sink.
+	Write(name string, content []byte) error
+	// Location returns where file `name` is written to, for messages.
+	Location(name string) string
+	// Close flushes the sink, it must be called after every file is written.
+	Close() error
+	// Abort discards the sink when generating fails, so nothing partial is
+	// left behind. Files already written by `dir` sink are kept.
+	Abort() error
+}
+
+// NewSink returns the `Sink` of type `kind`. `outDir` is the directory used by
+// `dir` and `sops` sinks, while `archive` is the file path used by `tar` and
+// `tar.gz` sinks (`-` means stdout, empty string means `outDir` with the sink
+// extension). If `encrypt` is true, every file is encrypted with SOPS before
+// being written, `sops` sink is the same as `dir` sink with `encrypt` set.
+// It returns an error, if any.
+func NewSink(kind, outDir, archive string, encrypt bool) (Sink, error) {
+	if kind == "sops" {
+		kind, encrypt = "dir", true
+	}
+
+	sink, err := newSink(kind, outDir, archive)
+	if err != nil {
+		return nil, err
+	}
+
+	if encrypt {
+		return &encryptSink{Sink: sink, dir: outDir}, nil
+	}
+
+	return sink, nil
+}
+
+func newSink(kind, outDir, archive string) (Sink, error) {
+	switch kind {
+	case "", "dir":
+		return &dirSink{dir: outDir}, nil
+	case "stdout":
+		return &streamSink{w: os.Stdout}, nil
+	case "tar", "tar.gz":
+		if archive == "" {
+			archive = strings.TrimSuffix(outDir, "/") + "." + kind
+		}
+		return newTarSink(archive, kind == "tar.gz")
+	default:
+		return nil, fmt.Errorf("unknown sink %q, should be one of %s", kind, strings.Join(Sinks, ", "))
+	}
+}
+
+// encryptSink encrypts every file with SOPS before writing it into `Sink`.
+// The SOPS creation rule is matched against the path of the file in `dir`,
+// regardless of where `Sink` actually writes it to.
+type encryptSink struct {
+	Sink
+	dir string
+}
+
+func (s *encryptSink) Write(name string, content []byte) error {
+	encrypted, err := encrypt.EncryptYamlWithSops(s.dir+"/"+name, content)
+	if err != nil {
+		return err
+	}
+	return s.Sink.Write(name, encrypted)
+}
+
+// dirSink writes every file into `dir`.
+type dirSink struct {
+	dir string
+}
+
+func (s *dirSink) Write(name string, content []byte) error {
+	return dumpFile(s.Location(name), content)
+}
+
+func (s *dirSink) Location(name string) string {
+	return s.dir + "/" + name
+}
+
+func (s *dirSink) Close() error {
+	return nil
+}
+
+func (s *dirSink) Abort() error {
+	return nil
+}
+
+// streamSink writes every file into `w` as a multi document YAML stream.
+// Each file starts with a `# source: <name>` comment so they can be told apart.
+type streamSink struct {
+	w io.Writer
+}
+
+func (s *streamSink) Write(name string, content []byte) error {
+	if _, err := fmt.Fprintf(s.w, "---\n# source: %s\n", name); err != nil {
+		return err
+	}
+	content = []byte(strings.TrimPrefix(string(content), "---\n"))
+	if len(content) > 0 && content[len(content)-1] != '\n' {
+		content = append(content, '\n')
+	}
+	_, err := s.w.Write(content)
+	return err
+}
+
+func (s *streamSink) Location(name string) string {
+	return "stdout (" + name + ")"
+}
+
+func (s *streamSink) Close() error {
+	return nil
+}
+
+func (s *streamSink) Abort() error {
+	return nil
+}
+
+// tarSink writes every file into a (gzipped) tar archive. The archive is
+// written into a temporary file next to `path` and only renamed to `path` on
+// `Close`, so a failed run never leaves a partial archive behind.
+type tarSink struct {
+	path string
+	tmp  string
+	f    io.WriteCloser
+	gz   *gzip.Writer
+	tw   *tar.Writer
+}
+
+func newTarSink(path string, gz bool) (*tarSink, error) {
+	s := &tarSink{path: path}
+	if path == "-" {
+		s.f = os.Stdout
+	} else {
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			return nil, err
+		}
+		f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+		if err != nil {
+			return nil, err
+		}
+		s.f, s.tmp = f, f.Name()
+	}
+
+	var w io.Writer = s.f
+	if gz {
+		s.gz = gzip.NewWriter(s.f)
+		w = s.gz
+	}
+	s.tw = tar.NewWriter(w)
+
+	return s, nil
+}
+
+func (s *tarSink) Write(name string, content []byte) error {
+	err := s.tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0o600,
+		Size:    int64(len(content)),
+		ModTime: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = s.tw.Write(content)
+	return err
+}
+
+func (s *tarSink) Location(name string) string {
+	return s.path + ":" + name
+}
+
+func (s *tarSink) Close() error {
+	err := s.tw.Close()
+	if err == nil && s.gz != nil {
+		err = s.gz.Close()
+	}
+	if s.f == os.Stdout {
+		return err
+	}
+	if cerr := s.f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(s.tmp, s.path)
+	}
+	if err != nil {
+		_ = os.Remove(s.tmp)
+	}
+	return err
+}
+
+func (s *tarSink) Abort() error {
+	if s.f == os.Stdout {
+		return nil
+	}
+	_ = s.f.Close()
+	return os.Remove(s.tmp)
+}
@@ -0,0 +1,170 @@
+package generate
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStreamSink(t *testing.T) {
+	var buf bytes.Buffer
+	s := &streamSink{w: &buf}
+
+	if err := s.Write("node1.yaml", []byte("---\nversion: v1alpha1\n---\nkind: Foo")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Write("talosconfig", []byte("context: test\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "---\n# source: node1.yaml\nversion: v1alpha1\n---\nkind: Foo\n---\n# source: talosconfig\ncontext: test\n"
+	if buf.String() != expected {
+		t.Errorf("got:\n%s\nwant:\n%s", buf.String(), expected)
+	}
+}
+
+func TestTarSink(t *testing.T) {
+	outDir := filepath.Join(t.TempDir(), "clusterconfig")
+
+	s, err := NewSink("tar.gz", outDir, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{"node1.yaml": "version: v1alpha1\n", "talosconfig": "context: test\n"}
+	for _, name := range []string{"node1.yaml", "talosconfig"} {
+		if err := s.Write(name, []byte(files[name])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(outDir + ".tar.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tr := tar.NewReader(gz)
+	found := 0
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != files[hdr.Name] {
+			t.Errorf("got %q for %s, want %q", content, hdr.Name, files[hdr.Name])
+		}
+		found++
+	}
+	if found != len(files) {
+		t.Errorf("expected %d files in archive, got %d", len(files), found)
+	}
+
+	if _, err := os.Stat(outDir); !os.IsNotExist(err) {
+		t.Errorf("expected %s to not be created, got %v", outDir, err)
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(outDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("expected only the archive to be left, got %v", entries)
+	}
+}
+
+func TestTarSinkAbort(t *testing.T) {
+	archive := filepath.Join(t.TempDir(), "clusterconfig.tar")
+	if err := os.WriteFile(archive, []byte("previous"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewSink("tar", "clusterconfig", archive, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Write("node1.yaml", []byte("version: v1alpha1\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Abort(); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "previous" {
+		t.Errorf("expected existing archive to be kept, got %q", content)
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(archive))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("expected temporary archive to be removed, got %v", entries)
+	}
+}
+
+func TestNewSinkUnknown(t *testing.T) {
+	if _, err := NewSink("s3", "out", "", false); err == nil {
+		t.Error("expected error for unknown sink, got nil")
+	}
+}
+
+func TestEncryptSink(t *testing.T) {
+	t.Setenv("SOPS_AGE_KEY", "AGE-SECRET-KEY-172FENV3SDP8JSRRX2SWTA9JQMAW7MW3GSKJ2JZDNXS4GVFAS5STQUW8WN4")
+
+	dir := t.TempDir()
+	sopsCfg := "creation_rules:\n  - age: age10k9mjx3wcfzd7dwx3uqs68v7dzlwvwpzp8jyjpysjhy9mdwzhghqy2vhvn\n"
+	if err := os.WriteFile(filepath.Join(dir, ".sops.yaml"), []byte(sopsCfg), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	outDir := filepath.Join(dir, "clusterconfig")
+
+	s, err := NewSink("dir", outDir, "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Write("node1.yaml", []byte("machine:\n  token: mysecrettoken\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := os.ReadFile(filepath.Join(outDir, "node1.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(raw, []byte("mysecrettoken")) {
+		t.Fatalf("expected file to be encrypted, got:\n%s", raw)
+	}
+
+	// dry-run must be able to read the encrypted file back
+	content, err := getFileContentByte(filepath.Join(outDir, "node1.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "machine:\n    token: mysecrettoken\n" {
+		t.Errorf("got unexpected decrypted content %q", content)
+	}
+}
@@ -0,0 +1,207 @@
+package generate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/budimanjojo/talhelper/v3/pkg/config"
+)
+
+// UpgradeStep is a set of `talosctl upgrade` commands that are run together.
+// The next step should only be started after every command in the step
+// succeeded.
+type UpgradeStep struct {
+	ID       int      `json:"id"`
+	Role     string   `json:"role"`
+	Group    string   `json:"group,omitempty"`
+	Commands Commands `json:"commands"`
+}
+
+// UpgradePlan is an ordered list of `UpgradeStep` to upgrade a cluster.
+type UpgradePlan struct {
+	ClusterName    string        `json:"clusterName"`
+	MaxUnavailable int           `json:"maxUnavailable"`
+	Steps          []UpgradeStep `json:"steps"`
+}
+
+// UpgradePlanFormats is the list of supported formats for `PrintUpgradePlan`.
+var UpgradePlanFormats = []string{"script", "json"}
+
+// BuildUpgradePlan returns the plan to upgrade every node in `cfg.Nodes`.
+// Controlplane nodes are upgraded one at a time before the worker nodes, and
+// at most `maxUnavailable` worker nodes are upgraded at the same time. Nodes
+// are ordered by their `upgradeGroup` (in the order each group first appears)
+// and nodes from different groups are never upgraded in the same step.
+// `outDir` is directory where talosconfig is located.
+// It returns error, if any.
+func BuildUpgradePlan(cfg *config.TalhelperConfig, outDir string, extraFlags []string, offlineMode bool, maxUnavailable int) (*UpgradePlan, error) {
+	if maxUnavailable < 1 {
+		return nil, fmt.Errorf("max unavailable must be at least 1, got %d", maxUnavailable)
+	}
+
+	var groups []string
+	nodesByGroup := map[string]map[bool][]*config.Node{}
+	for i := range cfg.Nodes {
+		n := &cfg.Nodes[i]
+		if _, ok := nodesByGroup[n.UpgradeGroup]; !ok {
+			groups = append(groups, n.UpgradeGroup)
+			nodesByGroup[n.UpgradeGroup] = map[bool][]*config.Node{}
+		}
+		nodesByGroup[n.UpgradeGroup][n.ControlPlane] = append(nodesByGroup[n.UpgradeGroup][n.ControlPlane], n)
+	}
+
+	plan := &UpgradePlan{
+		ClusterName:    cfg.ClusterName,
+		MaxUnavailable: maxUnavailable,
+	}
+
+	for _, controlPlane := range []bool{true, false} {
+		batchSize := maxUnavailable
+		if controlPlane {
+			batchSize = 1
+		}
+
+		for _, group := range groups {
+			nodes := nodesByGroup[group][controlPlane]
+			for start := 0; start < len(nodes); start += batchSize {
+				step := UpgradeStep{
+					ID:    len(plan.Steps) + 1,
+					Group: group,
+				}
+				for _, n := range nodes[start:min(start+batchSize, len(nodes))] {
+					ips := n.GetIPAddresses()
+					if len(ips) == 0 {
+						return nil, fmt.Errorf("node %s has no IP address", n.Hostname)
+					}
+
+					url, err := installerURL(cfg, n, offlineMode)
+					if err != nil {
+						return nil, err
+					}
+
+					// A node only needs to be upgraded once, so only its first IP is used.
+					step.Role = n.GetRole()
+					step.Commands = append(step.Commands, upgradeCommand(n, outDir, ips[0], url, extraFlags))
+				}
+				plan.Steps = append(plan.Steps, step)
+			}
+		}
+	}
+
+	return plan, nil
+}
+
+// PrintUpgradePlan prints `plan` to stdout in the given `format`.
+// It returns an error, if any.
+func PrintUpgradePlan(plan *UpgradePlan, format string) error {
+	return writeUpgradePlan(os.Stdout, plan, format)
+}
+
+// writeUpgradePlan writes `plan` into `w` in the given `format`. The `script`
+// format writes a resumable bash script, while `json` writes the structured
+// form of `plan`. It returns an error, if any.
+func writeUpgradePlan(w io.Writer, plan *UpgradePlan, format string) error {
+	switch format {
+	case "script":
+		_, err := io.WriteString(w, upgradePlanScript(plan))
+		return err
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(plan)
+	default:
+		return fmt.Errorf("unknown output format %q, should be one of %s", format, strings.Join(UpgradePlanFormats, ", "))
+	}
+}
+
+// upgradePlanHash returns the short hash of `plan`, it changes whenever any
+// step or command of `plan` changes.
+func upgradePlanHash(plan *UpgradePlan) string {
+	// UpgradePlan only has JSON friendly fields so this never fails
+	data, _ := json.Marshal(plan)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// upgradePlanScript renders `plan` as a bash script. Every finished step is
+// recorded into a state file so running the script again resumes from the
+// first unfinished step. The first line of the state file is the hash of
+// `plan`, so the state of another plan is never resumed. The state file is
+// removed after the last step is finished. Every value from `plan` is shell
+// quoted, so it's passed as is to the commands.
+func upgradePlanScript(plan *UpgradePlan) string {
+	var b strings.Builder
+
+	b.WriteString("#!/usr/bin/env bash\n")
+	fmt.Fprintf(&b, "# Upgrade plan for cluster %s generated by talhelper.\n", shellComment(plan.ClusterName))
+	b.WriteString("# Finished steps are recorded in the state file, run this script again to resume.\n")
+	b.WriteString("set -euo pipefail\n\n")
+	fmt.Fprintf(&b, "plan=%s\n", shellQuote("plan "+upgradePlanHash(plan)))
+	fmt.Fprintf(&b, "state=${TALHELPER_UPGRADE_STATE:-%s}\n", shellQuote(".talhelper-upgrade-"+plan.ClusterName+".state"))
+	b.WriteString("if [ \"$(head -n 1 \"$state\" 2>/dev/null)\" != \"$plan\" ]; then\n")
+	b.WriteString("  echo \"$plan\" > \"$state\"\n")
+	b.WriteString("fi\n")
+
+	for _, step := range plan.Steps {
+		var hosts []string
+		for _, cmd := range step.Commands {
+			hosts = append(hosts, cmd.Hostname)
+		}
+		desc := fmt.Sprintf("step %d/%d: %s %s", step.ID, len(plan.Steps), step.Role, strings.Join(hosts, ", "))
+		if step.Group != "" {
+			desc += fmt.Sprintf(" (group %s)", step.Group)
+		}
+
+		fmt.Fprintf(&b, "\n# %s\n", shellComment(desc))
+		fmt.Fprintf(&b, "if ! grep -qx %d \"$state\"; then\n", step.ID)
+		fmt.Fprintf(&b, "  echo %s\n", shellQuote("==> "+desc))
+		if len(step.Commands) == 1 {
+			fmt.Fprintf(&b, "  %s\n", shellCommand(step.Commands[0].Args))
+		} else {
+			b.WriteString("  pids=()\n")
+			for _, cmd := range step.Commands {
+				fmt.Fprintf(&b, "  %s &\n  pids+=($!)\n", shellCommand(cmd.Args))
+			}
+			b.WriteString("  for pid in \"${pids[@]}\"; do wait \"$pid\"; done\n")
+		}
+		fmt.Fprintf(&b, "  echo %d >> \"$state\"\n", step.ID)
+		b.WriteString("fi\n")
+	}
+
+	b.WriteString("\nrm \"$state\"\n")
+	b.WriteString("echo \"==> upgrade finished\"\n")
+
+	return b.String()
+}
+
+// shellSafe matches the words that don't need to be quoted in shell.
+var shellSafe = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+// shellQuote returns `s` quoted as a single shell word if it needs to be.
+func shellQuote(s string) string {
+	if shellSafe.MatchString(s) {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// shellCommand returns `args` as a shell command with every arg quoted.
+func shellCommand(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = shellQuote(arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// shellComment returns `s` with line breaks replaced so it stays in one
+// shell comment line.
+func shellComment(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
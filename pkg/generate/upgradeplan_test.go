@@ -0,0 +1,120 @@
+package generate
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/budimanjojo/talhelper/v3/pkg/config"
+)
+
+func upgradePlanTestConfig() *config.TalhelperConfig {
+	node := func(hostname, ip string, controlPlane bool, group string) config.Node {
+		n := config.Node{Hostname: hostname, IPAddress: ip, ControlPlane: controlPlane, UpgradeGroup: group}
+		n.TalosImageURL = "factory.talos.dev/installer/abc"
+		return n
+	}
+
+	return &config.TalhelperConfig{
+		ClusterName:  "test",
+		TalosVersion: "v1.9.0",
+		Nodes: []config.Node{
+			node("worker1", "10.0.0.11", false, "rack-a"),
+			node("cp1", "10.0.0.1, 10.0.1.1", true, ""),
+			node("worker2", "10.0.0.12", false, ""),
+			node("cp2", "10.0.0.2", true, "rack-a"),
+			node("worker3", "10.0.0.13", false, "rack-a"),
+			node("worker4", "10.0.0.14", false, "rack-a"),
+			node("worker5", "10.0.0.15", false, ""),
+		},
+	}
+}
+
+func TestBuildUpgradePlan(t *testing.T) {
+	plan, err := BuildUpgradePlan(upgradePlanTestConfig(), "out", []string{"--preserve"}, true, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got [][]string
+	for i, step := range plan.Steps {
+		if step.ID != i+1 {
+			t.Errorf("expected step ID %d, got %d", i+1, step.ID)
+		}
+		var hosts []string
+		for _, cmd := range step.Commands {
+			hosts = append(hosts, cmd.Hostname)
+		}
+		got = append(got, hosts)
+	}
+
+	expected := [][]string{
+		{"cp2"},
+		{"cp1"},
+		{"worker1", "worker3"},
+		{"worker4"},
+		{"worker2", "worker5"},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got steps %v, want %v", got, expected)
+	}
+
+	cp1 := plan.Steps[1].Commands[0].String()
+	if cp1 != "talosctl upgrade --talosconfig=out/talosconfig --nodes=10.0.0.1 --image=factory.talos.dev/installer/abc:v1.9.0 --preserve;" {
+		t.Errorf("got unexpected command %q", cp1)
+	}
+
+	if plan.Steps[0].Role != "controlplane" || plan.Steps[2].Role != "worker" || plan.Steps[2].Group != "rack-a" {
+		t.Errorf("got unexpected step %+v", plan.Steps[2])
+	}
+
+	if _, err := BuildUpgradePlan(upgradePlanTestConfig(), "out", nil, true, 0); err == nil {
+		t.Error("expected error for max unavailable 0, got nil")
+	}
+}
+
+func TestWriteUpgradePlanScript(t *testing.T) {
+	plan, err := BuildUpgradePlan(upgradePlanTestConfig(), "out", nil, true, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := writeUpgradePlan(&out, plan, "script"); err != nil {
+		t.Fatal(err)
+	}
+	script := out.String()
+
+	for _, s := range []string{
+		"set -euo pipefail",
+		`state=${TALHELPER_UPGRADE_STATE:-.talhelper-upgrade-test.state}`,
+		`if ! grep -qx 3 "$state"; then`,
+		"talosctl upgrade --talosconfig=out/talosconfig --nodes=10.0.0.13 --image=factory.talos.dev/installer/abc:v1.9.0 &",
+		`echo 4 >> "$state"`,
+	} {
+		if !strings.Contains(script, s) {
+			t.Errorf("expected script to contain %q, got:\n%s", s, script)
+		}
+	}
+
+	if err := writeUpgradePlan(&out, plan, "yaml"); err == nil {
+		t.Error("expected error for unknown format, got nil")
+	}
+
+	cfg := upgradePlanTestConfig()
+	cfg.ClusterName = `it's "$(reboot)"`
+	plan, err = BuildUpgradePlan(cfg, "out", []string{"--reboot-mode=powercycle", "--stage", `--extra=a b's $HOME`}, true, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	script = upgradePlanScript(plan)
+	for _, s := range []string{
+		`state=${TALHELPER_UPGRADE_STATE:-'.talhelper-upgrade-it'\''s "$(reboot)".state'}`,
+		`--reboot-mode=powercycle --stage '--extra=a b'\''s $HOME'`,
+	} {
+		if !strings.Contains(script, s) {
+			t.Errorf("expected script to contain %q, got:\n%s", s, script)
+		}
+	}
+}
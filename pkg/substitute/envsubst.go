@@ -1,16 +1,15 @@
 package substitute
 
 import (
-	"bytes"
 	"errors"
 	"fmt"
-	"io"
 	"log/slog"
 	"os"
 	"regexp"
 
 	"github.com/a8m/envsubst"
 	"github.com/budimanjojo/talhelper/v3/pkg/decrypt"
+	"github.com/budimanjojo/talhelper/v3/pkg/yamledit"
 	"github.com/joho/godotenv"
 	"gopkg.in/yaml.v3"
 )
@@ -58,57 +57,65 @@ func LoadEnv(file []byte) error {
 }
 
 // SubstituteEnvFromByte reads yaml bytes and do `envsubst` on
-// them. The substituted bytes will be returned. It returns an
-// error, if any.
+// the keys and values in them. Comments are kept as is and not
+// substituted. The substituted bytes will be returned. It returns
+// an error, if any.
 func SubstituteEnvFromByte(file []byte) ([]byte, error) {
-	filtered, err := stripYamlComment(file)
+	doc, err := yamledit.Parse(file)
 	if err != nil {
 		return nil, err
 	}
-	data, err := envsubst.BytesRestricted(filtered, true, true)
-	if err != nil {
-		return nil, err
+
+	for _, node := range doc.Nodes {
+		if err := SubstituteEnvFromNode(node); err != nil {
+			return nil, err
+		}
 	}
 
-	return data, nil
+	return doc.Encode()
 }
 
-// stripYamlComment takes yaml bytes and returns them back with
-// comments stripped.
-func stripYamlComment(file []byte) ([]byte, error) {
-	decoder := yaml.NewDecoder(bytes.NewReader(file))
-	var out bytes.Buffer
-	encoder := yaml.NewEncoder(&out)
-	encoder.SetIndent(2)
-	for {
-		var node yaml.Node
-		err := decoder.Decode(&node)
-		if errors.Is(err, io.EOF) {
-			break
-		}
-		if err != nil {
-			return nil, err
-		}
-		removeCommentsRec(&node)
-		err = encoder.Encode(&node)
-		if err != nil {
-			return nil, err
+// SubstituteEnvFromNode is the same as `SubstituteEnvFromByte` but it works
+// on `node` in place. The line and column of substituted nodes are kept, so
+// they still point to where they are in the original file. It returns an
+// error, if any.
+func SubstituteEnvFromNode(node *yaml.Node) error {
+	return yamledit.Walk(node, func(_ []string, n *yaml.Node, isKey bool) error {
+		if n.Kind != yaml.ScalarNode {
+			return nil
 		}
-	}
-	err := encoder.Close()
+		return substituteEnvNode(n, isKey)
+	})
+}
+
+// substituteEnvNode does `envsubst` on the value of scalar `node`. Plain
+// values are parsed again so substituted values like `123` or `[a, b]`
+// keep their type like they were written in the file. The nodes parsed
+// from a substituted value are not substituted again, `yamledit.SkipNode`
+// is returned instead. It returns an error, if any.
+func substituteEnvNode(node *yaml.Node, isKey bool) error {
+	value, err := envsubst.StringRestricted(node.Value, true, true)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if value == node.Value {
+		return nil
 	}
-	return out.Bytes(), nil
-}
 
-func removeCommentsRec(node *yaml.Node) {
-	node.HeadComment = ""
-	node.LineComment = ""
-	node.FootComment = ""
-	for _, c := range node.Content {
-		removeCommentsRec(c)
+	node.Value = value
+	if node.Style != 0 {
+		return nil
+	}
+
+	var parsed yaml.Node
+	if err := yaml.Unmarshal([]byte(value), &parsed); err == nil && len(parsed.Content) == 1 && (!isKey || parsed.Content[0].Kind == yaml.ScalarNode) {
+		yamledit.SetPosition(parsed.Content[0], node.Line, node.Column)
+		yamledit.Replace(node, parsed.Content[0])
+		return yamledit.SkipNode
 	}
+
+	node.Tag = "!!str"
+	return nil
 }
 
 // stripYAMLDocDelimiter replace YAML document delimiter with empty line
@@ -42,8 +42,10 @@ d: ${env4:=$default}
 `
 
 	expected := `a: value1
-b: "default value"
-c: "123"
+b: "default value" ## commentb
+## this is comment
+# another comment
+c: "123" # commentc
 d: default value
 `
 
@@ -84,7 +86,7 @@ default: default value
 	}
 }
 
-func TestComplexCommentStrip(t *testing.T) {
+func TestComplexComment(t *testing.T) {
 	file := `a1: '123!@# not a comment'
 a2: |
   # not a comment
@@ -96,9 +98,9 @@ b3: "\"" # comment
 	expected := `a1: '123!@# not a comment'
 a2: |
   # not a comment
-b1: '"'
-b2: "'"
-b3: "\""
+b1: '"' # comment
+b2: "'" # comment
+b3: "\"" # comment
 `
 
 	result, _ := SubstituteEnvFromByte([]byte(file))
@@ -106,3 +108,70 @@ b3: "\""
 		t.Errorf("got\n%s,\bwant\n%s", string(result), expected)
 	}
 }
+
+func TestSubstituteEnvFromYamlTypes(t *testing.T) {
+	os.Setenv("TYPES_NUMBER", "123")
+	os.Setenv("TYPES_LIST", "[a, b]")
+	os.Setenv("TYPES_KEY", "key")
+	os.Setenv("TYPES_MULTILINE", "a: b\nc")
+
+	file := `---
+# header
+number: ${TYPES_NUMBER} # number
+quoted: "${TYPES_NUMBER}"
+list: ${TYPES_LIST}
+${TYPES_KEY}: value
+multiline: ${TYPES_MULTILINE}
+escaped: $${TYPES_NUMBER}
+# ${NOT_SET}
+`
+
+	expected := `---
+# header
+number: 123 # number
+quoted: "123"
+list: [a, b]
+key: value
+multiline: |-
+  a: b
+  c
+escaped: ${TYPES_NUMBER}
+# ${NOT_SET}
+`
+
+	result, err := SubstituteEnvFromByte([]byte(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected != string(result) {
+		t.Errorf("got\n%s,\bwant\n%s", string(result), expected)
+	}
+
+	if _, err := SubstituteEnvFromByte([]byte("a: ${NOT_SET}")); err == nil {
+		t.Error("expected error for unset variable, got nil")
+	}
+}
+
+func TestSubstituteEnvFromYamlOnce(t *testing.T) {
+	os.Setenv("ONCE_NUMBER", "123")
+	os.Setenv("ONCE_LIST", "[$ONCE_NUMBER, $NOT_SET]")
+	os.Setenv("ONCE_MAP", "{a: $ONCE_NUMBER}")
+
+	file := `---
+list: ${ONCE_LIST}
+map: ${ONCE_MAP}
+`
+
+	expected := `---
+list: [$ONCE_NUMBER, $NOT_SET]
+map: {a: $ONCE_NUMBER}
+`
+
+	result, err := SubstituteEnvFromByte([]byte(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected != string(result) {
+		t.Errorf("got\n%s,\bwant\n%s", string(result), expected)
+	}
+}
@@ -1,10 +1,10 @@
 package substitute
 
 import (
-	"fmt"
 	"path/filepath"
 	"strings"
 
+	"github.com/budimanjojo/talhelper/v3/pkg/yamledit"
 	"gopkg.in/yaml.v3"
 )
 
@@ -15,59 +15,37 @@ import (
 // file to the relative paths in the config file so that their evaluation no longer fails.
 // It returns an error, if any.
 func SubstituteRelativePaths(configFilePath string, yamlContent []byte) ([]byte, error) {
-	// Get the directory of the YAML file
-	absolutePath, err := filepath.Abs(filepath.Dir(configFilePath))
+	doc, err := yamledit.Parse(yamlContent)
 	if err != nil {
 		return nil, err
 	}
 
-	// Parse the YAML content
-	var data interface{}
-	err = yaml.Unmarshal(yamlContent, &data)
-	if err != nil {
-		return nil, err
+	for _, node := range doc.Nodes {
+		if err := SubstituteRelativePathsFromNode(configFilePath, node); err != nil {
+			return nil, err
+		}
 	}
 
-	// Process the data
-	data = processNode(data, []string{}, absolutePath)
+	return doc.Encode()
+}
 
-	// Marshal back to YAML
-	newYamlContent, err := yaml.Marshal(data)
+// SubstituteRelativePathsFromNode is the same as `SubstituteRelativePaths` but
+// it works on `node` in place. It returns an error, if any.
+func SubstituteRelativePathsFromNode(configFilePath string, node *yaml.Node) error {
+	absolutePath, err := filepath.Abs(filepath.Dir(configFilePath))
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	return newYamlContent, nil
-}
-
-func processNode(node interface{}, path []string, yamlDir string) interface{} {
-	switch n := node.(type) {
-	case map[string]interface{}:
-		newMap := make(map[string]interface{})
-		for k, v := range n {
-			newPath := append(path, k)
-			newMap[k] = processNode(v, newPath, yamlDir)
-		}
-		return newMap
-
-	case []interface{}:
-		newArray := make([]interface{}, len(n))
-		for i, v := range n {
-			newPath := append(path, fmt.Sprintf("[%d]", i))
-			newArray[i] = processNode(v, newPath, yamlDir)
+	return yamledit.Walk(node, func(path []string, n *yaml.Node, isKey bool) error {
+		if isKey || n.Kind != yaml.ScalarNode || n.Tag != "!!str" {
+			return nil
 		}
-		return newArray
-
-	case string:
-		should, special := shouldSubstitute(path)
-		if should {
-			return handleSubstitution(n, yamlDir, special)
-		} else {
-			return n
+		if should, special := shouldSubstitute(path); should {
+			n.Value = handleSubstitution(n.Value, absolutePath, special)
 		}
-	default:
-		return n
-	}
+		return nil
+	})
 }
 
 func shouldSubstitute(path []string) (should, special bool) {
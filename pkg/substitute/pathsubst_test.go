@@ -206,3 +206,35 @@ extraManifests:
 		})
 	}
 }
+
+func TestSubstituteRelativePathsKeepComments(t *testing.T) {
+	yamlContent := `---
+# cluster
+clusterName: test
+patches:
+  - "@./patch.yaml" # global patch
+nodes:
+  - hostname: kworker1
+    extraManifests:
+      - ./manifest.yaml
+`
+
+	expected := `---
+# cluster
+clusterName: test
+patches:
+  - "@/path/to/patch.yaml" # global patch
+nodes:
+  - hostname: kworker1
+    extraManifests:
+      - '@/path/to/manifest.yaml'
+`
+
+	result, err := SubstituteRelativePaths("/path/to/config.yaml", []byte(yamlContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected != string(result) {
+		t.Errorf("got\n%s\nwant\n%s", result, expected)
+	}
+}
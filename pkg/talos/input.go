@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"log/slog"
+	"os"
 
 	"github.com/budimanjojo/talhelper/v3/pkg/config"
 	"github.com/budimanjojo/talhelper/v3/pkg/decrypt"
@@ -18,8 +19,6 @@ import (
 // NewClusterInput takes `Talhelper` config and path to encrypted `secretFile` and
 // returns Talos `generate.Input`. It also returns an error, if any.
 func NewClusterInput(c *config.TalhelperConfig, secretFile string, mode string) (*generate.Input, error) {
-	kubernetesVersion := c.GetK8sVersion()
-
 	versionContract, err := tconfig.ParseContractFromVersion(c.GetTalosVersion())
 	if err != nil {
 		return nil, err
@@ -51,13 +50,26 @@ func NewClusterInput(c *config.TalhelperConfig, secretFile string, mode string)
 		}
 		sb.Clock = secrets.NewClock()
 	} else {
-		fmt.Printf("%s: secrets file is not found, new secrets will be generated everytime you run this command\n", color.YellowString("WARNING"))
+		fmt.Fprintf(os.Stderr, "%s: secrets file is not found, new secrets will be generated everytime you run this command\n", color.YellowString("WARNING"))
 		sb, err = NewSecretBundle(secrets.NewClock(), *versionContract)
 		if err != nil {
 			return nil, err
 		}
 	}
 
+	return NewClusterInputFromBundle(c, sb, mode)
+}
+
+// NewClusterInputFromBundle is the same as `NewClusterInput` but the secrets
+// are taken from `sb`. It also returns an error, if any.
+func NewClusterInputFromBundle(c *config.TalhelperConfig, sb *secrets.Bundle, mode string) (*generate.Input, error) {
+	kubernetesVersion := c.GetK8sVersion()
+
+	versionContract, err := tconfig.ParseContractFromVersion(c.GetTalosVersion())
+	if err != nil {
+		return nil, err
+	}
+
 	opts := parseOptions(c, versionContract, sb, mode)
 
 	slog.Debug("generating input file", "clusterName", c.ClusterName, "endpoint", c.Endpoint, "kubernetesVersion", kubernetesVersion)
@@ -7,10 +7,12 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
+	"os"
 	"text/template"
 
 	"github.com/Masterminds/sprig/v3"
 	"github.com/budimanjojo/talhelper/v3/pkg/config"
+	"github.com/fatih/color"
 	"github.com/siderolabs/image-factory/pkg/schematic"
 )
 
@@ -148,13 +150,26 @@ func getSchematicID(cfg *schematic.Schematic, iFactory *config.ImageFactory, off
 		}
 		return id, nil
 	}
-	var resp factoryPOSTResult
+
 	schematicURL := iFactory.Protocol + "://" + iFactory.RegistryURL + iFactory.SchematicEndpoint
-	slog.Debug(fmt.Sprintf("generating schematic ID from %s", schematicURL))
-	if err := doHTTPPOSTRequest(body, schematicURL, &resp); err != nil {
+	id, err := schematicCache.Get(schematicURL, body, func() (string, error) {
+		var resp factoryPOSTResult
+		slog.Debug(fmt.Sprintf("generating schematic ID from %s", schematicURL))
+		if err := doHTTPPOSTRequest(body, schematicURL, &resp); err != nil {
+			return "", err
+		}
+		return resp.ID, nil
+	})
+	if errors.Is(err, errFailedtoPost) {
+		// the image factory is unreachable, the schematic ID computed locally should
+		// be the same as long as the image factory generates it the same way upstream does
+		fmt.Fprintf(os.Stderr, "%s: %s, generating schematic ID in offline mode\n", color.YellowString("WARNING"), err)
+		return cfg.ID()
+	}
+	if err != nil {
 		return "", err
 	}
-	return resp.ID, nil
+	return id, nil
 }
 
 func doHTTPPOSTRequest(body []byte, url string, out interface{}) error {
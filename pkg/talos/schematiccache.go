@@ -0,0 +1,151 @@
+package talos
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// SchematicCache stores schematic IDs returned by the image factory on disk,
+// keyed by the schematic URL and a hash of the marshalled schematic, so the
+// same schematic doesn't have to be POSTed to the image factory over and over.
+type SchematicCache struct {
+	// Dir is where the cached schematic IDs are stored.
+	Dir string
+	// Disabled makes every lookup go to the image factory without reading
+	// or writing the cache.
+	Disabled bool
+	// Refresh makes the first lookup of every schematic in this process go
+	// to the image factory and overwrite the cached schematic ID.
+	Refresh bool
+
+	mu      sync.Mutex
+	entries map[string]*schematicCacheEntry
+}
+
+type schematicCacheEntry struct {
+	mu sync.Mutex
+	id string
+}
+
+var schematicCache = &SchematicCache{Dir: defaultSchematicCacheDir()}
+
+// SetSchematicCache configures the schematic ID cache used by `GetInstallerURL`
+// and `GetImageURL`. `disabled` bypasses the cache and `refresh` ignores the
+// cached schematic IDs and overwrites them with fresh ones.
+func SetSchematicCache(disabled, refresh bool) {
+	schematicCache.mu.Lock()
+	defer schematicCache.mu.Unlock()
+
+	schematicCache.Disabled = disabled
+	schematicCache.Refresh = refresh
+	schematicCache.entries = nil
+}
+
+// defaultSchematicCacheDir returns `talhelper/schematics` inside the user cache
+// directory, or an empty string if the user cache directory can't be determined.
+func defaultSchematicCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "talhelper", "schematics")
+}
+
+// Get returns the cached schematic ID for `body` POSTed to `schematicURL`, which
+// includes the protocol, registry URL and schematic endpoint. If it's not
+// cached yet, `fetch` is called to get it and the result is cached.
+// It returns an error, if any.
+func (c *SchematicCache) Get(schematicURL string, body []byte, fetch func() (string, error)) (string, error) {
+	if c.Disabled {
+		return fetch()
+	}
+
+	path := c.path(schematicURL, body)
+	e := c.entry(path)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.id != "" {
+		return e.id, nil
+	}
+
+	if !c.Refresh && c.Dir != "" {
+		content, err := os.ReadFile(path)
+		if err == nil && len(strings.TrimSpace(string(content))) > 0 {
+			e.id = strings.TrimSpace(string(content))
+			slog.Debug(fmt.Sprintf("using cached schematic ID %s from %s", e.id, path))
+			return e.id, nil
+		} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+			slog.Debug(fmt.Sprintf("failed to read cached schematic ID from %s: %s", path, err))
+		}
+	}
+
+	id, err := fetch()
+	if err != nil {
+		return "", err
+	}
+	e.id = id
+
+	if c.Dir != "" {
+		slog.Debug(fmt.Sprintf("caching schematic ID %s in %s", id, path))
+		if err := writeSchematicCacheFile(path, id); err != nil {
+			slog.Debug(fmt.Sprintf("failed to cache schematic ID in %s: %s", path, err))
+		}
+	}
+
+	return id, nil
+}
+
+func (c *SchematicCache) entry(key string) *schematicCacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.entries == nil {
+		c.entries = map[string]*schematicCacheEntry{}
+	}
+
+	e, ok := c.entries[key]
+	if !ok {
+		e = &schematicCacheEntry{}
+		c.entries[key] = e
+	}
+	return e
+}
+
+func (c *SchematicCache) path(schematicURL string, body []byte) string {
+	sum := sha256.Sum256(body)
+	return filepath.Join(c.Dir, url.PathEscape(schematicURL), hex.EncodeToString(sum[:]))
+}
+
+func writeSchematicCacheFile(path, id string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	// write to a temporary file first so other talhelper processes never
+	// read a half written schematic ID
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.WriteString(id + "\n"); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
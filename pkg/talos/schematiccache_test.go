@@ -0,0 +1,155 @@
+package talos
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/budimanjojo/talhelper/v3/pkg/config"
+	"github.com/siderolabs/image-factory/pkg/schematic"
+)
+
+func newFakeFactory(t *testing.T, id string) (*config.ImageFactory, *atomic.Int32) {
+	t.Helper()
+
+	var posts atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		posts.Add(1)
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(factoryPOSTResult{ID: id})
+	}))
+	t.Cleanup(srv.Close)
+
+	cfg := &config.TalhelperConfig{}
+	cfg.ImageFactory = config.ImageFactory{
+		RegistryURL: strings.TrimPrefix(srv.URL, "http://"),
+		Protocol:    "http",
+	}
+
+	return cfg.GetImageFactory(), &posts
+}
+
+func useSchematicCache(t *testing.T, c *SchematicCache) {
+	t.Helper()
+
+	orig := schematicCache
+	schematicCache = c
+	t.Cleanup(func() { schematicCache = orig })
+}
+
+func TestSchematicCache(t *testing.T) {
+	dir := t.TempDir()
+	factory, posts := newFakeFactory(t, "cached-id")
+	cfg := &schematic.Schematic{
+		Customization: schematic.Customization{
+			ExtraKernelArgs: []string{"net.ifnames=0"},
+		},
+	}
+
+	useSchematicCache(t, &SchematicCache{Dir: dir})
+	for range 3 {
+		id, err := getSchematicID(cfg, factory, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id != "cached-id" {
+			t.Errorf("got %s, want cached-id", id)
+		}
+	}
+	if posts.Load() != 1 {
+		t.Errorf("got %d POST requests, want 1", posts.Load())
+	}
+
+	// a new process should read the cached schematic ID from disk
+	useSchematicCache(t, &SchematicCache{Dir: dir})
+	if _, err := getSchematicID(cfg, factory, false); err != nil {
+		t.Fatal(err)
+	}
+	if posts.Load() != 1 {
+		t.Errorf("got %d POST requests after reading cache from disk, want 1", posts.Load())
+	}
+
+	useSchematicCache(t, &SchematicCache{Dir: dir, Refresh: true})
+	for range 2 {
+		if _, err := getSchematicID(cfg, factory, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if posts.Load() != 2 {
+		t.Errorf("got %d POST requests with refresh, want 2", posts.Load())
+	}
+
+	useSchematicCache(t, &SchematicCache{Dir: dir, Disabled: true})
+	for range 2 {
+		if _, err := getSchematicID(cfg, factory, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if posts.Load() != 4 {
+		t.Errorf("got %d POST requests with cache disabled, want 4", posts.Load())
+	}
+}
+
+func TestSchematicCacheKey(t *testing.T) {
+	c := &SchematicCache{Dir: t.TempDir()}
+	body := []byte("customization: {}")
+
+	urls := []string{
+		"https://factory.talos.dev/schematics",
+		"http://factory.talos.dev/schematics",
+		"https://factory.talos.dev/v2/schematics",
+	}
+	for _, u := range urls {
+		id, err := c.Get(u, body, func() (string, error) { return u, nil })
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id != u {
+			t.Errorf("got %s from %s, want %s", id, u, u)
+		}
+	}
+
+	// a new process should read the schematic ID cached for the same URL
+	c = &SchematicCache{Dir: c.Dir}
+	for _, u := range urls {
+		id, err := c.Get(u, body, func() (string, error) { return "", errors.New("unexpected fetch") })
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id != u {
+			t.Errorf("got %s from %s, want %s", id, u, u)
+		}
+	}
+}
+
+func TestSchematicCacheUnreachableFactory(t *testing.T) {
+	useSchematicCache(t, &SchematicCache{Dir: t.TempDir()})
+
+	srv := httptest.NewServer(http.NotFoundHandler())
+	registryURL := strings.TrimPrefix(srv.URL, "http://")
+	srv.Close()
+
+	cfg := &schematic.Schematic{}
+	factory := &config.ImageFactory{
+		RegistryURL:       registryURL,
+		SchematicEndpoint: "/schematics",
+		Protocol:          "http",
+	}
+
+	id, err := getSchematicID(cfg, factory, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedID, err := cfg.ID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != expectedID {
+		t.Errorf("got %s, want %s", id, expectedID)
+	}
+}
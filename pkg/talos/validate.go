@@ -70,7 +70,7 @@ func ValidateConfigFromBytes(cfgFile []byte, mode string) error {
 
 	warnings, err := cfg.ValidateAsClient(m, validation.WithLocal(), validation.WithStrict())
 	for _, w := range warnings {
-		fmt.Printf("%s\n", w)
+		fmt.Fprintf(os.Stderr, "%s\n", w)
 	}
 	if err != nil {
 		return err
@@ -0,0 +1,105 @@
+package yamledit
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Document is a YAML file that can be edited and encoded back while keeping
+// its comments and the order of its fields.
+type Document struct {
+	// Nodes are the document nodes of every YAML document in the file.
+	Nodes []*yaml.Node
+	// ExplicitStart is true if the file starts with `---`.
+	ExplicitStart bool
+}
+
+// Parse takes YAML bytes and returns them as `Document`.
+// It returns an error, if any.
+func Parse(source []byte) (*Document, error) {
+	doc := &Document{
+		ExplicitStart: bytes.HasPrefix(bytes.TrimSpace(source), []byte("---")),
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(source))
+	for {
+		var node yaml.Node
+		err := decoder.Decode(&node)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		doc.Nodes = append(doc.Nodes, &node)
+	}
+
+	return doc, nil
+}
+
+// Root returns the root node of the first YAML document in `d` or nil if
+// `d` is empty.
+func (d *Document) Root() *yaml.Node {
+	if len(d.Nodes) == 0 || len(d.Nodes[0].Content) == 0 {
+		return nil
+	}
+	return d.Nodes[0].Content[0]
+}
+
+// Encode encodes `d` into YAML bytes with 2 spaces indentation.
+// It returns an error, if any.
+func (d *Document) Encode() ([]byte, error) {
+	result, err := Encode(d.Nodes...)
+	if err != nil {
+		return nil, err
+	}
+	if d.ExplicitStart && len(result) > 0 {
+		result = append([]byte("---\n"), result...)
+	}
+
+	return result, nil
+}
+
+// Encode encodes `nodes` into YAML bytes with 2 spaces indentation, every
+// node is encoded as its own YAML document. It returns an error, if any.
+func Encode(nodes ...*yaml.Node) ([]byte, error) {
+	if len(nodes) == 0 {
+		return nil, nil
+	}
+
+	buf := new(bytes.Buffer)
+	encoder := yaml.NewEncoder(buf)
+	encoder.SetIndent(2)
+
+	for _, node := range nodes {
+		fixFoldedScalars(node)
+		if err := encoder.Encode(node); err != nil {
+			return nil, err
+		}
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// fixFoldedScalars changes folded scalars with more indented lines in `node`
+// into literal scalars, because `yaml.v3` doesn't encode them correctly.
+func fixFoldedScalars(node *yaml.Node) {
+	if node.Kind == yaml.ScalarNode && node.Style&yaml.FoldedStyle != 0 {
+		for _, line := range strings.Split(node.Value, "\n") {
+			if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+				node.Style = node.Style&^yaml.FoldedStyle | yaml.LiteralStyle
+				break
+			}
+		}
+	}
+	for _, child := range node.Content {
+		fixFoldedScalars(child)
+	}
+}
@@ -0,0 +1,57 @@
+package yamledit
+
+import (
+	"testing"
+)
+
+func TestParseEncode(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		expected string
+	}{
+		{
+			name:     "comments and order",
+			source:   "---\n# head\nb: 1 # line\na:\n  - z\n  - y\n# foot\n",
+			expected: "---\n# head\nb: 1 # line\na:\n  - z\n  - y\n# foot\n",
+		},
+		{
+			name:     "multiple documents",
+			source:   "a: 1\n---\nb: 2\n",
+			expected: "a: 1\n---\nb: 2\n",
+		},
+		{
+			name:     "folded scalar with more indented lines",
+			source:   "a: >-\n  {{\n    .Foo\n  }}\n",
+			expected: "a: |-\n  {{\n    .Foo\n  }}\n",
+		},
+		{
+			name:     "folded scalar",
+			source:   "a: >-\n  foo\n  bar\n",
+			expected: "a: >-\n  foo bar\n",
+		},
+		{
+			name: "empty",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := Parse([]byte(tt.source))
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := doc.Encode()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(result) != tt.expected {
+				t.Errorf("got\n%s\nwant\n%s", result, tt.expected)
+			}
+		})
+	}
+
+	if _, err := Parse([]byte("a: [")); err == nil {
+		t.Error("expected error for invalid YAML, got nil")
+	}
+}
@@ -0,0 +1,100 @@
+package yamledit
+
+import (
+	"gopkg.in/yaml.v3"
+)
+
+// MappingIndex returns the index of `key` in mapping `m` or -1 if not found.
+func MappingIndex(m *yaml.Node, key string) int {
+	if m == nil || m.Kind != yaml.MappingNode {
+		return -1
+	}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// MappingValue returns the value of `key` in mapping `m` or nil if not found.
+func MappingValue(m *yaml.Node, key string) *yaml.Node {
+	if idx := MappingIndex(m, key); idx >= 0 {
+		return m.Content[idx+1]
+	}
+	return nil
+}
+
+// MappingSet sets the value of `key` in mapping `m`, the key is appended if
+// it doesn't exist.
+func MappingSet(m *yaml.Node, key string, value *yaml.Node) {
+	if idx := MappingIndex(m, key); idx >= 0 {
+		m.Content[idx+1] = value
+		return
+	}
+	m.Content = append(m.Content, NewString(key), value)
+}
+
+// MappingDelete removes `key` from mapping `m`. It returns true if the key
+// was found.
+func MappingDelete(m *yaml.Node, key string) bool {
+	idx := MappingIndex(m, key)
+	if idx < 0 {
+		return false
+	}
+	m.Content = append(m.Content[:idx], m.Content[idx+2:]...)
+	return true
+}
+
+// AppendToSequence appends `items` into the sequence of `key` in mapping `m`,
+// the sequence is created if it doesn't exist.
+func AppendToSequence(m *yaml.Node, key string, items ...*yaml.Node) {
+	seq := MappingValue(m, key)
+	if seq == nil || seq.Kind != yaml.SequenceNode {
+		seq = NewSequence()
+		MappingSet(m, key, seq)
+	}
+	seq.Content = append(seq.Content, items...)
+}
+
+// PruneEmpty removes map entries with null, empty or false value from `node`.
+func PruneEmpty(node *yaml.Node) {
+	for _, child := range node.Content {
+		PruneEmpty(child)
+	}
+
+	if node.Kind != yaml.MappingNode {
+		return
+	}
+
+	var content []*yaml.Node
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		v := node.Content[i+1]
+		empty := false
+		switch v.Kind {
+		case yaml.ScalarNode:
+			empty = v.Tag == "!!null" || (v.Tag == "!!str" && v.Value == "") || (v.Tag == "!!bool" && v.Value == "false")
+		case yaml.MappingNode, yaml.SequenceNode:
+			empty = len(v.Content) == 0
+		}
+		if !empty {
+			content = append(content, node.Content[i], v)
+		}
+	}
+	node.Content = content
+}
+
+// NewString returns a string scalar node of `value`.
+func NewString(value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+}
+
+// NewMapping returns an empty mapping node.
+func NewMapping() *yaml.Node {
+	return &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+}
+
+// NewSequence returns an empty sequence node.
+func NewSequence() *yaml.Node {
+	return &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+}
@@ -0,0 +1,37 @@
+package yamledit
+
+import (
+	"testing"
+)
+
+func TestMapping(t *testing.T) {
+	doc, err := Parse([]byte("a: 1 # a\nb: 2\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := doc.Root()
+
+	if MappingIndex(m, "b") != 2 || MappingIndex(m, "c") != -1 || MappingIndex(nil, "a") != -1 {
+		t.Error("unexpected mapping index")
+	}
+	if v := MappingValue(m, "a"); v == nil || v.Value != "1" {
+		t.Errorf("got value %v, want 1", v)
+	}
+
+	MappingSet(m, "b", NewString("3"))
+	MappingSet(m, "c", NewString("4"))
+	AppendToSequence(m, "d", NewString("x"))
+	AppendToSequence(m, "d", NewString("y"))
+	if !MappingDelete(m, "a") || MappingDelete(m, "a") {
+		t.Error("unexpected result of deleting key")
+	}
+
+	result, err := doc.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "b: \"3\"\nc: \"4\"\nd:\n  - x\n  - y\n"
+	if string(result) != expected {
+		t.Errorf("got\n%s\nwant\n%s", result, expected)
+	}
+}
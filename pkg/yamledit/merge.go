@@ -0,0 +1,93 @@
+package yamledit
+
+import (
+	"reflect"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Merge updates `dst` to have the same values as `src` while keeping the
+// comments, the order of fields and the style of unchanged values in `dst`.
+// Fields that don't exist in `src` are removed from `dst` and new fields
+// are appended.
+func Merge(dst, src *yaml.Node) {
+	if dst.Kind != src.Kind || dst.Kind == yaml.AliasNode {
+		Replace(dst, src)
+		return
+	}
+
+	switch dst.Kind {
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for i := 0; i < len(src.Content) && i < len(dst.Content); i++ {
+			Merge(dst.Content[i], src.Content[i])
+		}
+		if len(dst.Content) > len(src.Content) {
+			dst.Content = dst.Content[:len(src.Content)]
+		} else {
+			dst.Content = append(dst.Content, src.Content[len(dst.Content):]...)
+		}
+	case yaml.MappingNode:
+		var content []*yaml.Node
+		for i := 0; i+1 < len(dst.Content); i += 2 {
+			if v := MappingValue(src, dst.Content[i].Value); v != nil {
+				Merge(dst.Content[i+1], v)
+				content = append(content, dst.Content[i], dst.Content[i+1])
+			}
+		}
+		for i := 0; i+1 < len(src.Content); i += 2 {
+			if MappingIndex(dst, src.Content[i].Value) < 0 {
+				content = append(content, src.Content[i], src.Content[i+1])
+			}
+		}
+		dst.Content = content
+	case yaml.ScalarNode:
+		var d, s any
+		if dst.Decode(&d) != nil || src.Decode(&s) != nil || !reflect.DeepEqual(d, s) {
+			Replace(dst, src)
+		}
+	}
+}
+
+// MergePatch applies `patch` into `dst` as JSON Merge Patch (RFC 7396) while
+// keeping the comments and the order of fields in `dst`.
+func MergePatch(dst, patch *yaml.Node) {
+	if patch.Kind != yaml.MappingNode {
+		Replace(dst, patch)
+		return
+	}
+
+	if dst.Kind != yaml.MappingNode {
+		Replace(dst, NewMapping())
+	}
+	for i := 0; i+1 < len(patch.Content); i += 2 {
+		key, value := patch.Content[i], patch.Content[i+1]
+		if value.Kind == yaml.ScalarNode && value.Tag == "!!null" {
+			MappingDelete(dst, key.Value)
+			continue
+		}
+		if v := MappingValue(dst, key.Value); v != nil {
+			MergePatch(v, value)
+			continue
+		}
+		v := &yaml.Node{}
+		MergePatch(v, value)
+		MappingSet(dst, key.Value, v)
+	}
+}
+
+// Replace replaces `dst` with `src` while keeping the comments and the
+// position of `dst`.
+func Replace(dst, src *yaml.Node) {
+	orig := *dst
+	*dst = *src
+	dst.Line, dst.Column = orig.Line, orig.Column
+	if orig.HeadComment != "" {
+		dst.HeadComment = orig.HeadComment
+	}
+	if orig.LineComment != "" {
+		dst.LineComment = orig.LineComment
+	}
+	if orig.FootComment != "" {
+		dst.FootComment = orig.FootComment
+	}
+}
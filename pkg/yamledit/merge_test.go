@@ -0,0 +1,101 @@
+package yamledit
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestMerge(t *testing.T) {
+	dst := `# head
+name: foo # name
+mode: 0o644
+removed: true
+list:
+  - a # first
+  - b
+nested:
+  keep: 'quoted'
+`
+	src := `list: [a, c, d]
+name: bar
+mode: 420
+nested:
+  keep: quoted
+added: new
+`
+	expected := `# head
+name: bar # name
+mode: 0o644
+list:
+  - a # first
+  - c
+  - d
+nested:
+  keep: 'quoted'
+added: new
+`
+
+	d := mustParse(t, dst)
+	Merge(d.Root(), mustParse(t, src).Root())
+	assertEncoded(t, d, expected)
+}
+
+func TestMergePatch(t *testing.T) {
+	dst := `# head
+
+a: 1 # a
+b:
+  c: 2
+  d: 3
+e: [x]
+`
+	patch := `b:
+  c: null
+  f: 4
+e: [y]
+a: null
+g:
+  h: 5
+  i: null
+`
+	expected := `# head
+
+b:
+  d: 3
+  f: 4
+e: [y]
+g:
+  h: 5
+`
+
+	d := mustParse(t, dst)
+	MergePatch(d.Root(), mustParse(t, patch).Root())
+	assertEncoded(t, d, expected)
+
+	scalar := &yaml.Node{Kind: yaml.ScalarNode, Value: "a", LineComment: "# keep"}
+	MergePatch(scalar, mustParse(t, "b: 1").Root())
+	if scalar.Kind != yaml.MappingNode || scalar.LineComment != "# keep" {
+		t.Errorf("expected scalar to be replaced by mapping with comment kept, got %+v", scalar)
+	}
+}
+
+func mustParse(t *testing.T, source string) *Document {
+	t.Helper()
+	doc, err := Parse([]byte(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func assertEncoded(t *testing.T, doc *Document, expected string) {
+	t.Helper()
+	result, err := doc.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(result) != expected {
+		t.Errorf("got\n%s\nwant\n%s", result, expected)
+	}
+}
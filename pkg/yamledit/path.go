@@ -0,0 +1,215 @@
+package yamledit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// PathElement is an element of a path to a YAML node, it's either a mapping
+// key or a sequence index.
+type PathElement struct {
+	Key     string
+	Index   int
+	IsIndex bool
+}
+
+func (e PathElement) String() string {
+	if e.IsIndex {
+		return fmt.Sprintf("[%d]", e.Index)
+	}
+	return e.Key
+}
+
+// ParsePath takes a path like `nodeLabels.foo` or `networkInterfaces[0].dhcp`
+// and returns its elements. Keys containing `.` or `[` can be written as
+// `nodeLabels["topology.kubernetes.io/zone"]`. It returns an error, if any.
+func ParsePath(path string) ([]PathElement, error) {
+	var (
+		result []PathElement
+		rest   = path
+	)
+
+	for rest != "" {
+		switch {
+		case strings.HasPrefix(rest, `["`):
+			end := strings.Index(rest[2:], `"]`)
+			if end < 0 {
+				return nil, fmt.Errorf("invalid path %q: missing closing `\"]`", path)
+			}
+			result = append(result, PathElement{Key: rest[2 : 2+end]})
+			rest = rest[end+4:]
+		case strings.HasPrefix(rest, "["):
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("invalid path %q: missing closing `]`", path)
+			}
+			idx, err := strconv.Atoi(rest[1:end])
+			if err != nil || idx < 0 {
+				return nil, fmt.Errorf("invalid path %q: %q is not a valid index", path, rest[1:end])
+			}
+			result = append(result, PathElement{Index: idx, IsIndex: true})
+			rest = rest[end+1:]
+		default:
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("invalid path %q: empty key", path)
+			}
+			result = append(result, PathElement{Key: rest[:end]})
+			rest = rest[end:]
+		}
+
+		if strings.HasPrefix(rest, ".") {
+			rest = rest[1:]
+			if rest == "" {
+				return nil, fmt.Errorf("invalid path %q: empty key", path)
+			}
+		} else if rest != "" && !strings.HasPrefix(rest, "[") {
+			return nil, fmt.Errorf("invalid path %q: unexpected %q", path, rest)
+		}
+	}
+
+	if len(result) == 0 {
+		return nil, fmt.Errorf("path can't be empty")
+	}
+
+	return result, nil
+}
+
+// Lookup returns the node in `path` of `node` or nil if not found.
+func Lookup(node *yaml.Node, path []PathElement) *yaml.Node {
+	for _, e := range path {
+		node = child(node, e)
+		if node == nil {
+			return nil
+		}
+	}
+	return node
+}
+
+// SetPath sets the node in `path` of `node` to `value`. Missing mappings are
+// created and index equal to the length of a sequence appends to it.
+// It returns an error, if any.
+func SetPath(node *yaml.Node, path []PathElement, value *yaml.Node) error {
+	for i, e := range path {
+		last := i == len(path)-1
+
+		if e.IsIndex {
+			if node.Kind != yaml.SequenceNode {
+				return fmt.Errorf("%s is not a list", joinPath(path[:i]))
+			}
+			if e.Index > len(node.Content) {
+				return fmt.Errorf("%s doesn't have index %d", joinPath(path[:i]), e.Index)
+			}
+			if e.Index == len(node.Content) {
+				if !last && path[i+1].IsIndex {
+					node.Content = append(node.Content, NewSequence())
+				} else {
+					node.Content = append(node.Content, NewMapping())
+				}
+			}
+			if last {
+				Replace(node.Content[e.Index], value)
+				return nil
+			}
+			node = node.Content[e.Index]
+			continue
+		}
+
+		if node.Kind != yaml.MappingNode {
+			return fmt.Errorf("%s is not a map", joinPath(path[:i]))
+		}
+		next := MappingValue(node, e.Key)
+		if last {
+			if next != nil {
+				Replace(next, value)
+			} else {
+				MappingSet(node, e.Key, value)
+			}
+			return nil
+		}
+		if next == nil {
+			next = NewMapping()
+			if path[i+1].IsIndex {
+				next = NewSequence()
+			}
+			MappingSet(node, e.Key, next)
+		}
+		node = next
+	}
+
+	return nil
+}
+
+// DeletePath removes the node in `path` of `node`. It returns true if the
+// node was found.
+func DeletePath(node *yaml.Node, path []PathElement) bool {
+	parent := Lookup(node, path[:len(path)-1])
+	if parent == nil {
+		return false
+	}
+
+	e := path[len(path)-1]
+	if !e.IsIndex {
+		return MappingDelete(parent, e.Key)
+	}
+	if parent.Kind != yaml.SequenceNode || e.Index >= len(parent.Content) {
+		return false
+	}
+	parent.Content = append(parent.Content[:e.Index], parent.Content[e.Index+1:]...)
+	return true
+}
+
+// Locate returns the node of the deepest element of `path` found in `node`,
+// which is the key node for mapping keys, so its position can be reported.
+// It returns nil if the first element of `path` is not found.
+func Locate(node *yaml.Node, path []PathElement) *yaml.Node {
+	var result *yaml.Node
+	for _, e := range path {
+		if !e.IsIndex {
+			idx := MappingIndex(node, e.Key)
+			if idx < 0 {
+				break
+			}
+			result, node = node.Content[idx], node.Content[idx+1]
+			continue
+		}
+
+		next := child(node, e)
+		if next == nil {
+			break
+		}
+		result, node = next, next
+	}
+	return result
+}
+
+func child(node *yaml.Node, e PathElement) *yaml.Node {
+	if !e.IsIndex {
+		return MappingValue(node, e.Key)
+	}
+	if node.Kind != yaml.SequenceNode || e.Index >= len(node.Content) {
+		return nil
+	}
+	return node.Content[e.Index]
+}
+
+func joinPath(path []PathElement) string {
+	if len(path) == 0 {
+		return "root"
+	}
+
+	var b strings.Builder
+	for i, e := range path {
+		if i > 0 && !e.IsIndex {
+			b.WriteString(".")
+		}
+		b.WriteString(e.String())
+	}
+	return b.String()
+}
@@ -0,0 +1,128 @@
+package yamledit
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePath(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected []PathElement
+		wantErr  bool
+	}{
+		{path: "installDisk", expected: []PathElement{{Key: "installDisk"}}},
+		{path: "nodeLabels.rack", expected: []PathElement{{Key: "nodeLabels"}, {Key: "rack"}}},
+		{path: "networkInterfaces[0].vip.ip", expected: []PathElement{{Key: "networkInterfaces"}, {Index: 0, IsIndex: true}, {Key: "vip"}, {Key: "ip"}}},
+		{path: `nodeLabels["topology.kubernetes.io/zone"]`, expected: []PathElement{{Key: "nodeLabels"}, {Key: "topology.kubernetes.io/zone"}}},
+		{path: "a[1][2]", expected: []PathElement{{Key: "a"}, {Index: 1, IsIndex: true}, {Index: 2, IsIndex: true}}},
+		{path: "", wantErr: true},
+		{path: "a.", wantErr: true},
+		{path: "a..b", wantErr: true},
+		{path: "a[x]", wantErr: true},
+		{path: "a[0", wantErr: true},
+		{path: `a["b`, wantErr: true},
+		{path: "a[0]b", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := ParsePath(tt.path)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("got %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSetDeletePath(t *testing.T) {
+	doc := mustParse(t, "a: 1 # a\nlist:\n  - x\n")
+	root := doc.Root()
+
+	set := func(path, value string) error {
+		p, err := ParsePath(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return SetPath(root, p, mustParse(t, value).Root())
+	}
+
+	for _, kv := range [][2]string{
+		{"a", "2"},
+		{"b.c", "true"},
+		{"list[1]", "y"},
+		{"d[0][0]", "z"},
+		{`e["f.g"]`, "h"},
+		{"list[0]", "w"},
+		{"b.i", "[1, 2]"},
+		{"b.i[2]", "3"},
+		{"list[1]", "v"},
+		{"b.c", "false"},
+	} {
+		if err := set(kv[0], kv[1]); err != nil {
+			t.Fatalf("%s: %s", kv[0], err)
+		}
+	}
+	for _, path := range []string{"list[5]", "a.b", "list.a"} {
+		if err := set(path, "1"); err == nil {
+			t.Errorf("%s: expected error, got nil", path)
+		}
+	}
+
+	p, _ := ParsePath("b.i[0]")
+	if !DeletePath(root, p) || DeletePath(root, []PathElement{{Key: "x"}, {Key: "y"}}) {
+		t.Error("unexpected result of deleting path")
+	}
+	if v := Lookup(root, p); v == nil || v.Value != "2" {
+		t.Errorf("got %v, want 2", v)
+	}
+
+	assertEncoded(t, doc, `a: 2 # a
+list:
+  - w
+  - v
+b:
+  c: false
+  i: [2, 3]
+d:
+  - - z
+e:
+  f.g: h
+`)
+}
+
+func TestLocate(t *testing.T) {
+	doc := mustParse(t, "a: 1\nnodes:\n  - hostname: foo\n    labels:\n      x: y\n")
+
+	tests := map[string][2]int{
+		"a":                  {1, 1},
+		"nodes[0].hostname":  {3, 5},
+		"nodes[0].labels.x":  {5, 7},
+		"nodes[0].labels.z":  {4, 5},
+		"nodes[1].hostname":  {2, 1},
+		"nodes[0].foo[0].ba": {3, 5},
+	}
+	for path, expected := range tests {
+		p, err := ParsePath(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := Locate(doc.Root(), p)
+		if n == nil || n.Line != expected[0] || n.Column != expected[1] {
+			t.Errorf("%s: got %v, want %v", path, n, expected)
+		}
+	}
+
+	if Locate(doc.Root(), []PathElement{{Key: "b"}}) != nil {
+		t.Error("expected nil for missing field")
+	}
+}
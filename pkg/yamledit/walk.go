@@ -0,0 +1,66 @@
+package yamledit
+
+import (
+	"errors"
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SkipNode can be returned by the function passed to `Walk` to skip the
+// nodes inside the current node. It's not returned by `Walk`.
+var SkipNode = errors.New("skip this node")
+
+// Walk calls `fn` for `node` and every node inside it with the path to the
+// node, the path contains mapping keys and sequence indexes like `[0]`.
+// Mapping keys are also passed to `fn` with `isKey` set to true. Aliases are
+// not followed. It stops and returns the first error returned by `fn`.
+func Walk(node *yaml.Node, fn func(path []string, n *yaml.Node, isKey bool) error) error {
+	return walk(node, nil, fn)
+}
+
+func walk(node *yaml.Node, path []string, fn func(path []string, n *yaml.Node, isKey bool) error) error {
+	if err := fn(path, node, false); err != nil {
+		if errors.Is(err, SkipNode) {
+			return nil
+		}
+		return err
+	}
+
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			if err := walk(child, path, fn); err != nil {
+				return err
+			}
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i]
+			if err := fn(path, key, true); err != nil && !errors.Is(err, SkipNode) {
+				return err
+			}
+			if err := walk(node.Content[i+1], append(path[:len(path):len(path)], key.Value), fn); err != nil {
+				return err
+			}
+		}
+	case yaml.SequenceNode:
+		for i, child := range node.Content {
+			if err := walk(child, append(path[:len(path):len(path)], fmt.Sprintf("[%d]", i)), fn); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// SetPosition sets the line and column of `node` and every node inside it to
+// `line` and `column`. It's useful to make nodes parsed from a value point to
+// where the value is.
+func SetPosition(node *yaml.Node, line, column int) {
+	node.Line, node.Column = line, column
+	for _, child := range node.Content {
+		SetPosition(child, line, column)
+	}
+}